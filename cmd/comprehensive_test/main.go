@@ -59,7 +59,7 @@ func main() {
 	// Print the test document
 	fmt.Println("Test Document:")
 	prettyPrint(doc)
-	fmt.Println("\n==========================================\n")
+	fmt.Print("\n==========================================\n\n")
 
 	// Define test cases
 	testCases := []struct {
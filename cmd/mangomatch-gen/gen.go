@@ -0,0 +1,712 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+)
+
+// supportedOperators can be translated into typed Go code
+var supportedOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$regex": true, "$size": true, "$not": true,
+}
+
+var comparisonOps = map[string]string{"$gt": ">", "$gte": ">=", "$lt": "<", "$lte": "<="}
+
+type generator struct {
+	fn      string
+	vars    []string
+	imports map[string]bool
+}
+
+// generate returns the source of a file declaring funcName, a matcher over
+// *typeName for query or, if constName is set, for the query held by that
+// string constant
+func generate(dir, typeName, funcName, query, constName string) ([]byte, error) {
+	pkg, err := loadPackage(dir)
+	if err != nil {
+		return nil, err
+	}
+	if constName != "" {
+		var ok bool
+		if query, ok = pkg.consts[constName]; !ok {
+			return nil, fmt.Errorf("no string constant %s in package %s", constName, pkg.pkgName)
+		}
+	}
+	t := pkg.named(typeName)
+	if t.kind != kindStruct {
+		return nil, fmt.Errorf("%s is not a struct type in package %s", typeName, pkg.pkgName)
+	}
+
+	filter, err := mangomatch.ParseExtJSON([]byte(query))
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+	if _, err := mangomatch.Compile(filter); err != nil {
+		return nil, err
+	}
+	if err := checkOperators(filter); err != nil {
+		return nil, err
+	}
+
+	g := &generator{fn: funcName, imports: make(map[string]bool)}
+	body, err := g.query(filter, "v", t)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by mangomatch-gen; DO NOT EDIT.\n\npackage %s\n\n", pkg.pkgName)
+	if len(g.imports) > 0 {
+		buf.WriteString("import (\n")
+		for _, path := range sortedSet(g.imports) {
+			fmt.Fprintf(&buf, "\t%q\n", path)
+		}
+		buf.WriteString(")\n\n")
+	}
+	if len(g.vars) > 0 {
+		buf.WriteString("var (\n")
+		for _, v := range g.vars {
+			fmt.Fprintf(&buf, "\t%s\n", v)
+		}
+		buf.WriteString(")\n\n")
+	}
+	if constName != "" {
+		fmt.Fprintf(&buf, "// %s reports whether v matches %s\n", funcName, constName)
+	} else {
+		fmt.Fprintf(&buf, "// %s reports whether v matches %s\n", funcName, query)
+	}
+	fmt.Fprintf(&buf, "func %s(v *%s) bool {\n\tif v == nil {\n\t\treturn false\n\t}\n\treturn %s\n}\n", funcName, typeName, body)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+// checkOperators rejects operators that have no typed translation
+func checkOperators(query map[string]interface{}) error {
+	for key, value := range query {
+		switch key {
+		case "$and", "$or", "$nor":
+			clauses, _ := value.([]interface{})
+			for _, clause := range clauses {
+				sub, _ := clause.(map[string]interface{})
+				if err := checkOperators(sub); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := checkFieldOperators(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFieldOperators(key string, value interface{}) error {
+	ops, ok := value.(map[string]interface{})
+	if !ok || !isOperatorMap(ops) {
+		return nil
+	}
+	for op, operand := range ops {
+		if !supportedOperators[op] {
+			return fmt.Errorf("field %q: operator %s is not supported by mangomatch-gen; use mangomatch.CompileFunc", key, op)
+		}
+		if op == "$not" {
+			if err := checkFieldOperators(key, operand); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) query(filter map[string]interface{}, root string, t *goType) (string, error) {
+	var conds []string
+	for _, key := range sortedKeys(filter) {
+		value := filter[key]
+		var cond string
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			cond, err = g.logical(key, value, root, t)
+		default:
+			cond, err = g.field(key, value, root, t)
+		}
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 0 {
+		return "false", nil
+	}
+	return and(conds...), nil
+}
+
+func (g *generator) logical(op string, value interface{}, root string, t *goType) (string, error) {
+	clauses, _ := value.([]interface{})
+	conds := make([]string, len(clauses))
+	for i, clause := range clauses {
+		sub, _ := clause.(map[string]interface{})
+		cond, err := g.query(sub, root, t)
+		if err != nil {
+			return "", err
+		}
+		conds[i] = cond
+	}
+	switch op {
+	case "$and":
+		return and(conds...), nil
+	case "$or":
+		return or(conds...), nil
+	default:
+		return not(or(conds...)), nil
+	}
+}
+
+func (g *generator) field(key string, value interface{}, root string, t *goType) (string, error) {
+	guards, expr, leaf, found, err := g.resolvePath(root, t, strings.Split(key, "."))
+	if err != nil {
+		return "", fmt.Errorf("field %q: %v", key, err)
+	}
+
+	// A missing field is tested like null, so conditions such as $ne may
+	// match it
+	matchMissing := mangomatch.Match(map[string]interface{}{"f": value}, map[string]interface{}{})
+	if !found {
+		return strconv.FormatBool(matchMissing), nil
+	}
+
+	pred, err := g.valuePred(expr, leaf, value)
+	if err != nil {
+		return "", fmt.Errorf("field %q: %v", key, err)
+	}
+	present := and(append(guards, pred)...)
+	if matchMissing && len(guards) > 0 {
+		return or(not(and(guards...)), present), nil
+	}
+	return present, nil
+}
+
+// resolvePath finds the Go expression for a dotted path, along with the
+// conditions under which the struct adapter reports the path as present
+func (g *generator) resolvePath(root string, t *goType, path []string) (guards []string, expr string, leaf *goType, found bool, err error) {
+	expr, cur := root, t
+	for i, part := range path {
+		fieldGuards, container, f, err := lookupField(expr, cur, part)
+		if err != nil || f == nil {
+			return nil, "", nil, false, err
+		}
+		guards = append(guards, fieldGuards...)
+		expr = container + "." + f.goName
+
+		if f.omitEmpty {
+			guard, err := nonEmpty(expr, f.typ)
+			if err != nil {
+				return nil, "", nil, false, err
+			}
+			guards = append(guards, guard)
+		}
+		if i == len(path)-1 {
+			return guards, expr, f.typ, true, nil
+		}
+
+		next := f.typ
+		if next.kind == kindPointer {
+			guards = append(guards, expr+" != nil")
+			next = next.elem
+		}
+		switch next.kind {
+		case kindStruct:
+			cur = next
+		case kindInt, kindUint, kindFloat, kindString, kindBool, kindTime:
+			// Scalars have no fields, so the path is never present
+			return nil, "", nil, false, nil
+		default:
+			return nil, "", nil, false, fmt.Errorf("paths through %s values are not supported", f.name)
+		}
+	}
+	return nil, "", nil, false, nil
+}
+
+// lookupField finds the field exposed as name, searching inlined structs
+// after the struct's own fields like the struct adapter does
+func lookupField(expr string, t *goType, name string) ([]string, string, *goField, error) {
+	var direct *goField
+	for _, f := range t.fields {
+		if !f.inline && f.name == name {
+			direct = f
+		}
+	}
+	if direct != nil {
+		return nil, expr, direct, nil
+	}
+
+	for _, f := range t.fields {
+		if !f.inline {
+			continue
+		}
+		inner := f.typ
+		var guards []string
+		if inner.kind == kindPointer {
+			guards = append(guards, expr+"."+f.goName+" != nil")
+			inner = inner.elem
+		}
+		if inner.kind != kindStruct {
+			return nil, "", nil, fmt.Errorf("inline field %s is not a struct", f.goName)
+		}
+		innerGuards, container, found, err := lookupField(expr+"."+f.goName, inner, name)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if found != nil {
+			return append(guards, innerGuards...), container, found, nil
+		}
+	}
+	return nil, "", nil, nil
+}
+
+// nonEmpty is the condition under which an omitempty field is present
+func nonEmpty(expr string, t *goType) (string, error) {
+	switch t.kind {
+	case kindString, kindSlice, kindArray:
+		return "len(" + expr + ") != 0", nil
+	case kindInt, kindUint, kindFloat:
+		return expr + " != 0", nil
+	case kindBool:
+		return boolExpr(expr, t), nil
+	case kindPointer:
+		return expr + " != nil", nil
+	case kindTime:
+		return "!" + expr + ".IsZero()", nil
+	}
+	return "", fmt.Errorf("omitempty is not supported on this field type")
+}
+
+// valuePred is the condition that the value at expr satisfies value, the
+// right-hand side of a field condition
+func (g *generator) valuePred(expr string, t *goType, value interface{}) (string, error) {
+	switch t.kind {
+	case kindPointer:
+		inner, err := g.valuePred("(*"+expr+")", t.elem, value)
+		if err != nil {
+			return "", err
+		}
+		if staticMatch(value, nil) {
+			return or(expr+" == nil", inner), nil
+		}
+		return and(expr+" != nil", inner), nil
+	case kindSlice:
+		inner, err := g.opsPred(expr, t, value)
+		if err != nil {
+			return "", err
+		}
+		// A nil slice is read as null
+		if staticMatch(value, nil) {
+			return or(expr+" == nil", inner), nil
+		}
+		return and(expr+" != nil", inner), nil
+	case kindStruct:
+		// Structs are read as embedded documents, which only operators
+		// such as $exists can match
+		return strconv.FormatBool(staticMatch(value, map[string]interface{}{})), nil
+	case kindOther:
+		return "", fmt.Errorf("field type is not supported")
+	}
+	return g.opsPred(expr, t, value)
+}
+
+// staticMatch evaluates a field condition against a constant value
+func staticMatch(value interface{}, docValue interface{}) bool {
+	return mangomatch.Match(map[string]interface{}{"f": value}, map[string]interface{}{"f": docValue})
+}
+
+func (g *generator) opsPred(expr string, t *goType, value interface{}) (string, error) {
+	ops, ok := value.(map[string]interface{})
+	if !ok {
+		// Plain equality also matches arrays containing the value
+		if isList(t) {
+			return g.anyElem(expr, t, func(el string, et *goType) string { return g.equal(el, et, value) }), nil
+		}
+		return g.equal(expr, t, value), nil
+	}
+	if !isOperatorMap(ops) {
+		return "false", nil
+	}
+
+	var conds []string
+	for _, op := range sortedKeys(ops) {
+		cond, err := g.operator(expr, t, op, ops[op])
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+	return and(conds...), nil
+}
+
+func (g *generator) operator(expr string, t *goType, op string, operand interface{}) (string, error) {
+	list := isList(t)
+	switch op {
+	case "$eq", "$ne":
+		// Like implicit equality, $eq matches any element of an array
+		var cond string
+		if list {
+			cond = g.anyElem(expr, t, func(el string, et *goType) string { return g.equal(el, et, operand) })
+		} else {
+			cond = g.equal(expr, t, operand)
+		}
+		if op == "$ne" {
+			cond = not(cond)
+		}
+		return cond, nil
+	case "$gt", "$gte", "$lt", "$lte":
+		if list {
+			return g.anyElem(expr, t, func(el string, et *goType) string { return g.compare(el, et, op, operand) }), nil
+		}
+		return g.compare(expr, t, op, operand), nil
+	case "$in", "$nin":
+		values, _ := operand.([]interface{})
+		in := func(el string, et *goType) string {
+			conds := make([]string, len(values))
+			for i, v := range values {
+				conds[i] = g.equal(el, et, v)
+			}
+			return or(conds...)
+		}
+		cond := ""
+		if list {
+			cond = g.anyElem(expr, t, in)
+		} else {
+			cond = in(expr, t)
+		}
+		if op == "$nin" {
+			cond = not(cond)
+		}
+		return cond, nil
+	case "$exists":
+		exists, _ := operand.(bool)
+		return strconv.FormatBool(exists), nil
+	case "$regex":
+		pattern, _ := operand.(string)
+		re := g.declare("Re", fmt.Sprintf("regexp.MustCompile(%s)", strconv.Quote(pattern)), "regexp")
+		match := func(el string, et *goType) string {
+			if et.kind != kindString {
+				return "false"
+			}
+			return fmt.Sprintf("%s.MatchString(%s)", re, stringExpr(el, et))
+		}
+		if list {
+			return g.anyElem(expr, t, match), nil
+		}
+		return match(expr, t), nil
+	case "$size":
+		if !list {
+			return "false", nil
+		}
+		size, ok := operand.(int)
+		switch n := operand.(type) {
+		case int64:
+			size, ok = int(n), true
+		case float64:
+			size, ok = int(n), true
+		}
+		if !ok {
+			return "false", nil
+		}
+		return fmt.Sprintf("len(%s) == %d", expr, size), nil
+	case "$not":
+		cond, err := g.opsPred(expr, t, operand)
+		return not(cond), err
+	}
+	return "", fmt.Errorf("operator %s is not supported", op)
+}
+
+func isList(t *goType) bool {
+	return t.kind == kindSlice || t.kind == kindArray
+}
+
+// anyElem is true when pred holds for some element of a slice or array
+func (g *generator) anyElem(expr string, t *goType, pred func(el string, et *goType) string) string {
+	et := t.elem
+	var cond string
+	switch et.kind {
+	case kindInt, kindUint, kindFloat, kindString, kindBool, kindTime:
+		cond = pred("el", et)
+	case kindPointer:
+		// nil elements are read as null, which no element condition matches
+		switch et.elem.kind {
+		case kindInt, kindUint, kindFloat, kindString, kindBool, kindTime:
+			cond = and("el != nil", pred("(*el)", et.elem))
+		default:
+			cond = "false"
+		}
+	default:
+		cond = "false"
+	}
+	if cond == "false" {
+		return "false"
+	}
+	return fmt.Sprintf("func() bool {\n\tfor _, el := range %s {\n\t\tif %s {\n\t\t\treturn true\n\t\t}\n\t}\n\treturn false\n}()", expr, cond)
+}
+
+// equal mirrors the matcher's compareEqual for a typed value
+func (g *generator) equal(expr string, t *goType, operand interface{}) string {
+	switch o := operand.(type) {
+	case int, int64, float64:
+		return g.numeric(expr, t, "==", o)
+	case string:
+		if t.kind == kindString {
+			return expr + " == " + strconv.Quote(o)
+		}
+	case bool:
+		if t.kind == kindBool {
+			if o {
+				return boolExpr(expr, t)
+			}
+			return "!" + boolExpr(expr, t)
+		}
+	case time.Time:
+		if t.kind == kindTime {
+			return fmt.Sprintf("%s.Equal(%s)", expr, g.timeVar(o))
+		}
+	}
+	return "false"
+}
+
+// compare mirrors the matcher's ordered comparisons for a typed value
+func (g *generator) compare(expr string, t *goType, op string, operand interface{}) string {
+	switch o := operand.(type) {
+	case int, int64, float64:
+		return g.numeric(expr, t, comparisonOps[op], o)
+	case string:
+		if t.kind == kindString {
+			return fmt.Sprintf("%s %s %s", expr, comparisonOps[op], strconv.Quote(o))
+		}
+	case time.Time:
+		if t.kind == kindTime {
+			tv := g.timeVar(o)
+			switch op {
+			case "$gt":
+				return fmt.Sprintf("%s.After(%s)", expr, tv)
+			case "$gte":
+				return fmt.Sprintf("!%s.Before(%s)", expr, tv)
+			case "$lt":
+				return fmt.Sprintf("%s.Before(%s)", expr, tv)
+			default:
+				return fmt.Sprintf("!%s.After(%s)", expr, tv)
+			}
+		}
+	}
+	return "false"
+}
+
+// numeric compares a number field with an int, int64 or float64 operand.
+// The matcher reads signed integers as int and everything else as float64.
+func (g *generator) numeric(expr string, t *goType, cmp string, operand interface{}) string {
+	if n, ok := operand.(int64); ok {
+		// Extended JSON longs
+		if n >= math.MinInt && n <= math.MaxInt {
+			operand = int(n)
+		} else {
+			operand = float64(n)
+		}
+	}
+	switch t.kind {
+	case kindInt:
+		if n, ok := operand.(int); ok {
+			if t.name != "int" {
+				expr = "int(" + expr + ")"
+			}
+			return fmt.Sprintf("%s %s %d", expr, cmp, n)
+		}
+	case kindUint, kindFloat:
+	default:
+		return "false"
+	}
+	if t.name != "float64" {
+		expr = "float64(" + expr + ")"
+	}
+	return fmt.Sprintf("%s %s %s", expr, cmp, numberLiteral(operand))
+}
+
+func numberLiteral(v interface{}) string {
+	switch n := v.(type) {
+	case int:
+		return strconv.Itoa(n)
+	case float64:
+		s := strconv.FormatFloat(n, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	}
+	return "0"
+}
+
+func boolExpr(expr string, t *goType) string {
+	if t.named {
+		return "bool(" + expr + ")"
+	}
+	return expr
+}
+
+func stringExpr(expr string, t *goType) string {
+	if t.named {
+		return "string(" + expr + ")"
+	}
+	return expr
+}
+
+// declare adds a package-level variable and returns its name
+func (g *generator) declare(prefix, value, importPath string) string {
+	name := fmt.Sprintf("%s%s%d", g.fn, prefix, len(g.vars))
+	g.vars = append(g.vars, name+" = "+value)
+	g.imports[importPath] = true
+	return name
+}
+
+func (g *generator) timeVar(t time.Time) string {
+	t = t.UTC()
+	return g.declare("Time", fmt.Sprintf("time.Date(%d, %d, %d, %d, %d, %d, %d, time.UTC)",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()), "time")
+}
+
+// and, or and not build boolean expressions, folding constants
+func and(conds ...string) string {
+	var kept []string
+	seen := make(map[string]bool)
+	for _, c := range conds {
+		switch c {
+		case "true":
+			continue
+		case "false":
+			return "false"
+		}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		kept = append(kept, c)
+	}
+	switch len(kept) {
+	case 0:
+		return "true"
+	case 1:
+		return kept[0]
+	}
+	return "(" + strings.Join(kept, " && ") + ")"
+}
+
+func or(conds ...string) string {
+	var kept []string
+	seen := make(map[string]bool)
+	for _, c := range conds {
+		for _, c := range disjuncts(c) {
+			switch c {
+			case "false":
+				continue
+			case "true":
+				return "true"
+			}
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			kept = append(kept, c)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return "false"
+	case 1:
+		return kept[0]
+	}
+	return "(" + strings.Join(kept, " || ") + ")"
+}
+
+// disjuncts splits a condition that or built into its operands, so that
+// nested ones are flattened and repeated operands dropped
+func disjuncts(cond string) []string {
+	if !strings.HasPrefix(cond, "(") || !strings.HasSuffix(cond, ")") {
+		return []string{cond}
+	}
+	inner := cond[1 : len(cond)-1]
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(inner); i++ {
+		switch inner[i] {
+		case '"':
+			// Skip string literals, which strconv.Quote wrote
+			for i++; i < len(inner) && inner[i] != '"'; i++ {
+				if inner[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return []string{cond}
+			}
+		case ' ':
+			if depth == 0 && strings.HasPrefix(inner[i:], " || ") {
+				parts = append(parts, inner[start:i])
+				start = i + len(" || ")
+			}
+		}
+	}
+	if depth != 0 || len(parts) == 0 {
+		return []string{cond}
+	}
+	return append(parts, inner[start:])
+}
+
+func not(cond string) string {
+	switch cond {
+	case "true":
+		return "false"
+	case "false":
+		return "true"
+	}
+	return "!(" + cond + ")"
+}
+
+func isOperatorMap(m map[string]interface{}) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedSet(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGeneratedFilesUpToDate regenerates every matcher declared with
+// //go:generate in internal/gentest and compares it with the committed file
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	dir := filepath.Join("internal", "gentest")
+	f, err := os.Open(filepath.Join(dir, "user.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "//go:generate ") {
+			continue
+		}
+		flags := make(map[string]string)
+		for _, arg := range strings.Fields(line)[4:] {
+			name, value, _ := strings.Cut(strings.TrimPrefix(arg, "-"), "=")
+			flags[name] = value
+		}
+		count++
+
+		t.Run(flags["func"], func(t *testing.T) {
+			got, err := generate(dir, flags["type"], flags["func"], "", flags["const"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := strings.ToLower(flags["type"] + "_" + flags["func"] + "_match.go")
+			want, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("%s is stale; run go generate ./...\ngot:\n%s", name, got)
+			}
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Fatal("no //go:generate directives found")
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := filepath.Join("internal", "gentest")
+	tests := []struct {
+		name     string
+		typeName string
+		query    string
+		constant string
+		wantErr  string
+	}{
+		{"unsupported operator", "User", `{"roles": {"$all": ["admin"]}}`, "", "use mangomatch.CompileFunc"},
+		{"invalid query", "User", `{"age": {"$gt": 1}`, "", "invalid query"},
+		{"unknown operator", "User", `{"age": {"$foo": 1}}`, "", "$foo"},
+		{"path through slice", "User", `{"roles.name": "x"}`, "", "not supported"},
+		{"not a struct", "Status", `{"a": 1}`, "", "not a struct"},
+		{"missing type", "Nope", `{"a": 1}`, "", "not a struct"},
+		{"missing constant", "User", "", "nopeQuery", "no string constant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generate(dir, tt.typeName, "matchX", tt.query, tt.constant)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("generate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateUnknownField(t *testing.T) {
+	src, err := generate(filepath.Join("internal", "gentest"), "User", "matchX", `{"nope": {"$exists": false}}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "return true") {
+		t.Errorf("Expected a missing field to fold to true, got:\n%s", src)
+	}
+}
+
+func TestOrFlattens(t *testing.T) {
+	tests := []struct {
+		conds []string
+		want  string
+	}{
+		{conds: []string{"a", "(a || b)"}, want: "(a || b)"},
+		{conds: []string{"(a || (b && c))", "d"}, want: "(a || (b && c) || d)"},
+		{conds: []string{`(s == "x || (y")`, "a"}, want: `((s == "x || (y") || a)`},
+		{conds: []string{"(a) && (b)", "c"}, want: "((a) && (b) || c)"},
+		{conds: []string{"false", "(a || true)"}, want: "true"},
+	}
+	for _, tt := range tests {
+		if got := or(tt.conds...); got != tt.want {
+			t.Errorf("or(%q) = %s, want %s", tt.conds, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Package gentest holds matchers generated by mangomatch-gen for a sample
+// struct, so they can be checked against mangomatch.Match.
+package gentest
+
+import "time"
+
+// Queries compiled by the go:generate directives below
+const (
+	adultQuery       = `{"age":{"$gte":18}}`
+	activeAdminQuery = `{"active":true,"roles":"admin","name":{"$regex":"^[a-m]"}}`
+	scoresQuery      = `{"scores":{"$gt":90},"rating":{"$lte":4.5,"$ne":3}}`
+	cityQuery        = `{"address.city":{"$in":["Paris","Berlin"]},"address.zip":{"$exists":true}}`
+	noManagerQuery   = `{"$or":[{"manager":{"$exists":false}},{"manager.name":{"$nin":["eve"]}}]}`
+	recentQuery      = `{"created":{"$gte":{"$date":"2024-01-01T00:00:00Z"}},"status":{"$ne":"banned"}}`
+	notQuery         = `{"$and":[{"age":{"$not":{"$lt":30}}},{"$nor":[{"roles":{"$size":0}},{"nickname":null}]}]}`
+	embeddedQuery    = `{"source":"web","level":{"$in":[1,2.5]},"tags":"x","audit.by":{"$ne":"ops"}}`
+	nullQuery        = `{"address.zip":null,"manager.age":{"$not":{"$gt":40}},"manager.nickname":{"$in":[null,"al"]}}`
+)
+
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchAdult -const=adultQuery
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchActiveAdmin -const=activeAdminQuery
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchScores -const=scoresQuery
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchCity -const=cityQuery
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchNoManager -const=noManagerQuery
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchRecent -const=recentQuery
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchNot -const=notQuery
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchEmbedded -const=embeddedQuery
+//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=matchNull -const=nullQuery
+
+type Status string
+
+type Address struct {
+	City string `bson:"city"`
+	Zip  string `bson:"zip,omitempty"`
+}
+
+type Meta struct {
+	Source string `json:"source"`
+	Level  int8
+}
+
+type Audit struct {
+	By string `bson:"by"`
+}
+
+type User struct {
+	Meta `bson:",inline"`
+	Audit
+	Name     string    `bson:"name"`
+	Age      int       `bson:"age"`
+	Active   bool      `bson:"active"`
+	Roles    []string  `bson:"roles"`
+	Scores   []int     `bson:"scores"`
+	Rating   float32   `bson:"rating"`
+	Status   Status    `bson:"status,omitempty"`
+	Nickname *string   `bson:"nickname"`
+	Address  Address   `bson:"address"`
+	Manager  *User     `bson:"manager,omitempty"`
+	Created  time.Time `bson:"created"`
+	Tags     [2]string `bson:"tags"`
+	secret   string
+}
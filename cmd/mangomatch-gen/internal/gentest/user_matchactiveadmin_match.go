@@ -0,0 +1,26 @@
+// Code generated by mangomatch-gen; DO NOT EDIT.
+
+package gentest
+
+import (
+	"regexp"
+)
+
+var (
+	matchActiveAdminRe0 = regexp.MustCompile("^[a-m]")
+)
+
+// matchActiveAdmin reports whether v matches activeAdminQuery
+func matchActiveAdmin(v *User) bool {
+	if v == nil {
+		return false
+	}
+	return (v.Active && matchActiveAdminRe0.MatchString(v.Name) && (v.Roles != nil && func() bool {
+		for _, el := range v.Roles {
+			if el == "admin" {
+				return true
+			}
+		}
+		return false
+	}()))
+}
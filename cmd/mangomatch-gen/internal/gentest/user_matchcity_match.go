@@ -0,0 +1,11 @@
+// Code generated by mangomatch-gen; DO NOT EDIT.
+
+package gentest
+
+// matchCity reports whether v matches cityQuery
+func matchCity(v *User) bool {
+	if v == nil {
+		return false
+	}
+	return ((v.Address.City == "Paris" || v.Address.City == "Berlin") && len(v.Address.Zip) != 0)
+}
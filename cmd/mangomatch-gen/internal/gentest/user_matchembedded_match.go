@@ -0,0 +1,18 @@
+// Code generated by mangomatch-gen; DO NOT EDIT.
+
+package gentest
+
+// matchEmbedded reports whether v matches embeddedQuery
+func matchEmbedded(v *User) bool {
+	if v == nil {
+		return false
+	}
+	return (!(v.Audit.By == "ops") && (int(v.Meta.Level) == 1 || float64(v.Meta.Level) == 2.5) && v.Meta.Source == "web" && func() bool {
+		for _, el := range v.Tags {
+			if el == "x" {
+				return true
+			}
+		}
+		return false
+	}())
+}
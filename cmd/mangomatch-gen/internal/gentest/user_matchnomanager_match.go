@@ -0,0 +1,11 @@
+// Code generated by mangomatch-gen; DO NOT EDIT.
+
+package gentest
+
+// matchNoManager reports whether v matches noManagerQuery
+func matchNoManager(v *User) bool {
+	if v == nil {
+		return false
+	}
+	return (!(v.Manager != nil) || (v.Manager != nil && !(v.Manager.Name == "eve")))
+}
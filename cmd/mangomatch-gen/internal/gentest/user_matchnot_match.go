@@ -0,0 +1,11 @@
+// Code generated by mangomatch-gen; DO NOT EDIT.
+
+package gentest
+
+// matchNot reports whether v matches notQuery
+func matchNot(v *User) bool {
+	if v == nil {
+		return false
+	}
+	return (!(v.Age < 30) && !((v.Roles != nil && len(v.Roles) == 0) || v.Nickname == nil))
+}
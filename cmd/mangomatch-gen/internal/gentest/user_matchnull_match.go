@@ -0,0 +1,11 @@
+// Code generated by mangomatch-gen; DO NOT EDIT.
+
+package gentest
+
+// matchNull reports whether v matches nullQuery
+func matchNull(v *User) bool {
+	if v == nil {
+		return false
+	}
+	return (!(len(v.Address.Zip) != 0) && (!(v.Manager != nil) || (v.Manager != nil && !(v.Manager.Age > 40))) && (!(v.Manager != nil) || (v.Manager != nil && (v.Manager.Nickname == nil || (*v.Manager.Nickname) == "al"))))
+}
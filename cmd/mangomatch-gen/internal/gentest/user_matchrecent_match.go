@@ -0,0 +1,19 @@
+// Code generated by mangomatch-gen; DO NOT EDIT.
+
+package gentest
+
+import (
+	"time"
+)
+
+var (
+	matchRecentTime0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// matchRecent reports whether v matches recentQuery
+func matchRecent(v *User) bool {
+	if v == nil {
+		return false
+	}
+	return (!v.Created.Before(matchRecentTime0) && (!(len(v.Status) != 0) || (len(v.Status) != 0 && !(v.Status == "banned"))))
+}
@@ -0,0 +1,18 @@
+// Code generated by mangomatch-gen; DO NOT EDIT.
+
+package gentest
+
+// matchScores reports whether v matches scoresQuery
+func matchScores(v *User) bool {
+	if v == nil {
+		return false
+	}
+	return ((float64(v.Rating) <= 4.5 && !(float64(v.Rating) == 3)) && (v.Scores != nil && func() bool {
+		for _, el := range v.Scores {
+			if el > 90 {
+				return true
+			}
+		}
+		return false
+	}()))
+}
@@ -0,0 +1,136 @@
+package gentest
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+)
+
+var generated = []struct {
+	name  string
+	query string
+	fn    func(*User) bool
+}{
+	{"matchAdult", adultQuery, matchAdult},
+	{"matchActiveAdmin", activeAdminQuery, matchActiveAdmin},
+	{"matchScores", scoresQuery, matchScores},
+	{"matchCity", cityQuery, matchCity},
+	{"matchNoManager", noManagerQuery, matchNoManager},
+	{"matchRecent", recentQuery, matchRecent},
+	{"matchNot", notQuery, matchNot},
+	{"matchEmbedded", embeddedQuery, matchEmbedded},
+	{"matchNull", nullQuery, matchNull},
+}
+
+func pick[T any](r *rand.Rand, values ...T) T {
+	return values[r.Intn(len(values))]
+}
+
+func randomUser(r *rand.Rand, depth int) *User {
+	u := &User{
+		Meta:    Meta{Source: pick(r, "", "web", "api"), Level: pick[int8](r, 0, 1, 2, 3)},
+		Audit:   Audit{By: pick(r, "", "ops", "admin")},
+		Name:    pick(r, "", "alice", "bob", "mallory", "zed"),
+		Age:     r.Intn(60),
+		Active:  r.Intn(2) == 0,
+		Rating:  pick[float32](r, 0, 1.5, 3, 4.5, 5),
+		Status:  pick[Status](r, "", "active", "banned"),
+		Address: Address{City: pick(r, "", "Paris", "Berlin", "Rome"), Zip: pick(r, "", "75001")},
+		Created: pick(r, time.Time{}, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)),
+		Tags:    [2]string{pick(r, "", "x", "y"), pick(r, "", "x", "y")},
+	}
+	switch r.Intn(3) {
+	case 0:
+		u.Roles = nil
+	case 1:
+		u.Roles = []string{}
+	default:
+		u.Roles = []string{pick(r, "admin", "dev"), pick(r, "ops", "admin")}
+	}
+	for i := r.Intn(3); i > 0; i-- {
+		u.Scores = append(u.Scores, r.Intn(100))
+	}
+	if r.Intn(2) == 0 {
+		nick := pick(r, "", "al")
+		u.Nickname = &nick
+	}
+	if depth > 0 && r.Intn(2) == 0 {
+		u.Manager = randomUser(r, depth-1)
+		u.Manager.Name = pick(r, "eve", "frank")
+	}
+	return u
+}
+
+// TestGeneratedMatchesMatch checks every generated matcher against Match and
+// the runtime closure compiler on random users
+func TestGeneratedMatchesMatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	users := make([]*User, 2000)
+	for i := range users {
+		users[i] = randomUser(r, 1)
+	}
+
+	for _, g := range generated {
+		t.Run(g.name, func(t *testing.T) {
+			query, err := mangomatch.ParseExtJSON([]byte(g.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+			compiled, err := mangomatch.CompileFunc[*User](query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matched := 0
+			for _, u := range users {
+				want := mangomatch.MatchStruct(query, u)
+				if got := g.fn(u); got != want {
+					t.Fatalf("%s(%+v) = %v, Match = %v", g.name, *u, got, want)
+				}
+				if got := compiled(u); got != want {
+					t.Fatalf("CompileFunc(%+v) = %v, Match = %v", *u, got, want)
+				}
+				if want {
+					matched++
+				}
+			}
+			if matched == 0 || matched == len(users) {
+				t.Errorf("query selected %d of %d users; the test data does not exercise it", matched, len(users))
+			}
+			if g.fn(nil) {
+				t.Error("Expected nil to never match")
+			}
+		})
+	}
+}
+
+func BenchmarkMatchers(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	u := randomUser(r, 1)
+	query, _ := mangomatch.ParseExtJSON([]byte(scoresQuery))
+	compiled, _ := mangomatch.CompileFunc[*User](query)
+
+	for _, bm := range []struct {
+		name string
+		fn   func(*User) bool
+	}{
+		{"Generated", matchScores},
+		{"CompileFunc", compiled},
+		{"MatchStruct", func(u *User) bool { return mangomatch.MatchStruct(query, u) }},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bm.fn(u)
+			}
+		})
+	}
+}
+
+func ExampleUser() {
+	fmt.Println(matchAdult(&User{Age: 30}), matchAdult(&User{Age: 12}))
+	// Output: true false
+}
@@ -0,0 +1,58 @@
+// Command mangomatch-gen generates a specialized matcher for a query and a
+// struct type. The generated func(*T) bool reads typed fields directly, with
+// no reflection or interface boxing, and agrees with mangomatch.Match on
+// every value of T:
+//
+//	const adultQuery = `{"age": {"$gte": 18}}`
+//
+//	//go:generate go run github.com/The-iyed/mangomatch/cmd/mangomatch-gen -type=User -func=isAdult -const=adultQuery
+//
+// The query is Extended JSON, given with -query or read from a string
+// constant in the package with -const. go generate expands $ in directives,
+// so -const is the easier way to write operators there.
+//
+// Supported operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin,
+// $exists, $regex, $size, $not, $and, $or and $nor; paths may descend
+// through embedded structs but not through slices or maps. Use
+// mangomatch.CompileFunc for anything else.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "struct type the matcher reads (required)")
+	funcName := flag.String("func", "", "name of the generated function (default Match<Type>)")
+	query := flag.String("query", "", "query in Extended JSON")
+	constName := flag.String("const", "", "string constant in the package holding the query")
+	output := flag.String("o", "", "output file (default <type>_<func>_match.go)")
+	dir := flag.String("dir", ".", "directory of the package declaring the type")
+	flag.Parse()
+
+	if *typeName == "" || (*query == "") == (*constName == "") {
+		fmt.Fprintln(os.Stderr, "mangomatch-gen: -type and exactly one of -query or -const are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *funcName == "" {
+		*funcName = "Match" + *typeName
+	}
+	if *output == "" {
+		*output = strings.ToLower(*typeName + "_" + *funcName + "_match.go")
+	}
+
+	src, err := generate(*dir, *typeName, *funcName, *query, *constName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mangomatch-gen: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filepath.Join(*dir, *output), src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "mangomatch-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type kind int
+
+const (
+	kindOther kind = iota
+	kindInt
+	kindUint
+	kindFloat
+	kindString
+	kindBool
+	kindTime
+	kindStruct
+	kindSlice
+	kindArray
+	kindPointer
+)
+
+// goType is the part of a Go type the generator needs to read values the
+// way mangomatch's struct adapter does
+type goType struct {
+	kind   kind
+	name   string // Go spelling, e.g. "int64" or "Status"
+	named  bool   // a defined type whose underlying type is a basic type
+	elem   *goType
+	fields []*goField
+}
+
+// goField mirrors the struct adapter's naming: bson tag, json tag, then the
+// lowercased Go name; untagged embedded structs are inlined
+type goField struct {
+	goName    string
+	name      string
+	typ       *goType
+	omitEmpty bool
+	inline    bool
+}
+
+// pkgTypes resolves type expressions of one parsed package
+type pkgTypes struct {
+	pkgName string
+	specs   map[string]*ast.TypeSpec
+	types   map[string]*goType
+	consts  map[string]string
+}
+
+func loadPackage(dir string) (*pkgTypes, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	p := &pkgTypes{
+		specs:  make(map[string]*ast.TypeSpec),
+		types:  make(map[string]*goType),
+		consts: make(map[string]string),
+	}
+	for name, pkg := range pkgs {
+		p.pkgName = name
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						p.specs[spec.Name.Name] = spec
+					case *ast.ValueSpec:
+						if gen.Tok == token.CONST {
+							p.addConsts(spec)
+						}
+					}
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// addConsts records constants initialized with a string literal
+func (p *pkgTypes) addConsts(spec *ast.ValueSpec) {
+	for i, name := range spec.Names {
+		if i >= len(spec.Values) {
+			return
+		}
+		lit, ok := spec.Values[i].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			continue
+		}
+		if value, err := strconv.Unquote(lit.Value); err == nil {
+			p.consts[name.Name] = value
+		}
+	}
+}
+
+var basicKinds = map[string]kind{
+	"int": kindInt, "int8": kindInt, "int16": kindInt, "int32": kindInt, "int64": kindInt,
+	"uint": kindUint, "uint8": kindUint, "uint16": kindUint, "uint32": kindUint, "uint64": kindUint, "uintptr": kindUint,
+	"byte": kindUint, "rune": kindInt,
+	"float32": kindFloat, "float64": kindFloat,
+	"string": kindString, "bool": kindBool,
+}
+
+func (p *pkgTypes) resolve(expr ast.Expr) *goType {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if k, ok := basicKinds[t.Name]; ok {
+			return &goType{kind: k, name: t.Name}
+		}
+		return p.named(t.Name)
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" && t.Sel.Name == "Time" {
+			return &goType{kind: kindTime, name: "time.Time"}
+		}
+	case *ast.StarExpr:
+		return &goType{kind: kindPointer, elem: p.resolve(t.X)}
+	case *ast.ArrayType:
+		elem := p.resolve(t.Elt)
+		if t.Len == nil {
+			// []byte is kept as raw bytes by the struct adapter
+			if elem.kind == kindUint && (elem.name == "byte" || elem.name == "uint8") {
+				return &goType{kind: kindOther}
+			}
+			return &goType{kind: kindSlice, elem: elem}
+		}
+		return &goType{kind: kindArray, elem: elem}
+	case *ast.StructType:
+		return p.structType("", t)
+	}
+	return &goType{kind: kindOther}
+}
+
+// named resolves a type declared in the package, caching it so that
+// recursive types terminate
+func (p *pkgTypes) named(name string) *goType {
+	if t, ok := p.types[name]; ok {
+		return t
+	}
+	spec, ok := p.specs[name]
+	if !ok || spec.TypeParams != nil {
+		return &goType{kind: kindOther}
+	}
+
+	if st, ok := spec.Type.(*ast.StructType); ok {
+		t := &goType{kind: kindStruct, name: name}
+		p.types[name] = t
+		t.fields = p.structType(name, st).fields
+		return t
+	}
+
+	t := &goType{}
+	p.types[name] = t
+	*t = *p.resolve(spec.Type)
+	switch t.kind {
+	case kindInt, kindUint, kindFloat, kindString, kindBool:
+		t.name, t.named = name, true
+	}
+	return t
+}
+
+func (p *pkgTypes) structType(name string, st *ast.StructType) *goType {
+	t := &goType{kind: kindStruct, name: name}
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err == nil {
+				tag = reflect.StructTag(unquoted)
+			}
+		}
+		tagName, opts := fieldTag(tag)
+		if tagName == "-" && opts == "" {
+			continue
+		}
+		typ := p.resolve(f.Type)
+
+		names := f.Names
+		if len(names) == 0 {
+			// Embedded field: named after its type
+			names = []*ast.Ident{ast.NewIdent(embeddedName(f.Type))}
+		}
+		for _, ident := range names {
+			// The driver skips unexported fields, embedded structs included
+			if !ast.IsExported(ident.Name) {
+				continue
+			}
+
+			field := &goField{
+				goName:    ident.Name,
+				name:      tagName,
+				typ:       typ,
+				omitEmpty: strings.Contains(opts, "omitempty"),
+				inline:    strings.Contains(opts, "inline"),
+			}
+			if field.name == "" {
+				field.name = strings.ToLower(ident.Name)
+			}
+			t.fields = append(t.fields, field)
+		}
+	}
+	return t
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+// fieldTag reads the bson tag, falling back to the json tag
+func fieldTag(tag reflect.StructTag) (name string, opts string) {
+	value, ok := tag.Lookup("bson")
+	if !ok {
+		value, ok = tag.Lookup("json")
+	}
+	if !ok {
+		return "", ""
+	}
+	name, opts, _ = strings.Cut(value, ",")
+	return name, opts
+}
@@ -0,0 +1,34 @@
+// Command mangomatch-server exposes mangomatch over HTTP so that services
+// written in other languages get the same query semantics:
+//
+//	POST /match      {"query": {...}, "doc": {...}}        -> {"match": true}
+//	POST /filter     {"query": {...}, "docs": [...]}       -> {"docs": [...], "count": 2}
+//	POST /validate   {"query": {...}}                      -> {"valid": true}
+//	POST /aggregate  {"pipeline": [...], "docs": [...]}    -> {"docs": [...]}
+//	GET  /metrics    Prometheus text format
+//
+// Request and response bodies are MongoDB Extended JSON (relaxed form), so
+// values such as {"$date": "2024-01-01T00:00:00Z"} keep their type.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	maxBody := flag.Int64("max-body", 10<<20, "maximum request body size in bytes")
+	timeout := flag.Duration("timeout", 5*time.Second, "maximum time spent evaluating one request")
+	flag.Parse()
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newServer(config{maxBodyBytes: *maxBody, timeout: *timeout}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("mangomatch-server listening on %s", *addr)
+	log.Fatal(srv.ListenAndServe())
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metrics collects request counters in the Prometheus text format without
+// depending on the Prometheus client library
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]int64
+	durations map[string]*durationSummary
+	documents int64
+	timeouts  int64
+}
+
+type requestKey struct {
+	endpoint string
+	code     int
+}
+
+type durationSummary struct {
+	count int64
+	sum   float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  make(map[requestKey]int64),
+		durations: make(map[string]*durationSummary),
+	}
+}
+
+func (m *metrics) observe(endpoint string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{endpoint: endpoint, code: code}]++
+	summary, ok := m.durations[endpoint]
+	if !ok {
+		summary = &durationSummary{}
+		m.durations[endpoint] = summary
+	}
+	summary.count++
+	summary.sum += d.Seconds()
+}
+
+func (m *metrics) evaluated(n int) {
+	m.mu.Lock()
+	m.documents += int64(n)
+	m.mu.Unlock()
+}
+
+func (m *metrics) timeout() {
+	m.mu.Lock()
+	m.timeouts++
+	m.mu.Unlock()
+}
+
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m := s.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].code < keys[j].code
+	})
+	fmt.Fprintln(w, "# HELP mangomatch_requests_total Requests handled, by endpoint and status code.")
+	fmt.Fprintln(w, "# TYPE mangomatch_requests_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "mangomatch_requests_total{endpoint=%q,code=\"%d\"} %d\n", key.endpoint, key.code, m.requests[key])
+	}
+
+	endpoints := make([]string, 0, len(m.durations))
+	for endpoint := range m.durations {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	fmt.Fprintln(w, "# HELP mangomatch_request_duration_seconds Time spent handling requests.")
+	fmt.Fprintln(w, "# TYPE mangomatch_request_duration_seconds summary")
+	for _, endpoint := range endpoints {
+		summary := m.durations[endpoint]
+		fmt.Fprintf(w, "mangomatch_request_duration_seconds_sum{endpoint=%q} %s\n", endpoint, strconv.FormatFloat(summary.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "mangomatch_request_duration_seconds_count{endpoint=%q} %d\n", endpoint, summary.count)
+	}
+
+	fmt.Fprintln(w, "# HELP mangomatch_documents_evaluated_total Documents evaluated against queries and pipelines.")
+	fmt.Fprintln(w, "# TYPE mangomatch_documents_evaluated_total counter")
+	fmt.Fprintf(w, "mangomatch_documents_evaluated_total %d\n", m.documents)
+
+	fmt.Fprintln(w, "# HELP mangomatch_timeouts_total Requests that exceeded the evaluation timeout.")
+	fmt.Fprintln(w, "# TYPE mangomatch_timeouts_total counter")
+	fmt.Fprintf(w, "mangomatch_timeouts_total %d\n", m.timeouts)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// config holds the limits applied to every request
+type config struct {
+	maxBodyBytes int64
+	timeout      time.Duration
+}
+
+type server struct {
+	cfg     config
+	mux     *http.ServeMux
+	metrics *metrics
+}
+
+func newServer(cfg config) *server {
+	s := &server{cfg: cfg, mux: http.NewServeMux(), metrics: newMetrics()}
+	s.mux.HandleFunc("/match", s.handle("/match", s.match))
+	s.mux.HandleFunc("/filter", s.handle("/filter", s.filter))
+	s.mux.HandleFunc("/validate", s.handle("/validate", s.validate))
+	s.mux.HandleFunc("/aggregate", s.handle("/aggregate", s.aggregate))
+	s.mux.HandleFunc("/metrics", s.serveMetrics)
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// request is the envelope shared by all endpoints. Each field is kept as raw
+// JSON and parsed as Extended JSON by the endpoints that use it.
+type request struct {
+	Query    json.RawMessage `json:"query"`
+	Doc      json.RawMessage `json:"doc"`
+	Docs     json.RawMessage `json:"docs"`
+	Pipeline json.RawMessage `json:"pipeline"`
+}
+
+// httpError is an error with the status code it should be reported with
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{status: http.StatusBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+type handlerFunc func(ctx context.Context, req *request) (bson.D, error)
+
+// handle wraps an endpoint with the method check, body limit, evaluation
+// timeout, error reporting and metrics
+func (s *server) handle(endpoint string, fn handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		status := s.serve(w, r, fn)
+		s.metrics.observe(endpoint, status, time.Since(start))
+	}
+}
+
+func (s *server) serve(w http.ResponseWriter, r *http.Request, fn handlerFunc) int {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return writeError(w, &httpError{status: http.StatusMethodNotAllowed, msg: "method not allowed"})
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.maxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return writeError(w, &httpError{
+				status: http.StatusRequestEntityTooLarge,
+				msg:    fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit),
+			})
+		}
+		return writeError(w, badRequest("reading request body: %v", err))
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return writeError(w, badRequest("invalid request body: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.timeout)
+	defer cancel()
+
+	resp, err := fn(ctx, &req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			s.metrics.timeout()
+			err = &httpError{status: http.StatusServiceUnavailable, msg: "evaluation timed out"}
+		}
+		return writeError(w, err)
+	}
+	return writeResponse(w, http.StatusOK, resp)
+}
+
+func (s *server) match(ctx context.Context, req *request) (bson.D, error) {
+	query, err := compileQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseDocument(req.Doc, "doc")
+	if err != nil {
+		return nil, err
+	}
+	matched, err := query.MatchContext(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	s.metrics.evaluated(1)
+	return bson.D{{Key: "match", Value: matched}}, nil
+}
+
+func (s *server) filter(ctx context.Context, req *request) (bson.D, error) {
+	query, err := compileQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	// Documents are matched in place and echoed as they were sent, so
+	// their fields keep their order
+	docs, err := parseRawDocuments(req.Docs, "docs")
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty query selects every document, as in MongoDB's find
+	matchAll := len(query.Filter()) == 0
+	out := []bson.Raw{}
+	for i, doc := range docs {
+		matched, err := matchAll, ctx.Err()
+		if err == nil && !matchAll {
+			matched, err = query.MatchContext(ctx, doc)
+		}
+		if err != nil {
+			s.metrics.evaluated(i)
+			return nil, err
+		}
+		if matched {
+			out = append(out, doc)
+		}
+	}
+	s.metrics.evaluated(len(docs))
+	return bson.D{{Key: "docs", Value: out}, {Key: "count", Value: len(out)}}, nil
+}
+
+func (s *server) validate(_ context.Context, req *request) (bson.D, error) {
+	if len(req.Query) == 0 {
+		return nil, badRequest("missing query")
+	}
+	filter, err := mangomatch.ParseExtJSON(req.Query)
+	if err == nil {
+		_, err = mangomatch.Compile(filter)
+	}
+	if err != nil {
+		return bson.D{{Key: "valid", Value: false}, {Key: "error", Value: err.Error()}}, nil
+	}
+	return bson.D{{Key: "valid", Value: true}}, nil
+}
+
+func (s *server) aggregate(ctx context.Context, req *request) (bson.D, error) {
+	if len(req.Pipeline) == 0 {
+		return nil, badRequest("missing pipeline")
+	}
+	pipeline, err := mangomatch.ParsePipeline(req.Pipeline)
+	if err != nil {
+		return nil, badRequest("invalid pipeline: %v", err)
+	}
+	docs, err := parseDocuments(req.Docs, "docs")
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := mangomatch.AggregateContext(ctx, docs, pipeline)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, badRequest("%v", err)
+	}
+	s.metrics.evaluated(len(docs))
+	if out == nil {
+		out = []map[string]interface{}{}
+	}
+	return bson.D{{Key: "docs", Value: out}}, nil
+}
+
+func compileQuery(raw json.RawMessage) (*mangomatch.Query, error) {
+	filter, err := parseDocument(raw, "query")
+	if err != nil {
+		return nil, err
+	}
+	query, err := mangomatch.Compile(filter)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return query, nil
+}
+
+func parseDocument(raw json.RawMessage, name string) (map[string]interface{}, error) {
+	if len(raw) == 0 {
+		return nil, badRequest("missing %s", name)
+	}
+	doc, err := mangomatch.ParseExtJSON(raw)
+	if err != nil {
+		return nil, badRequest("invalid %s: %v", name, err)
+	}
+	return doc, nil
+}
+
+func parseDocuments(raw json.RawMessage, name string) ([]map[string]interface{}, error) {
+	if len(raw) == 0 {
+		return nil, badRequest("missing %s", name)
+	}
+	// Extended JSON must be a document at the top level, so wrap the array
+	wrapped, err := mangomatch.ParseExtJSON([]byte(`{"v":` + string(raw) + `}`))
+	if err != nil {
+		return nil, badRequest("invalid %s: %v", name, err)
+	}
+	items, ok := wrapped["v"].([]interface{})
+	if !ok {
+		return nil, badRequest("%s must be an array of documents", name)
+	}
+
+	docs := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		if docs[i], ok = item.(map[string]interface{}); !ok {
+			return nil, badRequest("%s[%d] must be a document", name, i)
+		}
+	}
+	return docs, nil
+}
+
+// parseRawDocuments is parseDocuments returning each document as BSON,
+// which keeps the order of its fields
+func parseRawDocuments(raw json.RawMessage, name string) ([]bson.Raw, error) {
+	if len(raw) == 0 {
+		return nil, badRequest("missing %s", name)
+	}
+	var wrapped bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(`{"v":`+string(raw)+`}`), false, &wrapped); err != nil {
+		return nil, badRequest("invalid %s: %v", name, err)
+	}
+	array, ok := wrapped.Lookup("v").ArrayOK()
+	if !ok {
+		return nil, badRequest("%s must be an array of documents", name)
+	}
+	values, err := array.Values()
+	if err != nil {
+		return nil, badRequest("invalid %s: %v", name, err)
+	}
+
+	docs := make([]bson.Raw, len(values))
+	for i, value := range values {
+		if docs[i], ok = value.DocumentOK(); !ok {
+			return nil, badRequest("%s[%d] must be a document", name, i)
+		}
+	}
+	return docs, nil
+}
+
+func writeError(w http.ResponseWriter, err error) int {
+	status := http.StatusBadRequest
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+	return writeResponse(w, status, bson.D{{Key: "error", Value: err.Error()}})
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp bson.D) int {
+	body, err := bson.MarshalExtJSON(resp, false, false)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body = []byte(`{"error":"encoding response failed"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+	return status
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testServer(t *testing.T, cfg config) *httptest.Server {
+	t.Helper()
+	if cfg.maxBodyBytes == 0 {
+		cfg.maxBodyBytes = 1 << 20
+	}
+	if cfg.timeout == 0 {
+		cfg.timeout = time.Second
+	}
+	ts := httptest.NewServer(newServer(cfg))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, ts *httptest.Server, path, body string) (int, string) {
+	t.Helper()
+	resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(out))
+}
+
+func TestServerEndpoints(t *testing.T) {
+	ts := testServer(t, config{})
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{
+			name:       "match",
+			path:       "/match",
+			body:       `{"query": {"age": {"$gt": 30}}, "doc": {"age": 35}}`,
+			wantStatus: http.StatusOK,
+			want:       `{"match":true}`,
+		},
+		{
+			name:       "match with extended json dates",
+			path:       "/match",
+			body:       `{"query": {"at": {"$lt": {"$date": "2025-01-01T00:00:00Z"}}}, "doc": {"at": {"$date": "2024-06-01T00:00:00Z"}}}`,
+			wantStatus: http.StatusOK,
+			want:       `{"match":true}`,
+		},
+		{
+			name:       "no match",
+			path:       "/match",
+			body:       `{"query": {"age": {"$gt": 30}}, "doc": {"age": 25}}`,
+			wantStatus: http.StatusOK,
+			want:       `{"match":false}`,
+		},
+		{
+			name:       "filter",
+			path:       "/filter",
+			body:       `{"query": {"status": "active"}, "docs": [{"n": 1, "status": "active"}, {"n": 2, "status": "inactive"}]}`,
+			wantStatus: http.StatusOK,
+			want:       `{"docs":[{"n":1,"status":"active"}],"count":1}`,
+		},
+		{
+			name:       "filter keeps dates typed",
+			path:       "/filter",
+			body:       `{"query": {}, "docs": [{"at": {"$date": "2024-06-01T00:00:00Z"}}]}`,
+			wantStatus: http.StatusOK,
+			want:       `{"docs":[{"at":{"$date":"2024-06-01T00:00:00Z"}}],"count":1}`,
+		},
+		{
+			name:       "filter on dates",
+			path:       "/filter",
+			body:       `{"query": {"at": {"$lt": {"$date": "2025-01-01T00:00:00Z"}}}, "docs": [{"at": {"$date": "2024-06-01T00:00:00Z"}}, {"at": {"$date": "2025-06-01T00:00:00Z"}}]}`,
+			wantStatus: http.StatusOK,
+			want:       `{"docs":[{"at":{"$date":"2024-06-01T00:00:00Z"}}],"count":1}`,
+		},
+		{
+			name:       "filter keeps field order",
+			path:       "/filter",
+			body:       `{"query": {"a": 2}, "docs": [{"z": 1, "a": 2, "m": 3, "b": {"y": 1, "x": 2}}]}`,
+			wantStatus: http.StatusOK,
+			want:       `{"docs":[{"z":1,"a":2,"m":3,"b":{"y":1,"x":2}}],"count":1}`,
+		},
+		{
+			name:       "validate",
+			path:       "/validate",
+			body:       `{"query": {"age": {"$gt": 30}}}`,
+			wantStatus: http.StatusOK,
+			want:       `{"valid":true}`,
+		},
+		{
+			name:       "validate unknown operator",
+			path:       "/validate",
+			body:       `{"query": {"age": {"$near": 30}}}`,
+			wantStatus: http.StatusOK,
+			want:       `{"valid":false,"error":"mangomatch: invalid query: field \"age\": unknown operator $near"}`,
+		},
+		{
+			name:       "aggregate",
+			path:       "/aggregate",
+			body:       `{"pipeline": [{"$match": {"qty": {"$gt": 1}}}, {"$sort": {"qty": -1}}, {"$project": {"qty": 1, "_id": 0}}], "docs": [{"qty": 1}, {"qty": 5}, {"qty": 3}]}`,
+			wantStatus: http.StatusOK,
+			want:       `{"docs":[{"qty":5},{"qty":3}]}`,
+		},
+		{
+			name:       "aggregate with no output",
+			path:       "/aggregate",
+			body:       `{"pipeline": [{"$count": "n"}], "docs": []}`,
+			wantStatus: http.StatusOK,
+			want:       `{"docs":[]}`,
+		},
+		{
+			name:       "invalid query",
+			path:       "/match",
+			body:       `{"query": {"age": {"$near": 30}}, "doc": {}}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"mangomatch: invalid query: field \"age\": unknown operator $near"}`,
+		},
+		{
+			name:       "missing doc",
+			path:       "/match",
+			body:       `{"query": {}}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"missing doc"}`,
+		},
+		{
+			name:       "docs not documents",
+			path:       "/filter",
+			body:       `{"query": {}, "docs": [1]}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"docs[0] must be a document"}`,
+		},
+		{
+			name:       "docs not an array",
+			path:       "/filter",
+			body:       `{"query": {}, "docs": {"a": 1}}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"docs must be an array of documents"}`,
+		},
+		{
+			name:       "invalid pipeline stage",
+			path:       "/aggregate",
+			body:       `{"pipeline": [{"$lookup": {}}], "docs": []}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"mangomatch: pipeline stage 0: unsupported stage $lookup"}`,
+		},
+		{
+			name:       "malformed body",
+			path:       "/match",
+			body:       `{"query":`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":"invalid request body: unexpected end of JSON input"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := post(t, ts, tt.path, tt.body)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if body != tt.want {
+				t.Errorf("body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	ts := testServer(t, config{maxBodyBytes: 64})
+	status, body := post(t, ts, "/filter", `{"query": {}, "docs": [`+strings.Repeat(`{"a": 1},`, 20)+`{}]}`)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413 (%s)", status, body)
+	}
+
+	resp, err := http.Get(ts.URL + "/match")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /match status = %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestServerTimeout(t *testing.T) {
+	ts := testServer(t, config{timeout: time.Nanosecond})
+	for _, path := range []string{"/match", "/filter", "/aggregate"} {
+		status, body := post(t, ts, path, `{"query": {"a": 1}, "pipeline": [{"$match": {"a": 1}}], "doc": {"a": 1}, "docs": [{"a": 1}]}`)
+		if status != http.StatusServiceUnavailable || body != `{"error":"evaluation timed out"}` {
+			t.Errorf("%s: got %d %s, want 503", path, status, body)
+		}
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	ts := testServer(t, config{})
+	post(t, ts, "/match", `{"query": {"a": 1}, "doc": {"a": 1}}`)
+	post(t, ts, "/filter", `{"query": {"a": 1}, "docs": [{"a": 1}, {"a": 2}]}`)
+	post(t, ts, "/match", `{}`)
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(resp.Body)
+	text := string(out)
+
+	for _, want := range []string{
+		`mangomatch_requests_total{endpoint="/match",code="200"} 1`,
+		`mangomatch_requests_total{endpoint="/match",code="400"} 1`,
+		`mangomatch_requests_total{endpoint="/filter",code="200"} 1`,
+		`mangomatch_request_duration_seconds_count{endpoint="/match"} 2`,
+		`mangomatch_documents_evaluated_total 3`,
+		`mangomatch_timeouts_total 0`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics missing %q:\n%s", want, text)
+		}
+	}
+}
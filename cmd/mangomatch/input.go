@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// record is one input document along with the text printed when it is selected
+type record struct {
+	doc    map[string]interface{}
+	text   []byte
+	header []string
+}
+
+// formatFromName picks the input format from a file extension, falling back
+// to JSON, which also reads NDJSON since it accepts concatenated documents
+func formatFromName(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".bson":
+		return "bson"
+	case ".csv":
+		return "csv"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	default:
+		return "json"
+	}
+}
+
+func readRecords(r io.Reader, format string, fn func(record) error) error {
+	switch format {
+	case "json", "ndjson", "bson":
+		return readStream(r, mangomatch.Format(format), fn)
+	case "csv":
+		return readCSV(r, fn)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// readStream decodes every document of r. NDJSON lines are printed
+// verbatim, JSON compacted and BSON as relaxed Extended JSON.
+func readStream(r io.Reader, format mangomatch.Format, fn func(record) error) error {
+	s, err := mangomatch.NewStream(r, format, nil)
+	if err != nil {
+		return err
+	}
+	for s.Next() {
+		var text []byte
+		switch format {
+		case mangomatch.FormatJSON:
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, s.Raw()); err != nil {
+				return err
+			}
+			text = compact.Bytes()
+		case mangomatch.FormatBSON:
+			if text, err = bson.MarshalExtJSON(bson.Raw(s.Raw()), false, false); err != nil {
+				return fmt.Errorf("offset %d: %v", s.Offset(), err)
+			}
+		default:
+			// Raw is reused by the next call to Next, and sorted output
+			// keeps records until the end
+			text = append([]byte(nil), s.Raw()...)
+		}
+		if err := fn(record{doc: s.Doc(), text: text}); err != nil {
+			return err
+		}
+	}
+
+	var serr *mangomatch.StreamError
+	if errors.As(s.Err(), &serr) {
+		// The file name is printed before the error, so the position is
+		// enough context
+		if serr.Line > 0 {
+			return fmt.Errorf("line %d: %v", serr.Line, serr.Err)
+		}
+		return fmt.Errorf("offset %d: %v", serr.Offset, serr.Err)
+	}
+	return s.Err()
+}
+
+// readCSV reads rows keyed by the header row. Cells that look like numbers
+// or booleans are typed so that range queries work; empty cells are null.
+func readCSV(r io.Reader, fn func(record) error) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return fmt.Errorf("line %d: %v", perr.Line, perr.Err)
+			}
+			return err
+		}
+
+		doc := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			doc[name] = csvValue(row[i])
+		}
+
+		var buf bytes.Buffer
+		if err := writeCSVRow(&buf, row); err != nil {
+			return err
+		}
+		if err := fn(record{doc: doc, text: buf.Bytes(), header: header}); err != nil {
+			return err
+		}
+	}
+}
+
+// csvValue types a cell the way JSON would read it: numbers, true and false.
+// Anything else, such as "T" or "NaN", stays a string.
+func csvValue(cell string) interface{} {
+	switch cell {
+	case "":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.Atoi(cell); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(cell, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f
+	}
+	return cell
+}
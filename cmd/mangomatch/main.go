@@ -0,0 +1,253 @@
+// Command mangomatch filters JSON, NDJSON, BSON and CSV records with a
+// MongoDB query, like grep for documents:
+//
+//	mangomatch '{"status":"active","age":{"$gt":30}}' < events.ndjson
+//	mangomatch -count '{"level":"error"}' logs.jsonl
+//	mangomatch -sort=-age -limit=10 -project='{"name":1}' '{}' dump.bson
+//
+// It exits with status 0 if any record matched, 1 if none did and 2 on error.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+type options struct {
+	format     string
+	count      bool
+	invert     bool
+	project    map[string]interface{}
+	sortFields []mangomatch.SortField
+	limit      int
+	explain    bool
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("mangomatch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: mangomatch [flags] QUERY [FILE...]")
+		fs.PrintDefaults()
+	}
+
+	var opts options
+	var project, sortSpec string
+	fs.StringVar(&opts.format, "format", "auto", "input format: auto, json, ndjson, bson or csv")
+	fs.BoolVar(&opts.count, "count", false, "print the number of matching records instead of the records")
+	fs.BoolVar(&opts.invert, "invert", false, "select records that do not match")
+	fs.StringVar(&project, "project", "", "projection applied to output records, e.g. '{\"name\":1}'")
+	fs.StringVar(&sortSpec, "sort", "", "sort output by fields, e.g. '-age,name'")
+	fs.IntVar(&opts.limit, "limit", 0, "stop after this many records (0 means no limit)")
+	fs.BoolVar(&opts.explain, "explain", false, "print how the query is evaluated and exit")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	filter, err := mangomatch.ParseExtJSON([]byte(fs.Arg(0)))
+	if err != nil {
+		fmt.Fprintf(stderr, "mangomatch: invalid query: %v\n", err)
+		return 2
+	}
+	query, err := mangomatch.Compile(filter)
+	if err != nil {
+		fmt.Fprintf(stderr, "mangomatch: %v\n", err)
+		return 2
+	}
+	if opts.explain {
+		fmt.Fprint(stdout, query.Explain())
+		return 0
+	}
+
+	if project != "" {
+		if opts.project, err = mangomatch.ParseExtJSON([]byte(project)); err != nil {
+			fmt.Fprintf(stderr, "mangomatch: invalid projection: %v\n", err)
+			return 2
+		}
+		if _, err := mangomatch.Project(map[string]interface{}{}, opts.project); err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 2
+		}
+	}
+	if sortSpec != "" {
+		if opts.sortFields, err = mangomatch.ParseSort(sortSpec); err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 2
+		}
+	}
+
+	files := fs.Args()[1:]
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	out := &output{w: stdout, opts: opts}
+	for _, name := range files {
+		if err := filterFile(name, stdin, query, out); err != nil {
+			if errors.Is(err, errLimitReached) {
+				break
+			}
+			fmt.Fprintf(stderr, "mangomatch: %s: %v\n", displayName(name), err)
+			return 2
+		}
+	}
+	if err := out.finish(); err != nil {
+		fmt.Fprintf(stderr, "mangomatch: %v\n", err)
+		return 2
+	}
+
+	if out.matched == 0 {
+		return 1
+	}
+	return 0
+}
+
+func displayName(name string) string {
+	if name == "-" {
+		return "<stdin>"
+	}
+	return name
+}
+
+func filterFile(name string, stdin io.Reader, query *mangomatch.Query, out *output) error {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	format := out.opts.format
+	if format == "auto" {
+		format = formatFromName(name)
+	}
+
+	// Unlike Match, an empty query selects every record, as in MongoDB
+	matchAll := len(query.Filter()) == 0
+
+	return readRecords(r, format, func(rec record) error {
+		if (matchAll || query.Match(rec.doc)) == out.opts.invert {
+			return nil
+		}
+		return out.add(rec)
+	})
+}
+
+// errLimitReached stops reading once -limit records have been written
+var errLimitReached = errors.New("limit reached")
+
+// output collects or streams the selected records
+type output struct {
+	w       io.Writer
+	opts    options
+	matched int
+	pending []record
+	header  []string
+}
+
+func (o *output) add(rec record) error {
+	o.matched++
+	switch {
+	case o.opts.count:
+	case len(o.opts.sortFields) > 0:
+		// Sorting needs every record before anything can be written
+		o.pending = append(o.pending, rec)
+		return nil
+	default:
+		if err := o.write(rec); err != nil {
+			return err
+		}
+	}
+	if o.opts.limit > 0 && o.matched >= o.opts.limit {
+		return errLimitReached
+	}
+	return nil
+}
+
+func (o *output) finish() error {
+	if o.opts.count {
+		_, err := fmt.Fprintln(o.w, o.matched)
+		return err
+	}
+	if len(o.pending) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(o.pending, func(i, j int) bool {
+		return mangomatch.CompareDocuments(o.pending[i].doc, o.pending[j].doc, o.opts.sortFields) < 0
+	})
+
+	for i, rec := range o.pending {
+		if o.opts.limit > 0 && i >= o.opts.limit {
+			break
+		}
+		if err := o.write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *output) write(rec record) error {
+	if o.opts.project != nil {
+		doc, err := mangomatch.Project(rec.doc, o.opts.project)
+		if err != nil {
+			return err
+		}
+		line, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(o.w, "%s\n", line)
+		return err
+	}
+
+	if rec.header != nil && !equalStrings(o.header, rec.header) {
+		o.header = rec.header
+		if err := writeCSVRow(o.w, rec.header); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(o.w, "%s\n", bytes.TrimRight(rec.text, "\r\n"))
+	return err
+}
+
+func writeCSVRow(w io.Writer, row []string) error {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+	cw.Flush()
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func equalStrings(a, b []string) bool {
+	return len(a) == len(b) && strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
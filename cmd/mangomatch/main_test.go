@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRun(t *testing.T) {
+	ndjson := `{"name":"alice","age":34,"status":"active"}
+{"name":"bob","age":25,"status":"active"}
+{"name":"carol","age":41,"status":"inactive"}
+`
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		want     string
+		wantCode int
+	}{
+		{
+			name:     "filter ndjson",
+			args:     []string{"-format=ndjson", `{"status":"active"}`},
+			stdin:    ndjson,
+			want:     "{\"name\":\"alice\",\"age\":34,\"status\":\"active\"}\n{\"name\":\"bob\",\"age\":25,\"status\":\"active\"}\n",
+			wantCode: 0,
+		},
+		{
+			name:     "no match",
+			args:     []string{"-format=ndjson", `{"age":{"$gt":100}}`},
+			stdin:    ndjson,
+			want:     "",
+			wantCode: 1,
+		},
+		{
+			name:     "count inverted",
+			args:     []string{"-format=ndjson", "-count", "-invert", `{"status":"active"}`},
+			stdin:    ndjson,
+			want:     "1\n",
+			wantCode: 0,
+		},
+		{
+			name:     "sort limit and project",
+			args:     []string{"-format=ndjson", "-sort=-age", "-limit=2", `-project={"name":1}`, `{}`},
+			stdin:    ndjson,
+			want:     "{\"name\":\"carol\"}\n{\"name\":\"alice\"}\n",
+			wantCode: 0,
+		},
+		{
+			name:     "json array",
+			args:     []string{`{"age":{"$lt":30}}`},
+			stdin:    `[{"name":"alice","age":34},{"name":"bob","age":25}]`,
+			want:     "{\"name\":\"bob\",\"age\":25}\n",
+			wantCode: 0,
+		},
+		{
+			name:     "csv keeps header",
+			args:     []string{"-format=csv", `{"age":{"$gte":30}}`},
+			stdin:    "name,age\nalice,34\nbob,25\ncarol,41\n",
+			want:     "name,age\nalice,34\ncarol,41\n",
+			wantCode: 0,
+		},
+		{
+			name:     "csv keeps letters that ParseBool would read",
+			args:     []string{"-format=csv", `{"code":{"$in":["T","f","TRUE"]},"ok":true}`},
+			stdin:    "code,ok\nT,true\nf,true\nTRUE,true\nt,false\n1,true\n",
+			want:     "code,ok\nT,true\nf,true\nTRUE,true\n",
+			wantCode: 0,
+		},
+		{
+			name:     "csv NaN stays a string",
+			args:     []string{"-format=csv", `{"n":"NaN"}`},
+			stdin:    "n\nNaN\n1.5\n",
+			want:     "n\nNaN\n",
+			wantCode: 0,
+		},
+		{
+			name:     "explain",
+			args:     []string{"-explain", `{"age":{"$gt":30}}`},
+			want:     "age $gt 30\n",
+			wantCode: 0,
+		},
+		{
+			name:     "invalid query",
+			args:     []string{`{"age":`},
+			wantCode: 2,
+		},
+		{
+			name:     "unknown operator",
+			args:     []string{`{"age":{"$near":1}}`},
+			wantCode: 2,
+		},
+		{
+			name:     "malformed input",
+			args:     []string{"-format=ndjson", `{}`},
+			stdin:    "{\"a\":1}\nnot json\n",
+			want:     "{\"a\":1}\n",
+			wantCode: 2,
+		},
+		{
+			name:     "missing query",
+			wantCode: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Errorf("run() = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunBSONFile(t *testing.T) {
+	var dump []byte
+	for _, doc := range []bson.M{{"n": "x", "v": int32(1)}, {"n": "y", "v": int64(7)}} {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dump = append(dump, raw...)
+	}
+	path := filepath.Join(t.TempDir(), "dump.bson")
+	if err := os.WriteFile(path, dump, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{`{"v":{"$gt":2}}`, path}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"n":"y"`) || strings.Contains(stdout.String(), `"n":"x"`) {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+}
@@ -0,0 +1,530 @@
+package mangomatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Aggregate runs docs through a MongoDB-style aggregation pipeline. Each
+// stage is a single-key document (map[string]interface{}, bson.M or bson.D).
+// The supported stages are $match, $project, $sort, $skip, $limit, $unwind,
+// $group and $count. The input documents are never modified.
+func Aggregate(docs []map[string]interface{}, pipeline []interface{}) ([]map[string]interface{}, error) {
+	return AggregateContext(context.Background(), docs, pipeline)
+}
+
+// AggregateContext is like Aggregate but stops with ctx.Err() once ctx is done
+func AggregateContext(ctx context.Context, docs []map[string]interface{}, pipeline []interface{}) ([]map[string]interface{}, error) {
+	stages := make([]stage, len(pipeline))
+	for i, raw := range pipeline {
+		s, err := parseStage(raw)
+		if err != nil {
+			return nil, fmt.Errorf("mangomatch: pipeline stage %d: %w", i, err)
+		}
+		stages[i] = s
+	}
+
+	current := docs
+	for i, s := range stages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		next, err := s.run(ctx, current)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, fmt.Errorf("mangomatch: pipeline stage %d (%s): %w", i, s.name, err)
+		}
+		current = next
+	}
+	if len(stages) == 0 {
+		current = append([]map[string]interface{}(nil), docs...)
+	}
+	return current, nil
+}
+
+// stage is one parsed pipeline stage
+type stage struct {
+	name string
+	run  func(ctx context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error)
+}
+
+func parseStage(raw interface{}) (stage, error) {
+	var name string
+	var spec interface{}
+	switch s := raw.(type) {
+	case bson.D:
+		if len(s) != 1 {
+			return stage{}, errors.New("a stage must have exactly one field")
+		}
+		name, spec = s[0].Key, s[0].Value
+	case map[string]interface{}, bson.M:
+		m, _ := s.(map[string]interface{})
+		if bm, ok := s.(bson.M); ok {
+			m = bm
+		}
+		if len(m) != 1 {
+			return stage{}, errors.New("a stage must have exactly one field")
+		}
+		for key, val := range m {
+			name, spec = key, val
+		}
+	default:
+		return stage{}, fmt.Errorf("a stage must be a document, got %T", raw)
+	}
+	// $sort keeps the order of its keys; everything else is read as plain maps
+	if name != "$sort" {
+		spec = ConvertBSON(spec)
+	}
+
+	var run func(ctx context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error)
+	var err error
+	switch name {
+	case "$match":
+		run, err = matchStage(spec)
+	case "$project":
+		run, err = projectStage(spec)
+	case "$sort":
+		run, err = sortStage(spec)
+	case "$skip":
+		run, err = skipStage(spec)
+	case "$limit":
+		run, err = limitStage(spec)
+	case "$unwind":
+		run, err = unwindStage(spec)
+	case "$group":
+		run, err = groupStage(spec)
+	case "$count":
+		run, err = countStage(spec)
+	default:
+		err = fmt.Errorf("unsupported stage %s", name)
+	}
+	if err != nil {
+		return stage{}, err
+	}
+	return stage{name: name, run: run}, nil
+}
+
+func matchStage(spec interface{}) (func(context.Context, []map[string]interface{}) ([]map[string]interface{}, error), error) {
+	q, err := Compile(spec)
+	if err != nil {
+		return nil, err
+	}
+	// An empty $match passes every document, as in MongoDB
+	matchAll := len(q.Filter()) == 0
+
+	return func(ctx context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+		var out []map[string]interface{}
+		for i, doc := range docs {
+			if i%256 == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			if matchAll || q.Match(doc) {
+				out = append(out, doc)
+			}
+		}
+		return out, nil
+	}, nil
+}
+
+func projectStage(spec interface{}) (func(context.Context, []map[string]interface{}) ([]map[string]interface{}, error), error) {
+	projection, ok := spec.(map[string]interface{})
+	if !ok || len(projection) == 0 {
+		return nil, errors.New("requires a non-empty document")
+	}
+	if _, err := projectionMode(projection); err != nil {
+		return nil, err
+	}
+
+	return func(_ context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+		out := make([]map[string]interface{}, len(docs))
+		for i, doc := range docs {
+			projected, err := Project(doc, projection)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = projected
+		}
+		return out, nil
+	}, nil
+}
+
+// sortStage accepts an ordered bson.D, a document with a single key, or a
+// ParseSort specification such as "-age,name"
+func sortStage(spec interface{}) (func(context.Context, []map[string]interface{}) ([]map[string]interface{}, error), error) {
+	var fields []SortField
+	switch s := spec.(type) {
+	case string:
+		var err error
+		if fields, err = ParseSort(s); err != nil {
+			return nil, err
+		}
+	case bson.D:
+		for _, elem := range s {
+			field, err := sortDirection(elem.Key, ConvertBSON(elem.Value))
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		}
+	default:
+		m, ok := ConvertBSON(spec).(map[string]interface{})
+		if !ok {
+			return nil, errors.New("requires a document")
+		}
+		if len(m) > 1 {
+			// Go maps are unordered, so the sort keys would be ambiguous
+			return nil, errors.New("with several keys requires an ordered bson.D")
+		}
+		for path, dir := range m {
+			field, err := sortDirection(path, dir)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("requires at least one field")
+	}
+
+	return func(_ context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+		out := append([]map[string]interface{}(nil), docs...)
+		SortDocuments(out, fields)
+		return out, nil
+	}, nil
+}
+
+func sortDirection(path string, dir interface{}) (SortField, error) {
+	switch toFloat(dir) {
+	case 1:
+		return SortField{Path: path}, nil
+	case -1:
+		return SortField{Path: path, Descending: true}, nil
+	}
+	return SortField{}, fmt.Errorf("direction for %q must be 1 or -1", path)
+}
+
+func skipStage(spec interface{}) (func(context.Context, []map[string]interface{}) ([]map[string]interface{}, error), error) {
+	n, err := stageCount(spec)
+	if err != nil {
+		return nil, err
+	}
+	return func(_ context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+		if n >= len(docs) {
+			return nil, nil
+		}
+		return docs[n:], nil
+	}, nil
+}
+
+func limitStage(spec interface{}) (func(context.Context, []map[string]interface{}) ([]map[string]interface{}, error), error) {
+	n, err := stageCount(spec)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.New("requires a positive number")
+	}
+	return func(_ context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+		if n >= len(docs) {
+			return docs, nil
+		}
+		return docs[:n:n], nil
+	}, nil
+}
+
+// stageCount reads the non-negative integer operand of $skip and $limit
+func stageCount(spec interface{}) (int, error) {
+	switch n := widenNumber(spec).(type) {
+	case int:
+		if n >= 0 {
+			return n, nil
+		}
+	case float64:
+		if n >= 0 && n == float64(int(n)) {
+			return int(n), nil
+		}
+	}
+	return 0, errors.New("requires a non-negative integer")
+}
+
+// unwindStage accepts "$path" or {"path": "$path", "preserveNullAndEmptyArrays": bool}
+func unwindStage(spec interface{}) (func(context.Context, []map[string]interface{}) ([]map[string]interface{}, error), error) {
+	path := spec
+	preserve := false
+	if opts, ok := spec.(map[string]interface{}); ok {
+		path = opts["path"]
+		if p, exists := opts["preserveNullAndEmptyArrays"]; exists {
+			if preserve, ok = p.(bool); !ok {
+				return nil, errors.New("preserveNullAndEmptyArrays must be a boolean")
+			}
+		}
+	}
+	fieldPath, ok := path.(string)
+	if !ok || !strings.HasPrefix(fieldPath, "$") || len(fieldPath) < 2 {
+		return nil, errors.New("requires a field path such as \"$tags\"")
+	}
+	parts := strings.Split(fieldPath[1:], ".")
+
+	return func(_ context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+		var out []map[string]interface{}
+		for _, doc := range docs {
+			val, exists := getNestedValue(doc, parts)
+			arr, isArray := val.([]interface{})
+			switch {
+			case isArray && len(arr) > 0:
+				for _, item := range arr {
+					out = append(out, withPath(doc, parts, item))
+				}
+			case isArray || !exists || val == nil:
+				if preserve {
+					out = append(out, doc)
+				}
+			default:
+				// A non-array value is treated as a single-element array
+				out = append(out, doc)
+			}
+		}
+		return out, nil
+	}, nil
+}
+
+// withPath returns a copy of doc with the value at parts replaced, copying
+// only the embedded documents along the path
+func withPath(doc map[string]interface{}, parts []string, value interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(doc))
+	for key, val := range doc {
+		out[key] = val
+	}
+	if len(parts) == 1 {
+		out[parts[0]] = value
+		return out
+	}
+	sub, _ := doc[parts[0]].(map[string]interface{})
+	out[parts[0]] = withPath(sub, parts[1:], value)
+	return out
+}
+
+func countStage(spec interface{}) (func(context.Context, []map[string]interface{}) ([]map[string]interface{}, error), error) {
+	name, ok := spec.(string)
+	if !ok || name == "" || strings.HasPrefix(name, "$") || strings.Contains(name, ".") {
+		return nil, errors.New("requires a field name")
+	}
+	return func(_ context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []map[string]interface{}{{name: len(docs)}}, nil
+	}, nil
+}
+
+// expressionValue evaluates a $group expression: "$path" reads a field and
+// documents are evaluated field by field; anything else is a constant
+func expressionValue(doc map[string]interface{}, expr interface{}) interface{} {
+	switch e := expr.(type) {
+	case string:
+		if strings.HasPrefix(e, "$") {
+			val, _ := getNestedValue(doc, strings.Split(e[1:], "."))
+			return val
+		}
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(e))
+		for key, val := range e {
+			out[key] = expressionValue(doc, val)
+		}
+		return out
+	}
+	return expr
+}
+
+// accumulator folds the values of one output field of a $group stage
+type accumulator struct {
+	op    string
+	expr  interface{}
+	value interface{}
+	sum   float64
+	count int
+	isInt bool
+}
+
+var accumulatorOps = map[string]bool{
+	"$sum": true, "$avg": true, "$min": true, "$max": true,
+	"$first": true, "$last": true, "$push": true, "$addToSet": true,
+}
+
+func (a *accumulator) add(doc map[string]interface{}) {
+	val := widenNumber(expressionValue(doc, a.expr))
+	switch a.op {
+	case "$sum", "$avg":
+		switch n := val.(type) {
+		case int:
+			a.sum += float64(n)
+			a.count++
+		case float64:
+			a.sum += n
+			a.isInt = false
+			a.count++
+		}
+	case "$min", "$max":
+		if val == nil {
+			return
+		}
+		c := compareValues(val, a.value)
+		if a.count == 0 || (a.op == "$min" && c < 0) || (a.op == "$max" && c > 0) {
+			a.value = val
+		}
+		a.count++
+	case "$first":
+		if a.count == 0 {
+			a.value = val
+		}
+		a.count++
+	case "$last":
+		a.value = val
+		a.count++
+	case "$push":
+		arr, _ := a.value.([]interface{})
+		a.value = append(arr, val)
+	case "$addToSet":
+		arr, _ := a.value.([]interface{})
+		for _, existing := range arr {
+			if groupKey(existing) == groupKey(val) {
+				return
+			}
+		}
+		a.value = append(arr, val)
+	}
+}
+
+func (a *accumulator) result() interface{} {
+	switch a.op {
+	case "$sum":
+		if a.isInt && a.sum == float64(int(a.sum)) {
+			return int(a.sum)
+		}
+		return a.sum
+	case "$avg":
+		if a.count == 0 {
+			return nil
+		}
+		return a.sum / float64(a.count)
+	case "$push", "$addToSet":
+		if a.value == nil {
+			return []interface{}{}
+		}
+	}
+	return a.value
+}
+
+// groupKey identifies equal _id values; numbers compare by value, so 1 and
+// 1.0 fall into the same group
+func groupKey(v interface{}) string {
+	switch n := widenNumber(v).(type) {
+	case int:
+		return fmt.Sprintf("number:%v", float64(n))
+	case float64:
+		return fmt.Sprintf("number:%v", n)
+	case map[string]interface{}:
+		var b strings.Builder
+		b.WriteString("{")
+		for _, key := range sortedKeys(n) {
+			fmt.Fprintf(&b, "%q:%s,", key, groupKey(n[key]))
+		}
+		b.WriteString("}")
+		return b.String()
+	case []interface{}:
+		var b strings.Builder
+		b.WriteString("[")
+		for _, item := range n {
+			b.WriteString(groupKey(item))
+			b.WriteString(",")
+		}
+		b.WriteString("]")
+		return b.String()
+	default:
+		return fmt.Sprintf("%T:%v", v, v)
+	}
+}
+
+// groupStage supports {"_id": <expression>, "<field>": {"<accumulator>": <expression>}}
+func groupStage(spec interface{}) (func(context.Context, []map[string]interface{}) ([]map[string]interface{}, error), error) {
+	fields, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("requires a document")
+	}
+	idExpr, ok := fields["_id"]
+	if !ok {
+		return nil, errors.New("requires an _id expression")
+	}
+
+	type output struct {
+		name string
+		op   string
+		expr interface{}
+	}
+	var outputs []output
+	for _, name := range sortedKeys(fields) {
+		if name == "_id" {
+			continue
+		}
+		acc, ok := fields[name].(map[string]interface{})
+		if !ok || len(acc) != 1 {
+			return nil, fmt.Errorf("field %q must be an accumulator such as {\"$sum\": 1}", name)
+		}
+		for op, expr := range acc {
+			if !accumulatorOps[op] {
+				return nil, fmt.Errorf("unknown accumulator %s", op)
+			}
+			outputs = append(outputs, output{name: name, op: op, expr: expr})
+		}
+	}
+
+	return func(ctx context.Context, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+		type group struct {
+			id   interface{}
+			accs []*accumulator
+		}
+		var order []*group
+		groups := make(map[string]*group)
+
+		for i, doc := range docs {
+			if i%256 == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			id := expressionValue(doc, idExpr)
+			key := groupKey(id)
+			g, exists := groups[key]
+			if !exists {
+				g = &group{id: id}
+				for _, o := range outputs {
+					g.accs = append(g.accs, &accumulator{op: o.op, expr: o.expr, isInt: true})
+				}
+				groups[key] = g
+				order = append(order, g)
+			}
+			for _, acc := range g.accs {
+				acc.add(doc)
+			}
+		}
+
+		out := make([]map[string]interface{}, len(order))
+		for i, g := range order {
+			doc := map[string]interface{}{"_id": g.id}
+			for j, o := range outputs {
+				doc[o.name] = g.accs[j].result()
+			}
+			out[i] = doc
+		}
+		return out, nil
+	}, nil
+}
@@ -0,0 +1,193 @@
+package mangomatch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func aggregateTestDocs() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"_id": 1, "item": "apple", "qty": 5, "price": 1.5, "tags": []interface{}{"fruit", "red"}},
+		{"_id": 2, "item": "banana", "qty": 10, "price": 0.5, "tags": []interface{}{"fruit"}},
+		{"_id": 3, "item": "carrot", "qty": 3, "price": 0.25, "tags": []interface{}{}},
+		{"_id": 4, "item": "apple", "qty": 7, "price": 1.75},
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline []interface{}
+		want     []map[string]interface{}
+	}{
+		{
+			name: "match sort project",
+			pipeline: []interface{}{
+				map[string]interface{}{"$match": map[string]interface{}{"qty": map[string]interface{}{"$gte": 5}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "item", Value: 1}, {Key: "qty", Value: -1}}}},
+				map[string]interface{}{"$project": map[string]interface{}{"item": 1, "qty": 1, "_id": 0}},
+			},
+			want: []map[string]interface{}{
+				{"item": "apple", "qty": 7},
+				{"item": "apple", "qty": 5},
+				{"item": "banana", "qty": 10},
+			},
+		},
+		{
+			name: "skip and limit",
+			pipeline: []interface{}{
+				map[string]interface{}{"$sort": map[string]interface{}{"qty": -1}},
+				map[string]interface{}{"$skip": 1},
+				map[string]interface{}{"$limit": 2.0},
+				map[string]interface{}{"$project": map[string]interface{}{"_id": 1}},
+			},
+			want: []map[string]interface{}{{"_id": 4}, {"_id": 1}},
+		},
+		{
+			name: "unwind and count",
+			pipeline: []interface{}{
+				map[string]interface{}{"$unwind": "$tags"},
+				map[string]interface{}{"$match": map[string]interface{}{"tags": "fruit"}},
+				map[string]interface{}{"$count": "fruits"},
+			},
+			want: []map[string]interface{}{{"fruits": 2}},
+		},
+		{
+			name: "unwind preserving empty arrays",
+			pipeline: []interface{}{
+				map[string]interface{}{"$unwind": map[string]interface{}{"path": "$tags", "preserveNullAndEmptyArrays": true}},
+				map[string]interface{}{"$count": "n"},
+			},
+			want: []map[string]interface{}{{"n": 5}},
+		},
+		{
+			name: "group",
+			pipeline: []interface{}{
+				map[string]interface{}{"$group": map[string]interface{}{
+					"_id":    "$item",
+					"total":  map[string]interface{}{"$sum": "$qty"},
+					"orders": map[string]interface{}{"$sum": 1},
+					"avg":    map[string]interface{}{"$avg": "$price"},
+					"ids":    map[string]interface{}{"$push": "$_id"},
+					"max":    map[string]interface{}{"$max": "$qty"},
+				}},
+				map[string]interface{}{"$sort": "_id"},
+			},
+			want: []map[string]interface{}{
+				{"_id": "apple", "total": 12, "orders": 2, "avg": 1.625, "ids": []interface{}{1, 4}, "max": 7},
+				{"_id": "banana", "total": 10, "orders": 1, "avg": 0.5, "ids": []interface{}{2}, "max": 10},
+				{"_id": "carrot", "total": 3, "orders": 1, "avg": 0.25, "ids": []interface{}{3}, "max": 3},
+			},
+		},
+		{
+			name: "group everything",
+			pipeline: []interface{}{
+				map[string]interface{}{"$group": map[string]interface{}{
+					"_id":   nil,
+					"value": map[string]interface{}{"$sum": "$price"},
+					"items": map[string]interface{}{"$addToSet": "$item"},
+				}},
+			},
+			want: []map[string]interface{}{
+				{"_id": nil, "value": 4.0, "items": []interface{}{"apple", "banana", "carrot"}},
+			},
+		},
+		{
+			name: "empty match keeps everything",
+			pipeline: []interface{}{
+				map[string]interface{}{"$match": map[string]interface{}{}},
+				map[string]interface{}{"$count": "n"},
+			},
+			want: []map[string]interface{}{{"n": 4}},
+		},
+		{
+			name: "count of nothing",
+			pipeline: []interface{}{
+				map[string]interface{}{"$match": map[string]interface{}{"qty": 100}},
+				map[string]interface{}{"$count": "n"},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := aggregateTestDocs()
+			got, err := Aggregate(docs, tt.pipeline)
+			if err != nil {
+				t.Fatalf("Aggregate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Aggregate() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(docs, aggregateTestDocs()) {
+				t.Error("Expected Aggregate not to modify its input")
+			}
+		})
+	}
+}
+
+func TestAggregateInvalid(t *testing.T) {
+	pipelines := [][]interface{}{
+		{map[string]interface{}{"$lookup": map[string]interface{}{}}},
+		{map[string]interface{}{"$match": map[string]interface{}{"a": map[string]interface{}{"$bad": 1}}}},
+		{map[string]interface{}{"$sort": map[string]interface{}{"a": 1, "b": 1}}},
+		{map[string]interface{}{"$sort": map[string]interface{}{"a": 2}}},
+		{map[string]interface{}{"$limit": -1}},
+		{map[string]interface{}{"$unwind": "tags"}},
+		{map[string]interface{}{"$group": map[string]interface{}{"n": map[string]interface{}{"$sum": 1}}}},
+		{map[string]interface{}{"$group": map[string]interface{}{"_id": nil, "n": map[string]interface{}{"$median": 1}}}},
+		{map[string]interface{}{"$match": map[string]interface{}{}, "$limit": 1}},
+		{"$match"},
+	}
+	for _, pipeline := range pipelines {
+		if _, err := Aggregate(aggregateTestDocs(), pipeline); err == nil {
+			t.Errorf("Expected Aggregate(%v) to fail", pipeline)
+		}
+	}
+}
+
+func TestAggregateContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := AggregateContext(ctx, aggregateTestDocs(), []interface{}{
+		map[string]interface{}{"$match": map[string]interface{}{"qty": 5}},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestParsePipeline(t *testing.T) {
+	pipeline, err := ParsePipeline([]byte(`[
+		{"$match": {"qty": {"$gt": {"$numberInt": "4"}}}},
+		{"$sort": {"item": -1, "qty": 1}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sortSpec := pipeline[1].(map[string]interface{})["$sort"]
+	if want := (bson.D{{Key: "item", Value: -1}, {Key: "qty", Value: 1}}); !reflect.DeepEqual(sortSpec, want) {
+		t.Errorf("Expected $sort to keep its key order, got %v", sortSpec)
+	}
+
+	got, err := Aggregate(aggregateTestDocs(), pipeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0]["item"] != "banana" || got[1]["qty"] != 5 || got[2]["qty"] != 7 {
+		t.Errorf("unexpected result %v", got)
+	}
+
+	for _, input := range []string{`{"$match": {}}`, `[1]`, `[`} {
+		if _, err := ParsePipeline([]byte(input)); err == nil {
+			t.Errorf("Expected ParsePipeline(%q) to fail", input)
+		}
+	}
+}
@@ -62,12 +62,12 @@ func MatchBSON(query, doc interface{}) bool {
 		return false
 	}
 
-	goDoc, ok := ConvertBSON(doc).(map[string]interface{})
+	goDoc, ok := AsDocument(doc)
 	if !ok {
 		return false
 	}
 
-	return Match(goQuery, goDoc)
+	return MatchDocument(goQuery, goDoc)
 }
 
 func StructToBsonMap(data interface{}) (map[string]interface{}, error) {
@@ -78,4 +78,4 @@ func StructToBsonMap(data interface{}) (map[string]interface{}, error) {
 	var out map[string]interface{}
 	err = bson.Unmarshal(bsonBytes, &out)
 	return out, err
-}
\ No newline at end of file
+}
@@ -0,0 +1,197 @@
+package mangomatch
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation selects locale-aware string comparison, with the fields of
+// MongoDB's collation document. Locale "simple" compares strings bytewise.
+type Collation struct {
+	// Locale is an ICU locale such as "fr" or "tr", or "simple"
+	Locale string `json:"locale"`
+	// Strength is the level of comparison from 1 to 5: 1 compares base
+	// letters only, 2 also accents and 3, the default, also case. 4 is the
+	// same as 3, and 5 breaks the remaining ties by code point.
+	Strength int `json:"strength,omitempty"`
+	// CaseLevel compares case at strengths 1 and 2
+	CaseLevel bool `json:"caseLevel,omitempty"`
+	// NumericOrdering compares digit sequences as numbers, so "10" sorts
+	// after "9"
+	NumericOrdering bool `json:"numericOrdering,omitempty"`
+}
+
+// Collator compares strings under a Collation. It is safe for concurrent
+// use.
+type Collator struct {
+	collation Collation
+	simple    bool
+	caseLevel bool
+	identical bool
+	// collate.Collator keeps state between calls, so each goroutine takes
+	// its own from the pool
+	pool sync.Pool
+}
+
+// NewCollator validates c and returns its Collator
+func NewCollator(c Collation) (*Collator, error) {
+	if c.Strength == 0 {
+		c.Strength = 3
+	}
+	if c.Strength < 1 || c.Strength > 5 {
+		return nil, fmt.Errorf("mangomatch: collation strength must be between 1 and 5, got %d", c.Strength)
+	}
+	if c.Locale == "" {
+		return nil, errors.New("mangomatch: collation requires a locale")
+	}
+	if c.Locale == "simple" {
+		return &Collator{collation: c, simple: true}, nil
+	}
+	// MongoDB writes locales the ICU way, as in "fr_CA"
+	tag, err := language.Parse(strings.ReplaceAll(c.Locale, "_", "-"))
+	if err != nil {
+		return nil, fmt.Errorf("mangomatch: collation locale %q: %v", c.Locale, err)
+	}
+
+	var opts []collate.Option
+	if c.Strength <= 2 {
+		opts = append(opts, collate.IgnoreWidth, collate.IgnoreCase)
+	}
+	if c.Strength == 1 {
+		opts = append(opts, collate.IgnoreDiacritics)
+	}
+	if c.NumericOrdering {
+		opts = append(opts, collate.Numeric)
+	}
+
+	col := &Collator{collation: c, caseLevel: c.CaseLevel && c.Strength <= 2, identical: c.Strength == 5}
+	col.pool.New = func() interface{} {
+		return collate.New(tag, opts...)
+	}
+	return col, nil
+}
+
+// Collation returns the collation c was created with
+func (c *Collator) Collation() Collation {
+	return c.collation
+}
+
+// Compare returns -1, 0 or 1 depending on whether a sorts before, together
+// with or after b
+func (c *Collator) Compare(a, b string) int {
+	return strings.Compare(c.key(a), c.key(b))
+}
+
+// key returns a string whose bytewise order is the collation order of s, so
+// the comparisons that work on plain strings can use it unchanged. A nil or
+// simple collator returns s.
+func (c *Collator) key(s string) string {
+	if c == nil || c.simple {
+		return s
+	}
+	col := c.pool.Get().(*collate.Collator)
+	var buf collate.Buffer
+	key := string(col.KeyFromString(&buf, s))
+	c.pool.Put(col)
+	// Keys end with nonzero weights, so a separator sorts a key before any
+	// longer key it is a prefix of, and what follows it only breaks ties
+	if c.caseLevel {
+		key += "\x00" + caseKey(s)
+	}
+	if c.identical {
+		key += "\x00" + s
+	}
+	return key
+}
+
+// caseKey orders strings that differ only in case, lowercase first
+func caseKey(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			sb.WriteByte(2)
+		case unicode.IsLetter(r):
+			sb.WriteByte(1)
+		}
+	}
+	return sb.String()
+}
+
+// keys replaces the strings in v, including those in arrays, by their keys.
+// Embedded documents are left alone since they are not compared by value.
+func (c *Collator) keys(v interface{}) interface{} {
+	if c == nil || c.simple {
+		return v
+	}
+	switch val := v.(type) {
+	case string:
+		return c.key(val)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = c.keys(item)
+		}
+		return out
+	}
+	return v
+}
+
+// collatedOperators compare strings, so they compare collation keys when
+// a query has a collation
+var collatedOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true, "$in": true, "$nin": true,
+}
+
+// collate builds a predicate with build from the keys of operand that
+// evaluates the keys of the values it is given
+func (c *Collator) collate(operand interface{}, build func(operand interface{}) (Predicate, error)) (Predicate, error) {
+	if c == nil || c.simple {
+		return build(operand)
+	}
+	pred, err := build(c.keys(operand))
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}) bool {
+		return pred(c.keys(value))
+	}, nil
+}
+
+// WithCollation returns a copy of q that compares strings under c in
+// equality, $in, $nin, $all and range conditions. $regex still matches the
+// original strings.
+func (q *Query) WithCollation(c Collation) (*Query, error) {
+	col, err := NewCollator(c)
+	if err != nil {
+		return nil, err
+	}
+	e := q.engine.withCollator(col)
+	if err := e.validateQuery(q.filter); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	clone := *q
+	clone.engine = e
+	clone.match = e.compileMatcher(q.filter)
+	return &clone, nil
+}
+
+// SortDocuments is SortDocuments with strings compared under the collation
+func (c *Collator) SortDocuments(docs []map[string]interface{}, fields []SortField) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return c.CompareDocuments(docs[i], docs[j], fields) < 0
+	})
+}
+
+// CompareDocuments is CompareDocuments with strings compared under the
+// collation
+func (c *Collator) CompareDocuments(a, b map[string]interface{}, fields []SortField) int {
+	return compareDocuments(a, b, fields, c)
+}
@@ -0,0 +1,200 @@
+package mangomatch
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCollatorCompare(t *testing.T) {
+	tests := []struct {
+		name      string
+		collation Collation
+		a, b      string
+		want      int
+	}{
+		{name: "Simple is bytewise", collation: Collation{Locale: "simple"}, a: "B", b: "a", want: -1},
+		{name: "Locale order", collation: Collation{Locale: "en"}, a: "B", b: "a", want: 1},
+		{name: "Strength 3 compares case", collation: Collation{Locale: "fr"}, a: "Cote", b: "cote", want: 1},
+		{name: "Strength 2 ignores case", collation: Collation{Locale: "fr", Strength: 2}, a: "Côte", b: "côte", want: 0},
+		{name: "Strength 2 compares accents", collation: Collation{Locale: "fr", Strength: 2}, a: "côte", b: "cote", want: 1},
+		{name: "Strength 1 ignores accents", collation: Collation{Locale: "fr", Strength: 1}, a: "Côté", b: "cote", want: 0},
+		{name: "Strength 1 compares letters", collation: Collation{Locale: "fr", Strength: 1}, a: "cote", b: "cotf", want: -1},
+		{name: "Case level at strength 1", collation: Collation{Locale: "fr", Strength: 1, CaseLevel: true}, a: "Côté", b: "cote", want: 1},
+		{name: "Case level ignores accents", collation: Collation{Locale: "fr", Strength: 1, CaseLevel: true}, a: "côté", b: "cote", want: 0},
+		{name: "Turkish dotless I", collation: Collation{Locale: "tr", Strength: 2}, a: "I", b: "ı", want: 0},
+		{name: "Turkish dotted I", collation: Collation{Locale: "tr", Strength: 2}, a: "İstanbul", b: "istanbul", want: 0},
+		{name: "Turkish I is not i", collation: Collation{Locale: "tr", Strength: 2}, a: "I", b: "i", want: -1},
+		{name: "English I is i", collation: Collation{Locale: "en", Strength: 2}, a: "I", b: "i", want: 0},
+		{name: "ICU locale", collation: Collation{Locale: "fr_CA", Strength: 1}, a: "É", b: "e", want: 0},
+		{name: "Numeric ordering", collation: Collation{Locale: "en", NumericOrdering: true}, a: "item10", b: "item9", want: 1},
+		{name: "No numeric ordering", collation: Collation{Locale: "en"}, a: "item10", b: "item9", want: -1},
+		{name: "Strength 3 equates normalization forms", collation: Collation{Locale: "en"}, a: "\u00e9", b: "e\u0301", want: 0},
+		{name: "Strength 5 breaks ties", collation: Collation{Locale: "en", Strength: 5}, a: "\u00e9", b: "e\u0301", want: 1},
+		{name: "Strength 5 keeps the collation order", collation: Collation{Locale: "en", Strength: 5}, a: "a", b: "B", want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCollator(tt.collation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Compare(tt.a, tt.b); got != tt.want {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCollatorErrors(t *testing.T) {
+	for _, c := range []Collation{
+		{},
+		{Locale: "en", Strength: 6},
+		{Locale: "en", Strength: -1},
+		{Locale: "not a locale"},
+	} {
+		if _, err := NewCollator(c); err == nil {
+			t.Errorf("NewCollator(%+v) succeeded, want an error", c)
+		}
+	}
+}
+
+func TestQueryWithCollation(t *testing.T) {
+	doc := map[string]interface{}{
+		"name": "Élodie",
+		"city": "İzmir",
+		"tags": []interface{}{"Rouge", "vert"},
+		"code": "item10",
+		"items": []interface{}{
+			map[string]interface{}{"sku": "ÀB"},
+		},
+	}
+	collation := Collation{Locale: "fr", Strength: 1}
+
+	tests := []struct {
+		name      string
+		query     string
+		collation Collation
+		want      bool
+	}{
+		{name: "Implicit equality", query: `{"name": "elodie"}`, want: true},
+		{name: "$eq", query: `{"name": {"$eq": "ELODIE"}}`, want: true},
+		{name: "$ne", query: `{"name": {"$ne": "elodie"}}`, want: false},
+		{name: "$in", query: `{"name": {"$in": ["x", "élodie"]}}`, want: true},
+		{name: "$nin", query: `{"name": {"$nin": ["ELODIE"]}}`, want: false},
+		{name: "Array element", query: `{"tags": "rouge"}`, want: true},
+		{name: "$all", query: `{"tags": {"$all": ["VERT", "rouge"]}}`, want: true},
+		{name: "Range", query: `{"name": {"$gte": "e", "$lt": "f"}}`, want: true},
+		{name: "$not", query: `{"name": {"$not": {"$eq": "elodie"}}}`, want: false},
+		{name: "$elemMatch operators", query: `{"tags": {"$elemMatch": {"$eq": "VERT"}}}`, want: true},
+		{name: "$elemMatch query", query: `{"items": {"$elemMatch": {"sku": "ab"}}}`, want: true},
+		{name: "$all with $elemMatch", query: `{"items": {"$all": [{"$elemMatch": {"sku": {"$in": ["ab"]}}}]}}`, want: true},
+		{name: "$or", query: `{"$or": [{"name": "x"}, {"name": "ÉLODIE"}]}`, want: true},
+		{name: "$regex matches the original string", query: `{"name": {"$regex": "^É"}}`, want: true},
+		{name: "$regex is not collated", query: `{"name": {"$regex": "^e"}}`, want: false},
+		{name: "Different string", query: `{"name": "elodia"}`, want: false},
+		{name: "Turkish", query: `{"city": "izmir"}`, collation: Collation{Locale: "tr", Strength: 2}, want: true},
+		{name: "Turkish dotless i", query: `{"city": "ızmir"}`, collation: Collation{Locale: "tr", Strength: 2}, want: false},
+		{name: "Numeric range", query: `{"code": {"$gt": "item9"}}`, collation: Collation{Locale: "en", NumericOrdering: true}, want: true},
+		{name: "Simple", query: `{"name": "elodie"}`, collation: Collation{Locale: "simple"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.collation
+			if c.Locale == "" {
+				c = collation
+			}
+			q := MustCompile(parseQuery(t, tt.query))
+			collated, err := q.WithCollation(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := collated.Match(doc); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	q := MustCompile(map[string]interface{}{"name": "elodie"})
+	if _, err := q.WithCollation(collation); err != nil {
+		t.Fatal(err)
+	}
+	if q.Match(doc) {
+		t.Error("WithCollation() changed the original query")
+	}
+	if _, err := q.WithCollation(Collation{Locale: "en", Strength: 9}); err == nil {
+		t.Error("Expected an error for an invalid collation")
+	}
+}
+
+func TestQueryWithCollationCustomOperator(t *testing.T) {
+	e := NewEngine()
+	e.RegisterOperator("$len", func(operand interface{}) (Predicate, error) {
+		return func(value interface{}) bool {
+			s, _ := value.(string)
+			return len(s) == operand
+		}, nil
+	})
+	q, err := e.Compile(map[string]interface{}{"name": map[string]interface{}{"$len": 3}, "city": "paris"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err = q.WithCollation(Collation{Locale: "fr", Strength: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Match(map[string]interface{}{"name": "ann", "city": "Paris"}) {
+		t.Error("Expected the custom operator to be kept")
+	}
+}
+
+func TestQueryWithCollationConcurrent(t *testing.T) {
+	q, err := MustCompile(map[string]interface{}{"name": "elodie"}).WithCollation(Collation{Locale: "fr", Strength: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if !q.Match(map[string]interface{}{"name": "Élodie"}) {
+					t.Error("Expected a match")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCollatorSortDocuments(t *testing.T) {
+	c, err := NewCollator(Collation{Locale: "en", Strength: 2, NumericOrdering: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []map[string]interface{}{
+		{"name": "b"},
+		{"name": "item10"},
+		{"name": "Item9"},
+		{"name": "a"},
+		{"name": "B"},
+		{"name": []interface{}{"z", "A"}},
+	}
+	c.SortDocuments(docs, []SortField{{Path: "name"}})
+	var got []interface{}
+	for _, doc := range docs {
+		got = append(got, doc["name"])
+	}
+	want := []interface{}{"a", []interface{}{"z", "A"}, "b", "B", "Item9", "item10"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SortDocuments() = %v, want %v", got, want)
+	}
+
+	if got := c.CompareDocuments(map[string]interface{}{"n": "É"}, map[string]interface{}{"n": "é"}, []SortField{{Path: "n"}}); got != 0 {
+		t.Errorf("CompareDocuments() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,144 @@
+package mangomatch
+
+import "strings"
+
+// matcher is a query compiled into closures. Field paths are split,
+// operators are resolved and regular expressions are compiled once, so
+// evaluating it does no map iteration or operator lookup. b accounts for
+// the cost of the evaluation and is nil when it is unlimited.
+type matcher func(doc Document, b *budget) bool
+
+// compileMatcher builds the matcher for a query document: every condition
+// must hold and an empty query matches nothing. Compile validates the query
+// first; Match does not, and a condition that is invalid never matches.
+// Operators are resolved when the query is compiled, so operators
+// registered on e afterwards are not seen.
+func (e *Engine) compileMatcher(query map[string]interface{}) matcher {
+	conds := make([]matcher, 0, len(query))
+	for key, value := range query {
+		switch {
+		case key == "$and" || key == "$or" || key == "$nor":
+			conds = append(conds, e.compileLogical(key, value))
+		case strings.HasPrefix(key, "$"):
+			conds = append(conds, never)
+		default:
+			conds = append(conds, e.compileField(key, value))
+		}
+	}
+
+	switch len(conds) {
+	case 0:
+		return never
+	case 1:
+		return conds[0]
+	default:
+		return func(doc Document, b *budget) bool {
+			for _, cond := range conds {
+				if !cond(doc, b) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+}
+
+// never is the matcher of a condition that cannot match
+func never(Document, *budget) bool { return false }
+
+func (e *Engine) compileLogical(op string, value interface{}) matcher {
+	clauses, ok := value.([]interface{})
+	if !ok && op == "$and" {
+		return never
+	}
+	children := make([]matcher, len(clauses))
+	for i, clause := range clauses {
+		sub, _ := clause.(map[string]interface{})
+		children[i] = e.compileMatcher(sub)
+	}
+
+	anyMatch := func(doc Document, b *budget) bool {
+		if !b.step(op) {
+			return false
+		}
+		for _, child := range children {
+			if child(doc, b) {
+				return true
+			}
+		}
+		return false
+	}
+	switch op {
+	case "$and":
+		return func(doc Document, b *budget) bool {
+			if !b.step(op) {
+				return false
+			}
+			for _, child := range children {
+				if !child(doc, b) {
+					return false
+				}
+			}
+			return true
+		}
+	case "$or":
+		return anyMatch
+	default:
+		// A failed evaluation must not turn into a match
+		return func(doc Document, b *budget) bool {
+			return !anyMatch(doc, b) && (b == nil || b.err == nil)
+		}
+	}
+}
+
+// missingField is the value a condition is tested on when the document
+// lacks its field. The operators see it as null, as in MongoDB, except for
+// $exists and $type, which tell the two apart.
+type missingField struct{}
+
+func (e *Engine) compileField(key string, value interface{}) matcher {
+	path := strings.Split(key, ".")
+	tests, err := e.compileCondition(value)
+	if err != nil {
+		tests = []valueTest{{pred: func(interface{}, *budget) bool { return false }}}
+	}
+
+	return func(doc Document, b *budget) bool {
+		if !b.step(key) {
+			return false
+		}
+		values, exists := doc.Lookup(path)
+		if !exists {
+			// A missing field is tested like null
+			values = []interface{}{missingField{}}
+		}
+		if !b.scan(key, values) {
+			return false
+		}
+		for _, v := range values {
+			if !b.scan(key, v) {
+				return false
+			}
+		}
+		for _, t := range tests {
+			if !t.holds(values, b) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// CompileFunc compiles query into a typed predicate, such as a func(*User)
+// bool. It is the runtime counterpart of the code generated by
+// cmd/mangomatch-gen: items are read through AsDocument, so it works for any
+// type at the cost of reflection.
+func CompileFunc[T any](query interface{}) (func(T) bool, error) {
+	q, err := Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	return func(item T) bool {
+		return q.Match(item)
+	}, nil
+}
@@ -0,0 +1,107 @@
+package mangomatch
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCompiledMatchesMatch checks validated, compiled queries against
+// Match, which compiles the query as given on every call
+func TestCompiledMatchesMatch(t *testing.T) {
+	when := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	docs := []map[string]interface{}{
+		{},
+		{"name": "alice", "age": 30, "tags": []interface{}{"a", "b"}, "address": map[string]interface{}{"city": "Paris"}},
+		{"name": "bob", "age": 17.5, "tags": []interface{}{}, "nick": nil},
+		{"name": "carol", "age": "30", "tags": "a", "created": when},
+		{"age": []interface{}{10, 40}, "address": map[string]interface{}{"city": "Rome", "zip": 1}},
+		{"items": []interface{}{map[string]interface{}{"qty": 5}, map[string]interface{}{"qty": 20}}},
+		{"active": true, "score": 7, "created": when.Add(time.Hour)},
+	}
+
+	queries := []string{
+		`{"name": "alice"}`,
+		`{"age": 30}`,
+		`{"age": {"$gte": 18, "$lt": 35}}`,
+		`{"age": {"$ne": 30}}`,
+		`{"age": {"$nin": [30, 17.5]}}`,
+		`{"age": {"$not": {"$gt": 20}}}`,
+		`{"tags": "a"}`,
+		`{"tags": {"$in": ["b", "z"]}}`,
+		`{"tags": {"$size": 0}}`,
+		`{"tags": {"$all": ["a", "b"]}}`,
+		`{"tags": {"$eq": "a"}}`,
+		`{"nick": null}`,
+		`{"nick": {"$exists": true}}`,
+		`{"nick": {"$exists": false}}`,
+		`{"name": {"$regex": "^[ab]"}}`,
+		`{"address.city": "Rome"}`,
+		`{"address": {"city": "Paris"}}`,
+		`{"items.qty": {"$gt": 10}}`,
+		`{"items": {"$elemMatch": {"qty": {"$lt": 10}}}}`,
+		`{"score": {"$mod": [7, 0]}}`,
+		`{"age": {"$type": "string"}}`,
+		`{"created": {"$gt": {"$date": "2024-01-01T00:30:00Z"}}}`,
+		`{"$or": [{"active": true}, {"name": "bob"}]}`,
+		`{"$and": [{"age": {"$exists": true}}, {"$nor": [{"age": 30}]}]}`,
+		`{"$nor": [{"name": {"$exists": true}}]}`,
+		`{"name": "bob", "$or": [{"tags": {"$size": 0}}, {"active": true}]}`,
+	}
+
+	for _, src := range queries {
+		t.Run(src, func(t *testing.T) {
+			filter, err := ParseExtJSON([]byte(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := Compile(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, doc := range docs {
+				if got, want := q.Match(doc), Match(filter, doc); got != want {
+					t.Errorf("Compile(%s).Match(%v) = %v, Match = %v", src, doc, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileFunc(t *testing.T) {
+	type user struct {
+		Name string `bson:"name"`
+		Age  int    `bson:"age"`
+	}
+
+	isAdult, err := CompileFunc[*user](map[string]interface{}{"age": map[string]interface{}{"$gte": 18}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isAdult(&user{Age: 30}) || isAdult(&user{Age: 12}) {
+		t.Error("Expected CompileFunc to match on the age field")
+	}
+
+	if _, err := CompileFunc[*user](map[string]interface{}{"age": map[string]interface{}{"$foo": 1}}); err == nil {
+		t.Error("Expected an error for an unknown operator")
+	}
+}
+
+func BenchmarkCompiledMatch(b *testing.B) {
+	filter := map[string]interface{}{
+		"age":          map[string]interface{}{"$gte": 18, "$lt": 65},
+		"address.city": map[string]interface{}{"$in": []interface{}{"Paris", "Rome"}},
+	}
+	doc := map[string]interface{}{"age": 30, "address": map[string]interface{}{"city": "Rome"}}
+	q, _ := Compile(filter)
+
+	b.Run("Match", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Match(filter, doc)
+		}
+	})
+	b.Run("Compiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			q.Match(doc)
+		}
+	})
+}
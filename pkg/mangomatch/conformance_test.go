@@ -0,0 +1,168 @@
+package mangomatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The conformance fixtures in testdata/conformance hold queries and
+// documents in Extended JSON together with whether MongoDB's find returns
+// the document. With -record and MONGODB_URI set, the test asks a mongod
+// through mongosh instead and rewrites the expectations:
+//
+//	MONGODB_URI=mongodb://localhost:27017 go test -run TestConformance -record
+var recordConformance = flag.Bool("record", false, "record conformance expectations from the mongod at MONGODB_URI")
+
+type conformanceFile struct {
+	Description string            `json:"description"`
+	Tests       []conformanceCase `json:"tests"`
+}
+
+type conformanceCase struct {
+	Name     string          `json:"name"`
+	Query    json.RawMessage `json:"query"`
+	Doc      json.RawMessage `json:"doc"`
+	Expected bool            `json:"expected"`
+	// Skip gives the reason a known divergence is not checked
+	Skip string `json:"skip,omitempty"`
+}
+
+func TestConformance(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "conformance", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no conformance fixtures: %v", err)
+	}
+
+	for _, path := range paths {
+		file := readConformanceFile(t, path)
+		if *recordConformance {
+			recordConformanceFile(t, path, file)
+		}
+
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			for _, tc := range file.Tests {
+				t.Run(tc.Name, func(t *testing.T) {
+					if tc.Skip != "" {
+						t.Skip(tc.Skip)
+					}
+					query, err := ParseExtJSON(tc.Query)
+					if err != nil {
+						t.Fatal(err)
+					}
+					doc, err := ParseExtJSON(tc.Doc)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got := Match(query, doc); got != tc.Expected {
+						t.Errorf("Match(%s, %s) = %v, want %v", tc.Query, tc.Doc, got, tc.Expected)
+					}
+				})
+			}
+		})
+	}
+}
+
+func readConformanceFile(t testing.TB, path string) conformanceFile {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file conformanceFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return file
+}
+
+// conformanceScript runs each case against a scratch collection and prints
+// one line per case, "true" if find returned the document
+const conformanceScript = `
+const cases = EJSON.parse(process.env.MANGOMATCH_CASES, {relaxed: false});
+const coll = db.getSiblingDB("mangomatch_conformance").cases;
+for (const c of cases) {
+	coll.drop();
+	coll.insertOne(c.doc);
+	print(coll.countDocuments(c.query) > 0);
+}
+coll.drop();
+`
+
+// recordConformanceFile replaces the expectations of file with the answers
+// of the mongod at MONGODB_URI and writes it back to path
+func recordConformanceFile(t *testing.T, path string, file conformanceFile) {
+	t.Helper()
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		t.Fatal("-record needs MONGODB_URI")
+	}
+
+	cases := make([]map[string]json.RawMessage, len(file.Tests))
+	for i, tc := range file.Tests {
+		cases[i] = map[string]json.RawMessage{"query": tc.Query, "doc": tc.Doc}
+	}
+	encoded, err := json.Marshal(cases)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("mongosh", uri, "--quiet", "--eval", conformanceScript)
+	cmd.Env = append(os.Environ(), "MANGOMATCH_CASES="+string(encoded))
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("mongosh: %v", err)
+	}
+	answers := strings.Fields(string(out))
+	if len(answers) != len(file.Tests) {
+		t.Fatalf("mongosh returned %d answers for %d cases: %s", len(answers), len(file.Tests), out)
+	}
+	for i := range file.Tests {
+		file.Tests[i].Expected = answers[i] == "true"
+	}
+
+	if err := os.WriteFile(path, formatConformanceFile(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// formatConformanceFile writes one case per line, as the fixtures are
+// laid out by hand
+func formatConformanceFile(file conformanceFile) []byte {
+	var buf bytes.Buffer
+	description, _ := json.Marshal(file.Description)
+	fmt.Fprintf(&buf, "{\n\t\"description\": %s,\n\t\"tests\": [\n", description)
+	for i, tc := range file.Tests {
+		line, _ := json.Marshal(tc)
+		buf.WriteString("\t\t")
+		buf.Write(line)
+		if i < len(file.Tests)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("\t]\n}\n")
+	return buf.Bytes()
+}
+
+func TestFormatConformanceFile(t *testing.T) {
+	// Recording must not reformat the fixtures
+	paths, _ := filepath.Glob(filepath.Join("testdata", "conformance", "*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatConformanceFile(readConformanceFile(t, path)); !bytes.Equal(got, data) {
+			t.Errorf("%s is not laid out as the recorder writes it", path)
+		}
+	}
+}
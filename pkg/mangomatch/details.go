@@ -0,0 +1,164 @@
+package mangomatch
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MatchInfo describes how a document matched a query
+type MatchInfo struct {
+	// ArrayIndexes maps the path of each condition that held by way of
+	// array elements to the indexes of the elements that satisfy it on
+	// their own, in ascending order. For a path through an array of
+	// documents, such as "items.price", they index the first array on the
+	// path, which is the element MongoDB's positional $ operator refers to.
+	ArrayIndexes map[string][]int
+	// OrBranches maps each $or that held to the indexes of its clauses that
+	// matched. The top-level $or is at "$or" and one inside the second
+	// clause of a top-level $and at "$and.1.$or".
+	OrBranches map[string][]int
+}
+
+// MatchDetails evaluates query against doc like Match and, if it matches,
+// reports which array elements and $or clauses made it match. The query is
+// converted like Compile converts it, so it may be a bson.M or bson.D. There
+// is no $text operator, so no text scores are reported.
+func MatchDetails(query interface{}, doc map[string]interface{}) (bool, MatchInfo) {
+	return defaultEngine.MatchDetails(query, doc)
+}
+
+// MatchDetails is MatchDetails using the operators registered on e
+func (e *Engine) MatchDetails(query interface{}, doc map[string]interface{}) (bool, MatchInfo) {
+	filter, ok := ConvertBSON(query).(map[string]interface{})
+	if !ok || !e.Match(filter, doc) {
+		return false, MatchInfo{}
+	}
+	info := MatchInfo{ArrayIndexes: map[string][]int{}, OrBranches: map[string][]int{}}
+	e.collectDetails(filter, doc, "", &info)
+	return true, info
+}
+
+// collectDetails records the details of the matching query at location
+func (e *Engine) collectDetails(query map[string]interface{}, doc map[string]interface{}, location string, info *MatchInfo) {
+	for key, value := range query {
+		switch key {
+		case "$and", "$or":
+			clauses, _ := value.([]interface{})
+			for i, clause := range clauses {
+				sub, _ := clause.(map[string]interface{})
+				if !e.Match(sub, doc) {
+					continue
+				}
+				if key == "$or" {
+					info.OrBranches[location+key] = append(info.OrBranches[location+key], i)
+				}
+				e.collectDetails(sub, doc, location+key+"."+strconv.Itoa(i)+".", info)
+			}
+		case "$nor":
+			// None of its clauses matched
+		default:
+			if indexes := e.matchedIndexes(key, value, doc); len(indexes) > 0 {
+				info.ArrayIndexes[key] = mergeIndexes(info.ArrayIndexes[key], indexes)
+			}
+		}
+	}
+}
+
+// matchedIndexes returns the indexes of the array elements that satisfy
+// the field condition on their own
+func (e *Engine) matchedIndexes(path string, condition interface{}, doc map[string]interface{}) []int {
+	tests, err := e.compileCondition(condition)
+	if err != nil {
+		return nil
+	}
+	holds := func(values []interface{}) bool {
+		for _, t := range tests {
+			if !t.holds(values, nil) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var indexes []int
+	found := lookupIndexed(doc, strings.Split(path, "."), -1, nil)
+	groups := map[int][]interface{}{}
+	for _, v := range found {
+		if v.index >= 0 {
+			groups[v.index] = append(groups[v.index], v.value)
+		}
+	}
+	if len(groups) > 0 {
+		for index, values := range groups {
+			if holds(values) {
+				indexes = append(indexes, index)
+			}
+		}
+		sort.Ints(indexes)
+		return indexes
+	}
+
+	// The path ends at an array: test its elements one by one, each as an
+	// array of its own so that array operators such as $elemMatch apply
+	if len(found) != 1 {
+		return nil
+	}
+	items, _ := found[0].value.([]interface{})
+	for i, item := range items {
+		if holds([]interface{}{[]interface{}{item}}) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// indexedValue is a value found at a path with the index of the element of
+// the first array the path went through, or -1
+type indexedValue struct {
+	value interface{}
+	index int
+}
+
+// lookupIndexed follows lookupPath, recording array indexes. Elements
+// selected by an explicit position are not counted as array traversal.
+func lookupIndexed(current interface{}, parts []string, index int, out []indexedValue) []indexedValue {
+	if len(parts) == 0 {
+		return append(out, indexedValue{value: current, index: index})
+	}
+
+	switch v := current.(type) {
+	case map[string]interface{}:
+		if val, ok := v[parts[0]]; ok {
+			out = lookupIndexed(val, parts[1:], index, out)
+		}
+	case []interface{}:
+		if idx, ok := arrayIndex(parts[0]); ok && idx < len(v) {
+			out = lookupIndexed(v[idx], parts[1:], index, out)
+		}
+		for i, item := range v {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				next := index
+				if next < 0 {
+					next = i
+				}
+				out = lookupIndexed(itemMap, parts, next, out)
+			}
+		}
+	}
+	return out
+}
+
+// mergeIndexes returns the sorted union of a and b
+func mergeIndexes(a, b []int) []int {
+	seen := make(map[int]bool, len(a)+len(b))
+	var out []int
+	for _, i := range append(append([]int{}, a...), b...) {
+		if !seen[i] {
+			seen[i] = true
+			out = append(out, i)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
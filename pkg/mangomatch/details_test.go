@@ -0,0 +1,128 @@
+package mangomatch
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMatchDetails(t *testing.T) {
+	doc := `{
+		"tags": ["a", "b", "c", "b"],
+		"scores": [55, 82, 91],
+		"items": [
+			{"sku": "x", "price": 50, "tags": ["sale"]},
+			{"sku": "y", "price": 150, "tags": ["new", "sale"]},
+			{"sku": "z", "price": 300}
+		],
+		"name": "ann"
+	}`
+
+	tests := []struct {
+		name       string
+		query      string
+		want       bool
+		indexes    map[string][]int
+		orBranches map[string][]int
+	}{
+		{name: "Scalar field", query: `{"name": "ann"}`, want: true},
+		{name: "No match", query: `{"name": "bob"}`, want: false},
+		{name: "Array element", query: `{"tags": "b"}`, want: true, indexes: map[string][]int{"tags": {1, 3}}},
+		{name: "Range on array elements", query: `{"scores": {"$gt": 60}}`, want: true, indexes: map[string][]int{"scores": {1, 2}}},
+		{name: "Both bounds on one element", query: `{"scores": {"$gt": 60, "$lt": 90}}`, want: true, indexes: map[string][]int{"scores": {1}}},
+		{name: "$in", query: `{"tags": {"$in": ["c", "z"]}}`, want: true, indexes: map[string][]int{"tags": {2}}},
+		{name: "$elemMatch", query: `{"scores": {"$elemMatch": {"$gte": 80}}}`, want: true, indexes: map[string][]int{"scores": {1, 2}}},
+		{name: "$elemMatch on documents", query: `{"items": {"$elemMatch": {"price": {"$gt": 100}, "sku": "z"}}}`, want: true, indexes: map[string][]int{"items": {2}}},
+		{name: "Path through an array", query: `{"items.price": {"$gt": 100}}`, want: true, indexes: map[string][]int{"items.price": {1, 2}}},
+		{name: "Path through two arrays", query: `{"items.tags": "sale"}`, want: true, indexes: map[string][]int{"items.tags": {0, 1}}},
+		{name: "Explicit position", query: `{"items.1.price": 150}`, want: true},
+		{name: "$size holds for the array only", query: `{"tags": {"$size": 4}}`, want: true},
+		{name: "$ne", query: `{"tags": {"$ne": "z"}}`, want: true, indexes: map[string][]int{"tags": {0, 1, 2, 3}}},
+		{
+			name:       "$or branches",
+			query:      `{"$or": [{"name": "bob"}, {"tags": "c"}, {"scores": 55}]}`,
+			want:       true,
+			indexes:    map[string][]int{"tags": {2}, "scores": {0}},
+			orBranches: map[string][]int{"$or": {1, 2}},
+		},
+		{
+			name:       "$or inside $and",
+			query:      `{"$and": [{"name": "ann"}, {"$or": [{"tags": "a"}, {"name": "bob"}]}]}`,
+			want:       true,
+			indexes:    map[string][]int{"tags": {0}},
+			orBranches: map[string][]int{"$and.1.$or": {0}},
+		},
+		{name: "Repeated path", query: `{"$and": [{"tags": "a"}, {"tags": "c"}]}`, want: true, indexes: map[string][]int{"tags": {0, 2}}},
+		{name: "$nor records nothing", query: `{"$nor": [{"tags": "z"}]}`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, info := MatchDetails(parseQuery(t, tt.query), parseQuery(t, doc))
+			if matched != tt.want {
+				t.Fatalf("MatchDetails() matched = %v, want %v", matched, tt.want)
+			}
+			if !matched {
+				if info.ArrayIndexes != nil || info.OrBranches != nil {
+					t.Errorf("MatchDetails() info = %+v, want none", info)
+				}
+				return
+			}
+			if tt.indexes == nil {
+				tt.indexes = map[string][]int{}
+			}
+			if tt.orBranches == nil {
+				tt.orBranches = map[string][]int{}
+			}
+			if !reflect.DeepEqual(info.ArrayIndexes, tt.indexes) {
+				t.Errorf("ArrayIndexes = %v, want %v", info.ArrayIndexes, tt.indexes)
+			}
+			if !reflect.DeepEqual(info.OrBranches, tt.orBranches) {
+				t.Errorf("OrBranches = %v, want %v", info.OrBranches, tt.orBranches)
+			}
+		})
+	}
+}
+
+func TestMatchDetailsBSON(t *testing.T) {
+	doc := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"sku": "a", "qty": 1},
+			map[string]interface{}{"sku": "b", "qty": 12},
+			map[string]interface{}{"sku": "c", "qty": 30},
+		},
+	}
+	query := bson.M{"$or": bson.A{
+		bson.M{"items.qty": bson.M{"$gt": 10, "$lt": 20}},
+		bson.D{{Key: "items", Value: bson.M{"$elemMatch": bson.M{"sku": bson.M{"$in": bson.A{"c"}}}}}},
+	}}
+
+	matched, info := MatchDetails(query, doc)
+	if !matched {
+		t.Fatal("MatchDetails() matched = false, want true")
+	}
+	if want := map[string][]int{"items.qty": {1}, "items": {2}}; !reflect.DeepEqual(info.ArrayIndexes, want) {
+		t.Errorf("ArrayIndexes = %v, want %v", info.ArrayIndexes, want)
+	}
+	if want := map[string][]int{"$or": {0, 1}}; !reflect.DeepEqual(info.OrBranches, want) {
+		t.Errorf("OrBranches = %v, want %v", info.OrBranches, want)
+	}
+
+	if matched, _ := MatchDetails(bson.A{}, doc); matched {
+		t.Error("Expected a query that is not a document not to match")
+	}
+}
+
+func ExampleMatchDetails() {
+	doc := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"sku": "a", "qty": 1},
+			map[string]interface{}{"sku": "b", "qty": 12},
+		},
+	}
+	_, info := MatchDetails(map[string]interface{}{"items.qty": map[string]interface{}{"$gt": 10}}, doc)
+	fmt.Println(info.ArrayIndexes["items.qty"])
+	// Output: [1]
+}
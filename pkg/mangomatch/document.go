@@ -0,0 +1,122 @@
+package mangomatch
+
+import (
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Document is anything a query can be evaluated against without first
+// converting it into a map[string]interface{}
+type Document interface {
+	// Lookup resolves a dotted field path that has been split into segments.
+	// It returns every value found at the path, following arrays as
+	// MongoDB does, and whether the path exists.
+	Lookup(path []string) (values []interface{}, found bool)
+
+	// Range calls fn for each top-level field until fn returns false
+	Range(fn func(key string, value interface{}) bool)
+}
+
+// MapDocument adapts a plain map to the Document interface
+type MapDocument map[string]interface{}
+
+func (d MapDocument) Lookup(path []string) ([]interface{}, bool) {
+	values := lookupPath(map[string]interface{}(d), path, nil)
+	return values, len(values) > 0
+}
+
+func (d MapDocument) Range(fn func(key string, value interface{}) bool) {
+	for key, val := range d {
+		if !fn(key, val) {
+			return
+		}
+	}
+}
+
+// bsonMDocument reads a bson.M, converting only the values that are looked up
+type bsonMDocument bson.M
+
+func (d bsonMDocument) Lookup(path []string) ([]interface{}, bool) {
+	val, exists := d[path[0]]
+	if !exists {
+		return nil, false
+	}
+	return lookupRest(ConvertBSON(val), path[1:])
+}
+
+func (d bsonMDocument) Range(fn func(key string, value interface{}) bool) {
+	for key, val := range d {
+		if !fn(key, ConvertBSON(val)) {
+			return
+		}
+	}
+}
+
+// bsonDDocument reads a bson.D, converting only the values that are looked up
+type bsonDDocument bson.D
+
+func (d bsonDDocument) Lookup(path []string) ([]interface{}, bool) {
+	for _, elem := range d {
+		if elem.Key == path[0] {
+			return lookupRest(ConvertBSON(elem.Value), path[1:])
+		}
+	}
+	return nil, false
+}
+
+func (d bsonDDocument) Range(fn func(key string, value interface{}) bool) {
+	for _, elem := range d {
+		if !fn(elem.Key, ConvertBSON(elem.Value)) {
+			return
+		}
+	}
+}
+
+// lookupRest resolves the remaining path segments below an already found value
+func lookupRest(val interface{}, rest []string) ([]interface{}, bool) {
+	values := lookupPath(val, rest, nil)
+	return values, len(values) > 0
+}
+
+// AsDocument wraps item in the matching built-in Document adapter. It accepts
+// a Document, map[string]interface{}, bson.M, bson.D, bson.Raw, maps with
+// string keys, and structs or pointers to structs.
+func AsDocument(item interface{}) (Document, bool) {
+	switch v := item.(type) {
+	case Document:
+		return v, true
+	case map[string]interface{}:
+		return MapDocument(v), true
+	case bson.M:
+		return bsonMDocument(v), true
+	case bson.D:
+		return bsonDDocument(v), true
+	case bson.Raw:
+		if err := validateRaw(v); err != nil {
+			return nil, false
+		}
+		return rawDocument(v), true
+	}
+
+	rv := reflect.ValueOf(item)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			return nil, false
+		}
+		return structDocument{v: rv}, true
+	case reflect.Map:
+		m, ok := reflectValue(rv).(map[string]interface{})
+		return MapDocument(m), ok
+	default:
+		return nil, false
+	}
+}
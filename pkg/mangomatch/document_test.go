@@ -0,0 +1,354 @@
+package mangomatch
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// headerDocument is a custom Document over HTTP-style headers, where dotted
+// paths are not nested but part of the key itself
+type headerDocument map[string][]string
+
+func (h headerDocument) Lookup(path []string) ([]interface{}, bool) {
+	values, ok := h[strings.Join(path, ".")]
+	if !ok {
+		return nil, false
+	}
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out, true
+}
+
+func (h headerDocument) Range(fn func(key string, value interface{}) bool) {
+	for key, values := range h {
+		if !fn(key, values) {
+			return
+		}
+	}
+}
+
+func TestMatchDocumentAdapters(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "name", Value: "John"},
+		{Key: "age", Value: 30},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "New York"}}},
+		{Key: "tags", Value: bson.A{"premium", "verified"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := map[string]interface{}{
+		"map": map[string]interface{}{
+			"name": "John", "age": 30,
+			"address": map[string]interface{}{"city": "New York"},
+			"tags":    []interface{}{"premium", "verified"},
+		},
+		"bson.M": bson.M{
+			"name": "John", "age": 30,
+			"address": bson.M{"city": "New York"},
+			"tags":    bson.A{"premium", "verified"},
+		},
+		"bson.D": bson.D{
+			{Key: "name", Value: "John"},
+			{Key: "age", Value: 30},
+			{Key: "address", Value: bson.D{{Key: "city", Value: "New York"}}},
+			{Key: "tags", Value: bson.A{"premium", "verified"}},
+		},
+		"bson.Raw": bson.Raw(raw),
+		"struct": testUser{
+			Name: "John", Age: 30,
+			Address: &testAddress{City: "New York"},
+			Tags:    []string{"premium", "verified"},
+		},
+		"typed map": map[string]string{"name": "John"},
+	}
+
+	queries := []struct {
+		name  string
+		query map[string]interface{}
+		want  bool
+	}{
+		{name: "top-level field", query: map[string]interface{}{"name": "John"}, want: true},
+		{name: "numeric comparison", query: map[string]interface{}{"age": map[string]interface{}{"$gte": 30}}, want: true},
+		{name: "nested field", query: map[string]interface{}{"address.city": "New York"}, want: true},
+		{name: "array element", query: map[string]interface{}{"tags": "verified"}, want: true},
+		{name: "array index", query: map[string]interface{}{"tags.1": "verified"}, want: true},
+		{name: "missing field", query: map[string]interface{}{"email": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "no match", query: map[string]interface{}{"address.city": "Boston"}, want: false},
+	}
+
+	for kind, item := range docs {
+		doc, ok := AsDocument(item)
+		if !ok {
+			t.Fatalf("AsDocument(%s) failed", kind)
+		}
+		for _, tt := range queries {
+			if kind == "typed map" && tt.name != "top-level field" {
+				continue
+			}
+			t.Run(kind+"/"+tt.name, func(t *testing.T) {
+				if got := MatchDocument(tt.query, doc); got != tt.want {
+					t.Errorf("MatchDocument() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMatchDocumentSizedNumbers(t *testing.T) {
+	docs := map[string]interface{}{
+		"bson.M int32":   bson.M{"age": int32(30), "scores": bson.A{int32(7), int32(9)}},
+		"bson.M int64":   bson.M{"age": int64(30), "scores": bson.A{int64(7), int64(9)}},
+		"bson.M float32": bson.M{"age": float32(30), "scores": bson.A{float32(7), float32(9)}},
+		"bson.D int32":   bson.D{{Key: "age", Value: int32(30)}, {Key: "scores", Value: bson.A{int32(7), int32(9)}}},
+		"bson.D int64":   bson.D{{Key: "age", Value: int64(30)}, {Key: "scores", Value: bson.A{int64(7), int64(9)}}},
+		"bson.D float32": bson.D{{Key: "age", Value: float32(30)}, {Key: "scores", Value: bson.A{float32(7), float32(9)}}},
+	}
+
+	queries := []struct {
+		name  string
+		query bson.M
+		want  bool
+	}{
+		{name: "equality", query: bson.M{"age": 30}, want: true},
+		{name: "float equality", query: bson.M{"age": 30.0}, want: true},
+		{name: "sized query operand", query: bson.M{"age": int32(30)}, want: true},
+		{name: "range", query: bson.M{"age": bson.M{"$gt": 25, "$lte": 30}}, want: true},
+		{name: "$in", query: bson.M{"age": bson.M{"$in": bson.A{20, 30}}}, want: true},
+		{name: "array element", query: bson.M{"scores": 9}, want: true},
+		{name: "$mod", query: bson.M{"age": bson.M{"$mod": bson.A{4, 2}}}, want: true},
+		{name: "no match", query: bson.M{"age": bson.M{"$lt": 30}}, want: false},
+	}
+
+	for kind, doc := range docs {
+		for _, tt := range queries {
+			t.Run(kind+"/"+tt.name, func(t *testing.T) {
+				if got := MatchBSON(tt.query, doc); got != tt.want {
+					t.Errorf("MatchBSON() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+
+	got, err := Filter([]bson.M{{"age": int32(30)}, {"age": int64(20)}, {"age": float32(26.5)}}, bson.M{"age": bson.M{"$gt": 25}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("Filter() = %v, want the int32 and float32 documents", got)
+	}
+}
+
+func TestMatchDocumentCustomImplementation(t *testing.T) {
+	doc := headerDocument{
+		"content.type": {"application/json"},
+		"accept":       {"text/html", "application/xml"},
+	}
+
+	if !MatchDocument(map[string]interface{}{"content.type": "application/json"}, doc) {
+		t.Error("Expected dotted key to be resolved by the custom document")
+	}
+	if !MatchDocument(map[string]interface{}{"accept": map[string]interface{}{"$regex": "xml$"}}, doc) {
+		t.Error("Expected any of the returned values to match")
+	}
+	if MatchDocument(map[string]interface{}{"accept": "image/png"}, doc) {
+		t.Error("Expected no match")
+	}
+
+	q := MustCompile(map[string]interface{}{"accept": "text/html"})
+	if !q.Match(doc) {
+		t.Error("Expected Query.Match to accept a Document directly")
+	}
+}
+
+func TestDocumentRange(t *testing.T) {
+	docs := []interface{}{
+		map[string]interface{}{"a": 1, "b": 2},
+		bson.M{"a": 1, "b": 2},
+		bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 2}},
+		struct {
+			A int `bson:"a"`
+			B int `bson:"b"`
+		}{1, 2},
+	}
+
+	for _, item := range docs {
+		doc, ok := AsDocument(item)
+		if !ok {
+			t.Fatalf("AsDocument(%T) failed", item)
+		}
+
+		var keys []string
+		doc.Range(func(key string, value interface{}) bool {
+			keys = append(keys, key)
+			return true
+		})
+		sort.Strings(keys)
+		if strings.Join(keys, ",") != "a,b" {
+			t.Errorf("Range over %T visited %v", item, keys)
+		}
+
+		visited := 0
+		doc.Range(func(key string, value interface{}) bool {
+			visited++
+			return false
+		})
+		if visited != 1 {
+			t.Errorf("Range over %T did not stop early", item)
+		}
+	}
+}
+
+func TestAsDocumentUnsupported(t *testing.T) {
+	for _, item := range []interface{}{nil, 42, "text", []interface{}{1}, bson.Raw{0x01}} {
+		if _, ok := AsDocument(item); ok {
+			t.Errorf("Expected AsDocument(%T) to fail", item)
+		}
+	}
+}
+
+// pathAdapters returns the document encoded in Extended JSON through each
+// built-in adapter that resolves paths
+func pathAdapters(t *testing.T, doc string) map[string]Document {
+	t.Helper()
+	m, err := ParseExtJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(doc), false, &raw); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Document{
+		"map":      MapDocument(m),
+		"bson.M":   bsonMDocument(MapBSON(m).(bson.M)),
+		"bson.D":   bsonDDocument(toBSOND(m).(bson.D)),
+		"bson.Raw": rawDocument(raw),
+	}
+}
+
+// toBSOND converts the maps in value to bson.D
+func toBSOND(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		d := bson.D{}
+		for key, val := range v {
+			d = append(d, bson.E{Key: key, Value: toBSOND(val)})
+		}
+		return d
+	case []interface{}:
+		a := bson.A{}
+		for _, item := range v {
+			a = append(a, toBSOND(item))
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+func TestLookupPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		path string
+		// want is the JSON array of values found, or null if the path is
+		// missing
+		want string
+	}{
+		{name: "Top-level scalar", doc: `{"a": 1}`, path: "a", want: `[1]`},
+		{name: "Top-level array", doc: `{"a": [1, 2]}`, path: "a", want: `[[1, 2]]`},
+		{name: "Top-level null", doc: `{"a": null}`, path: "a", want: `[null]`},
+		{name: "Missing field", doc: `{"a": 1}`, path: "b", want: `null`},
+		{name: "Embedded document", doc: `{"a": {"b": 1}}`, path: "a.b", want: `[1]`},
+		{name: "Below a scalar", doc: `{"a": 5}`, path: "a.b", want: `null`},
+		{name: "Below null", doc: `{"a": null}`, path: "a.b", want: `null`},
+		{name: "Every document of an array", doc: `{"a": [{"b": 1}, {"b": 2}]}`, path: "a.b", want: `[1, 2]`},
+		{name: "Documents without the field are skipped", doc: `{"a": [{"c": 1}, {"b": 2}]}`, path: "a.b", want: `[2]`},
+		{name: "No document has the field", doc: `{"a": [{"c": 1}]}`, path: "a.b", want: `null`},
+		{name: "Array of scalars", doc: `{"a": [1, 2]}`, path: "a.b", want: `null`},
+		{name: "Empty array", doc: `{"a": []}`, path: "a.b", want: `null`},
+		{name: "Arrays at two levels", doc: `{"a": [{"b": [{"c": 1}, {"c": 2}]}, {"b": {"c": 3}}]}`, path: "a.b.c", want: `[1, 2, 3]`},
+		{name: "Array values are not flattened", doc: `{"a": [{"b": [1, 2]}, {"b": 3}]}`, path: "a.b", want: `[[1, 2], 3]`},
+		{name: "Nested arrays are not descended into", doc: `{"a": [[{"b": 1}]]}`, path: "a.b", want: `null`},
+		{name: "Array position", doc: `{"a": [10, 20]}`, path: "a.1", want: `[20]`},
+		{name: "Position out of range", doc: `{"a": [10]}`, path: "a.5", want: `null`},
+		{name: "Position then field", doc: `{"a": [{"b": 1}, {"b": 2}]}`, path: "a.1.b", want: `[2]`},
+		{name: "Position in a nested array", doc: `{"a": [[{"b": 1}]]}`, path: "a.0.b", want: `[1]`},
+		{name: "Position of an array in a document of an array", doc: `{"a": [{"b": [5, 6]}, {"b": [7]}]}`, path: "a.b.0", want: `[5, 7]`},
+		{name: "Numeric object key", doc: `{"a": {"2024": 5}}`, path: "a.2024", want: `[5]`},
+		{name: "Numeric top-level key", doc: `{"2024": 1}`, path: "2024", want: `[1]`},
+		{name: "Numeric key with leading zero", doc: `{"a": {"01": 5}}`, path: "a.01", want: `[5]`},
+		{name: "Numeric segment as position and key", doc: `{"a": [{"0": "x"}, {"0": "y"}]}`, path: "a.0", want: `[{"0": "x"}, "x", "y"]`},
+		{name: "Negative segment is a key", doc: `{"a": [1, 2]}`, path: "a.-1", want: `null`},
+	}
+
+	for _, tt := range tests {
+		wrapped, err := ParseExtJSON([]byte(`{"v": ` + tt.want + `}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := wrapped["v"].([]interface{})
+
+		for kind, doc := range pathAdapters(t, tt.doc) {
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				got, found := doc.Lookup(strings.Split(tt.path, "."))
+				if found != (want != nil) || !reflect.DeepEqual(got, want) {
+					t.Errorf("Lookup(%q) = %v, %v, want %v", tt.path, got, found, want)
+				}
+			})
+		}
+	}
+}
+
+func TestArrayPathQueries(t *testing.T) {
+	items := `{"items": [{"price": 50, "tags": ["a"]}, {"price": 150, "tags": ["b", "c"]}], "years": {"2024": {"revenue": 10}}}`
+	tests := []struct {
+		name  string
+		doc   string
+		query string
+		want  bool
+	}{
+		{name: "Later element qualifies", doc: items, query: `{"items.price": {"$gt": 100}}`, want: true},
+		{name: "No element qualifies", doc: items, query: `{"items.price": {"$gt": 200}}`, want: false},
+		{name: "Equality with any element", doc: items, query: `{"items.price": 150}`, want: true},
+		{name: "Operators met by different elements", doc: items, query: `{"items.price": {"$gt": 100, "$lt": 60}}`, want: true},
+		{name: "$ne fails if any element is equal", doc: items, query: `{"items.price": {"$ne": 150}}`, want: false},
+		{name: "$ne holds if no element is equal", doc: items, query: `{"items.price": {"$ne": 10}}`, want: true},
+		{name: "$nin fails if any element is listed", doc: items, query: `{"items.price": {"$nin": [50]}}`, want: false},
+		{name: "$not fails if any element matches", doc: items, query: `{"items.price": {"$not": {"$gt": 100}}}`, want: false},
+		{name: "$not holds if no element matches", doc: items, query: `{"items.price": {"$not": {"$gt": 200}}}`, want: true},
+		{name: "Element of an array value", doc: items, query: `{"items.tags": "c"}`, want: true},
+		{name: "$all across elements", doc: items, query: `{"items.tags": {"$all": ["a", "b"]}}`, want: true},
+		{name: "$all missing a value", doc: items, query: `{"items.tags": {"$all": ["a", "d"]}}`, want: false},
+		{name: "$size of any array value", doc: items, query: `{"items.tags": {"$size": 2}}`, want: true},
+		{name: "$exists on some element", doc: items, query: `{"items.price": {"$exists": true}}`, want: true},
+		{name: "$exists false with no element", doc: items, query: `{"items.cost": {"$exists": false}}`, want: true},
+		{name: "Array position", doc: items, query: `{"items.1.price": 150}`, want: true},
+		{name: "Array position no match", doc: items, query: `{"items.0.price": 150}`, want: false},
+		{name: "Numeric object key", doc: items, query: `{"years.2024.revenue": 10}`, want: true},
+		{name: "Missing numeric key", doc: items, query: `{"years.2023.revenue": {"$exists": false}}`, want: true},
+	}
+
+	for _, tt := range tests {
+		query := parseQuery(t, tt.query)
+		compiled := MustCompile(query)
+		for kind, doc := range pathAdapters(t, tt.doc) {
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				if got := MatchDocument(query, doc); got != tt.want {
+					t.Errorf("MatchDocument() = %v, want %v", got, tt.want)
+				}
+				if got := compiled.Match(doc); got != tt.want {
+					t.Errorf("Query.Match() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package mangomatch
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Predicate reports whether a document value satisfies a compiled operator.
+// Array values are passed as []interface{}, and a missing field as nil.
+type Predicate func(value interface{}) bool
+
+// OperatorFunc compiles the operand of a field-level operator into a
+// Predicate. Returning an error makes Compile reject the query, and makes
+// Match treat the condition as not matching.
+type OperatorFunc func(operand interface{}) (Predicate, error)
+
+// budgetPredicate is a Predicate that accounts for its cost in b, which is
+// nil when evaluation is unlimited
+type budgetPredicate func(value interface{}, b *budget) bool
+
+// nestedOperator compiles a built-in that evaluates other conditions, such
+// as $elemMatch, so that the limits of the evaluation apply inside it, or
+// that must tell a missingField from null, such as $exists
+type nestedOperator func(operand interface{}) (budgetPredicate, error)
+
+// Engine evaluates queries with its own set of operators. The zero value is
+// not usable; create engines with NewEngine.
+type Engine struct {
+	mu        sync.RWMutex
+	operators map[string]OperatorFunc
+	// custom holds the operators added with RegisterOperator
+	custom map[string]OperatorFunc
+	// nested holds the built-ins compiled as budgetPredicates, until they
+	// are replaced with RegisterOperator
+	nested   map[string]nestedOperator
+	limits   Limits
+	collator *Collator
+}
+
+// defaultEngine backs the package-level Match, MatchDocument and Compile
+var defaultEngine = NewEngine()
+
+// NewEngine returns an engine with all built-in operators registered
+func NewEngine() *Engine {
+	e := &Engine{operators: make(map[string]OperatorFunc)}
+	e.registerBuiltins()
+	return e
+}
+
+// RegisterOperator adds or replaces the field-level operator name, which
+// must start with "$". Registered operators are available everywhere a
+// built-in is, including inside $not, $elemMatch and logical operators.
+func (e *Engine) RegisterOperator(name string, fn OperatorFunc) {
+	if !strings.HasPrefix(name, "$") || len(name) < 2 {
+		panic(fmt.Sprintf("mangomatch: operator name %q must start with $", name))
+	}
+	if fn == nil {
+		panic(fmt.Sprintf("mangomatch: nil OperatorFunc for %s", name))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.operators[name] = fn
+	delete(e.nested, name)
+	if e.custom == nil {
+		e.custom = make(map[string]OperatorFunc)
+	}
+	e.custom[name] = fn
+}
+
+// withCollator returns a copy of e whose queries compare strings under col.
+// The built-ins are registered anew so that $not, $elemMatch and $all
+// compile their contents with the copy.
+func (e *Engine) withCollator(col *Collator) *Engine {
+	clone := &Engine{operators: make(map[string]OperatorFunc), limits: e.Limits(), collator: col}
+	clone.registerBuiltins()
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for name, fn := range e.custom {
+		clone.RegisterOperator(name, fn)
+	}
+	return clone
+}
+
+// compileOperator turns one operator and its operand into a predicate
+func (e *Engine) compileOperator(op string, operand interface{}) (budgetPredicate, error) {
+	e.mu.RLock()
+	fn, ok := e.operators[op]
+	nested := e.nested[op]
+	e.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown operator %s", op)
+	}
+	var pred budgetPredicate
+	var err error
+	switch {
+	case nested != nil:
+		pred, err = nested(operand)
+	case collatedOperators[op]:
+		pred, err = unbudgeted(e.collator.collate(operand, fn))
+	default:
+		pred, err = unbudgeted(fn(operand))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", op, err)
+	}
+	return pred, nil
+}
+
+// unbudgeted adapts a Predicate, which does no accounting of its own
+func unbudgeted(pred Predicate, err error) (budgetPredicate, error) {
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}, _ *budget) bool {
+		if _, missing := value.(missingField); missing {
+			value = nil
+		}
+		return pred(value)
+	}, nil
+}
+
+// compileOperators builds a predicate that requires every operator to match
+func (e *Engine) compileOperators(operators map[string]interface{}) (budgetPredicate, error) {
+	operators = withRegexOptions(operators)
+	preds := make([]budgetPredicate, 0, len(operators))
+	for op, operand := range operators {
+		pred, err := e.compileOperator(op, operand)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+
+	return func(value interface{}, b *budget) bool {
+		for _, pred := range preds {
+			if !pred(value, b) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func (e *Engine) registerBuiltins() {
+	e.operators["$eq"] = comparisonOperator(compareEqualAny)
+	e.operators["$ne"] = negateOperator(comparisonOperator(compareEqualAny))
+	e.operators["$gt"] = comparisonOperator(compareGreaterThan)
+	e.operators["$gte"] = comparisonOperator(compareGreaterThanEqual)
+	e.operators["$lt"] = comparisonOperator(compareLessThan)
+	e.operators["$lte"] = comparisonOperator(compareLessThanEqual)
+	e.operators["$in"] = arrayOperator(evaluateIn)
+	e.operators["$nin"] = negateOperator(arrayOperator(evaluateIn))
+	e.registerNested("$all", e.compileAll)
+	e.registerNested("$exists", compileExists)
+	e.operators["$regex"] = compileRegex
+	e.operators["$size"] = compileSize
+	e.registerNested("$type", compileType)
+	e.operators["$mod"] = compileMod
+	e.registerNested("$not", e.compileNot)
+	e.registerNested("$elemMatch", e.compileElemMatch)
+}
+
+// registerNested registers a built-in that is compiled as a budgetPredicate.
+// Its OperatorFunc evaluates without limits.
+func (e *Engine) registerNested(name string, fn nestedOperator) {
+	if e.nested == nil {
+		e.nested = make(map[string]nestedOperator)
+	}
+	e.nested[name] = fn
+	e.operators[name] = func(operand interface{}) (Predicate, error) {
+		pred, err := fn(operand)
+		if err != nil {
+			return nil, err
+		}
+		return func(value interface{}) bool {
+			return pred(value, nil)
+		}, nil
+	}
+}
+
+// comparisonOperator adapts a compare function that accepts any operand
+func comparisonOperator(compare func(a, b interface{}) bool) OperatorFunc {
+	return func(operand interface{}) (Predicate, error) {
+		return func(value interface{}) bool {
+			return compare(operand, value)
+		}, nil
+	}
+}
+
+// arrayOperator adapts an evaluate function whose operand must be an array
+func arrayOperator(evaluate func(queryValue, docValue interface{}) bool) OperatorFunc {
+	return func(operand interface{}) (Predicate, error) {
+		if _, ok := operand.([]interface{}); !ok {
+			return nil, errors.New("requires an array")
+		}
+		return func(value interface{}) bool {
+			return evaluate(operand, value)
+		}, nil
+	}
+}
+
+// negateOperator inverts the predicate built by fn
+func negateOperator(fn OperatorFunc) OperatorFunc {
+	return func(operand interface{}) (Predicate, error) {
+		pred, err := fn(operand)
+		if err != nil {
+			return nil, err
+		}
+		return func(value interface{}) bool {
+			return !pred(value)
+		}, nil
+	}
+}
+
+// compileExists is a nested built-in so that it sees the missingField that
+// other operators see as null
+func compileExists(operand interface{}) (budgetPredicate, error) {
+	want, ok := operand.(bool)
+	if !ok {
+		return nil, errors.New("requires a boolean")
+	}
+	return func(value interface{}, _ *budget) bool {
+		_, missing := value.(missingField)
+		return missing != want
+	}, nil
+}
+
+func compileRegex(operand interface{}) (Predicate, error) {
+	pattern, err := regexPattern(operand)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}) bool {
+		return matchRegex(re, value)
+	}, nil
+}
+
+// regexPattern reads a $regex operand, a string or a primitive.Regex, and
+// turns its options into a (?flags) prefix
+func regexPattern(operand interface{}) (string, error) {
+	switch v := operand.(type) {
+	case string:
+		return v, nil
+	case primitive.Regex:
+		if v.Options == "" {
+			return v.Pattern, nil
+		}
+		flags := []byte(v.Options)
+		for _, flag := range flags {
+			if !strings.ContainsRune("ims", rune(flag)) {
+				return "", fmt.Errorf("unsupported option %q", flag)
+			}
+		}
+		sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+		return "(?" + string(flags) + ")" + v.Pattern, nil
+	}
+	return "", errors.New("requires a string")
+}
+
+// withRegexOptions folds the $options of a condition into its $regex, as
+// the primitive.Regex the driver would use
+func withRegexOptions(ops map[string]interface{}) map[string]interface{} {
+	options, hasOptions := ops["$options"].(string)
+	pattern, hasPattern := ops["$regex"].(string)
+	if !hasOptions || !hasPattern {
+		return ops
+	}
+	out := make(map[string]interface{}, len(ops)-1)
+	for op, operand := range ops {
+		if op != "$options" {
+			out[op] = operand
+		}
+	}
+	out["$regex"] = primitive.Regex{Pattern: pattern, Options: options}
+	return out
+}
+
+func compileSize(operand interface{}) (Predicate, error) {
+	switch widenNumber(operand).(type) {
+	case int, float64:
+	default:
+		return nil, errors.New("requires a number")
+	}
+	return func(value interface{}) bool {
+		return evaluateSize(operand, value)
+	}, nil
+}
+
+// compileType is a nested built-in so that {"$type": "null"} does not
+// match a missing field
+func compileType(operand interface{}) (budgetPredicate, error) {
+	types, err := typeSet(operand)
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}, _ *budget) bool {
+		if _, missing := value.(missingField); missing {
+			return false
+		}
+		return hasType(types, value)
+	}, nil
+}
+
+func compileMod(operand interface{}) (Predicate, error) {
+	params, ok := operand.([]interface{})
+	if !ok || len(params) != 2 {
+		return nil, errors.New("requires [divisor, remainder]")
+	}
+	return func(value interface{}) bool {
+		return evaluateMod(operand, value)
+	}, nil
+}
+
+func (e *Engine) compileNot(operand interface{}) (budgetPredicate, error) {
+	subMap, ok := operand.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("requires a document")
+	}
+	pred, err := e.compileOperators(subMap)
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}, b *budget) bool {
+		// A failed evaluation must not turn into a match
+		return !pred(value, b) && (b == nil || b.err == nil)
+	}, nil
+}
+
+// compileElemMatch builds $elemMatch. An operator document such as
+// {"$gt": 1} applies to the elements themselves; anything else, including
+// $and, $or and $nor, is a query that document elements must match.
+func (e *Engine) compileElemMatch(operand interface{}) (budgetPredicate, error) {
+	criteria, ok := operand.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("requires a document")
+	}
+
+	var element budgetPredicate
+	if isElemMatchOperators(criteria) {
+		pred, err := e.compileOperators(criteria)
+		if err != nil {
+			return nil, err
+		}
+		element = pred
+	} else {
+		if err := e.validateQuery(criteria); err != nil {
+			return nil, err
+		}
+		m := e.compileMatcher(criteria)
+		element = func(item interface{}, b *budget) bool {
+			doc, ok := item.(map[string]interface{})
+			// Unlike a top-level query, an empty one matches any document
+			return ok && (len(criteria) == 0 || m(MapDocument(doc), b))
+		}
+	}
+
+	return func(value interface{}, b *budget) bool {
+		items, _ := value.([]interface{})
+		for _, item := range items {
+			if element(item, b) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// compileAll builds $all, whose items are either values the array must
+// contain or {"$elemMatch": ...} clauses that some element must match
+func (e *Engine) compileAll(operand interface{}) (budgetPredicate, error) {
+	items, ok := operand.([]interface{})
+	if !ok {
+		return nil, errors.New("requires an array")
+	}
+
+	var clauses []budgetPredicate
+	for _, item := range items {
+		sub, ok := item.(map[string]interface{})
+		if _, isClause := sub["$elemMatch"]; !ok || !isClause || len(sub) != 1 {
+			continue
+		}
+		pred, err := e.compileElemMatch(sub["$elemMatch"])
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, pred)
+	}
+	if len(clauses) == 0 {
+		return unbudgeted(e.collator.collate(operand, arrayOperator(evaluateAll)))
+	}
+	if len(clauses) != len(items) {
+		return nil, errors.New("cannot mix $elemMatch clauses with values")
+	}
+
+	return func(value interface{}, b *budget) bool {
+		for _, pred := range clauses {
+			if !pred(value, b) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,153 @@
+package mangomatch
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// ipInCIDR is an example domain-specific operator: {"ip": {"$ipInCIDR": "10.0.0.0/8"}}
+func ipInCIDR(operand interface{}) (Predicate, error) {
+	cidr, ok := operand.(string)
+	if !ok {
+		return nil, errors.New("requires a CIDR string")
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}) bool {
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		ip := net.ParseIP(s)
+		return ip != nil && network.Contains(ip)
+	}, nil
+}
+
+func TestEngineCustomOperator(t *testing.T) {
+	e := NewEngine()
+	e.RegisterOperator("$ipInCIDR", ipInCIDR)
+
+	doc := map[string]interface{}{
+		"ip": "10.1.2.3",
+		"peers": []interface{}{
+			map[string]interface{}{"ip": "192.168.0.10", "port": 443},
+			map[string]interface{}{"ip": "10.9.9.9", "port": 22},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query map[string]interface{}
+		want  bool
+	}{
+		{name: "direct", query: map[string]interface{}{"ip": map[string]interface{}{"$ipInCIDR": "10.0.0.0/8"}}, want: true},
+		{name: "direct no match", query: map[string]interface{}{"ip": map[string]interface{}{"$ipInCIDR": "192.168.0.0/16"}}, want: false},
+		{name: "combined with built-in", query: map[string]interface{}{"ip": map[string]interface{}{"$ipInCIDR": "10.0.0.0/8", "$ne": "10.1.2.3"}}, want: false},
+		{name: "inside $not", query: map[string]interface{}{"ip": map[string]interface{}{"$not": map[string]interface{}{"$ipInCIDR": "192.168.0.0/16"}}}, want: true},
+		{name: "inside $elemMatch", query: map[string]interface{}{"peers": map[string]interface{}{"$elemMatch": map[string]interface{}{
+			"ip": map[string]interface{}{"$ipInCIDR": "10.0.0.0/8"}, "port": 22,
+		}}}, want: true},
+		{name: "inside $elemMatch no match", query: map[string]interface{}{"peers": map[string]interface{}{"$elemMatch": map[string]interface{}{
+			"ip": map[string]interface{}{"$ipInCIDR": "10.0.0.0/8"}, "port": 443,
+		}}}, want: false},
+		{name: "inside $or", query: map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"ip": "1.1.1.1"},
+			map[string]interface{}{"ip": map[string]interface{}{"$ipInCIDR": "10.0.0.0/8"}},
+		}}, want: true},
+		{name: "inside $nor", query: map[string]interface{}{"$nor": []interface{}{
+			map[string]interface{}{"ip": map[string]interface{}{"$ipInCIDR": "10.0.0.0/8"}},
+		}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.Match(tt.query, doc); got != tt.want {
+				t.Errorf("Engine.Match() = %v, want %v", got, tt.want)
+			}
+
+			q, err := e.Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Engine.Compile() error = %v", err)
+			}
+			if got := q.Match(doc); got != tt.want {
+				t.Errorf("Query.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngineCompileValidatesCustomOperators(t *testing.T) {
+	e := NewEngine()
+	e.RegisterOperator("$ipInCIDR", ipInCIDR)
+
+	invalid := []map[string]interface{}{
+		{"ip": map[string]interface{}{"$ipInCIDR": "not-a-cidr"}},
+		{"ip": map[string]interface{}{"$ipInCIDR": 10}},
+		{"ip": map[string]interface{}{"$not": map[string]interface{}{"$ipInCIDR": "bad"}}},
+		{"$and": []interface{}{map[string]interface{}{"ip": map[string]interface{}{"$ipInCIDR": "bad"}}}},
+	}
+	for _, query := range invalid {
+		if _, err := e.Compile(query); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected ErrInvalidQuery for %v, got %v", query, err)
+		}
+		if e.Match(query, map[string]interface{}{"ip": "10.0.0.1"}) {
+			t.Errorf("Expected invalid operand not to match for %v", query)
+		}
+	}
+}
+
+func TestEngineIsolation(t *testing.T) {
+	e := NewEngine()
+	e.RegisterOperator("$ipInCIDR", ipInCIDR)
+
+	query := map[string]interface{}{"ip": map[string]interface{}{"$ipInCIDR": "10.0.0.0/8"}}
+	doc := map[string]interface{}{"ip": "10.0.0.1"}
+
+	if Match(query, doc) {
+		t.Error("Expected operator registered on one engine not to leak into the default engine")
+	}
+	if _, err := Compile(query); err == nil {
+		t.Error("Expected default engine to reject the unregistered operator")
+	}
+	if _, err := NewEngine().Compile(query); err == nil {
+		t.Error("Expected a fresh engine to reject the unregistered operator")
+	}
+}
+
+func TestEngineOverrideBuiltin(t *testing.T) {
+	e := NewEngine()
+	e.RegisterOperator("$regex", func(operand interface{}) (Predicate, error) {
+		prefix, ok := operand.(string)
+		if !ok {
+			return nil, errors.New("requires a string")
+		}
+		return func(value interface{}) bool {
+			s, ok := value.(string)
+			return ok && len(s) >= len(prefix) && s[:len(prefix)] == prefix
+		}, nil
+	})
+
+	query := map[string]interface{}{"name": map[string]interface{}{"$regex": "Jo("}}
+	if !e.Match(query, map[string]interface{}{"name": "Jo(hn"}) {
+		t.Error("Expected replaced $regex to be used")
+	}
+	if Match(query, map[string]interface{}{"name": "Jo(hn"}) {
+		t.Error("Expected default engine to keep the built-in $regex")
+	}
+}
+
+func TestRegisterOperatorInvalidName(t *testing.T) {
+	for _, name := range []string{"ipInCIDR", "$", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected RegisterOperator(%q) to panic", name)
+				}
+			}()
+			NewEngine().RegisterOperator(name, ipInCIDR)
+		}()
+	}
+}
@@ -0,0 +1,99 @@
+package mangomatch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Explain describes how the query is evaluated, one condition per line.
+// Sibling conditions are combined with AND, as in Match.
+func (q *Query) Explain() string {
+	var sb strings.Builder
+	explainQuery(&sb, q.filter, 0)
+	return sb.String()
+}
+
+func explainQuery(sb *strings.Builder, query map[string]interface{}, depth int) {
+	keys := sortedKeys(query)
+	if len(keys) > 1 {
+		writeExplainLine(sb, depth, "AND")
+		depth++
+	}
+
+	for _, key := range keys {
+		value := query[key]
+		switch key {
+		case "$and", "$or", "$nor":
+			writeExplainLine(sb, depth, strings.ToUpper(key[1:]))
+			conditions, _ := value.([]interface{})
+			for _, condition := range conditions {
+				if condMap, ok := condition.(map[string]interface{}); ok {
+					explainQuery(sb, condMap, depth+1)
+				}
+			}
+		default:
+			explainField(sb, key, value, depth)
+		}
+	}
+}
+
+func explainField(sb *strings.Builder, field string, value interface{}, depth int) {
+	ops, ok := value.(map[string]interface{})
+	if !ok || !isOperatorMap(ops) {
+		writeExplainLine(sb, depth, fmt.Sprintf("%s $eq %s", field, formatOperand(value)))
+		return
+	}
+
+	for _, op := range sortedKeys(ops) {
+		operand := ops[op]
+		switch op {
+		case "$not":
+			writeExplainLine(sb, depth, field+" NOT")
+			if sub, ok := operand.(map[string]interface{}); ok {
+				explainField(sb, field, sub, depth+1)
+			}
+		case "$elemMatch":
+			writeExplainLine(sb, depth, field+" $elemMatch")
+			if sub, ok := operand.(map[string]interface{}); ok {
+				if isElemMatchOperators(sub) {
+					explainField(sb, "<element>", sub, depth+1)
+				} else {
+					explainQuery(sb, sub, depth+1)
+				}
+			}
+		default:
+			writeExplainLine(sb, depth, fmt.Sprintf("%s %s %s", field, op, formatOperand(operand)))
+		}
+	}
+}
+
+func writeExplainLine(sb *strings.Builder, depth int, line string) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	sb.WriteString(line)
+	sb.WriteByte('\n')
+}
+
+func formatOperand(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", val)
+	case []interface{}:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			parts[i] = formatOperand(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
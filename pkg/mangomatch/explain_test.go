@@ -0,0 +1,30 @@
+package mangomatch
+
+import "testing"
+
+func TestQueryExplain(t *testing.T) {
+	q := MustCompile(map[string]interface{}{
+		"status": "active",
+		"age":    map[string]interface{}{"$gte": 18, "$lt": 65},
+		"$or": []interface{}{
+			map[string]interface{}{"tags": map[string]interface{}{"$in": []interface{}{"a", "b"}}},
+			map[string]interface{}{"name": map[string]interface{}{"$not": map[string]interface{}{"$regex": "^test"}}},
+		},
+		"orders": map[string]interface{}{"$elemMatch": map[string]interface{}{"total": map[string]interface{}{"$gt": 100}}},
+	})
+
+	want := `AND
+  OR
+    tags $in ["a", "b"]
+    name NOT
+      name $regex "^test"
+  age $gte 18
+  age $lt 65
+  orders $elemMatch
+    total $gt 100
+  status $eq "active"
+`
+	if got := q.Explain(); got != want {
+		t.Errorf("Explain() =\n%s\nwant\n%s", got, want)
+	}
+}
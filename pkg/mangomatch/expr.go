@@ -0,0 +1,846 @@
+package mangomatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The expression language of FormatExpr and ParseExpr. Keywords are case
+// insensitive and NOT binds tighter than AND, which binds tighter than OR:
+//
+//	expr      = and { "OR" and }
+//	and       = unary { "AND" unary }
+//	unary     = "NOT" unary | "(" expr ")" | condition
+//	condition = path op
+//	op        = ( "=" | "!=" | ">" | ">=" | "<" | "<=" ) value
+//	          | [ "NOT" ] "IN" array | [ "NOT" ] "EXISTS"
+//	          | "CONTAINS" [ "ALL" ] value | "MATCHES" regex
+//	          | "SIZE" value | "TYPE" value | "MOD" value "=" value
+//	          | "ELEMMATCH" "(" [ expr ] ")" | "$" name value
+//	path      = name { "." name } | "`" any text "`"
+//	regex     = "/" pattern "/" [ "i" | "m" | "s" ... ]
+//
+// Values are Extended JSON, so {"$date": "2024-01-01T00:00:00Z"} is a date.
+// Inside ELEMMATCH a condition may leave out its path to apply to the
+// elements themselves, as in scores ELEMMATCH (> 80 AND < 90).
+
+// exprKeywords are the words that must be quoted to be used as a path
+var exprKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "EXISTS": true, "CONTAINS": true,
+	"ALL": true, "MATCHES": true, "SIZE": true, "TYPE": true, "MOD": true, "ELEMMATCH": true,
+}
+
+// exprComparisons maps the comparison symbols to their operators
+var exprComparisons = map[string]string{
+	"=": "$eq", "!=": "$ne", ">": "$gt", ">=": "$gte", "<": "$lt", "<=": "$lte",
+}
+
+// ParseError reports where ParseExpr failed
+type ParseError struct {
+	// Pos is the byte offset of the error in the input
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("mangomatch: position %d: %s", e.Pos, e.Msg)
+}
+
+// FormatExpr renders query in the expression language ParseExpr reads, such as
+// age > 30 AND (status IN ["a","b"] OR tags CONTAINS "x"). Conditions are
+// written in key order, fields before logical operators, so the output is
+// stable. A $regex and its $options, or a primitive.Regex, become MATCHES
+// /pattern/flags. It is not named Format, as the request for it had it, since
+// Format is already the input format type of streams.
+func FormatExpr(query map[string]interface{}) string {
+	return strings.Join(formatTerms(query), " AND ")
+}
+
+// formatTerms renders the conditions of query, which are ANDed together
+func formatTerms(query map[string]interface{}) []string {
+	// Fields come first, then the logical operators
+	keys := sortedKeys(query)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return !strings.HasPrefix(keys[i], "$") && strings.HasPrefix(keys[j], "$")
+	})
+
+	var terms []string
+	for _, key := range keys {
+		value := query[key]
+		clauses, _ := value.([]interface{})
+		switch key {
+		case "$and":
+			for _, clause := range clauses {
+				sub, _ := clause.(map[string]interface{})
+				terms = append(terms, formatTerms(sub)...)
+			}
+		case "$or":
+			parts := make([]string, len(clauses))
+			for i, clause := range clauses {
+				sub, _ := clause.(map[string]interface{})
+				parts[i] = formatGroup(formatTerms(sub))
+			}
+			terms = append(terms, "("+strings.Join(parts, " OR ")+")")
+		case "$nor":
+			parts := make([]string, len(clauses))
+			for i, clause := range clauses {
+				sub, _ := clause.(map[string]interface{})
+				parts[i] = formatGroup(formatTerms(sub))
+			}
+			if len(parts) == 1 {
+				terms = append(terms, "NOT "+parts[0])
+			} else {
+				terms = append(terms, "NOT ("+strings.Join(parts, " OR ")+")")
+			}
+		default:
+			terms = append(terms, formatField(formatPath(key), value)...)
+		}
+	}
+	return terms
+}
+
+// formatGroup joins terms with AND, in parentheses if there are several
+func formatGroup(terms []string) string {
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " AND ") + ")"
+}
+
+// formatField renders the condition on path, which is empty for the
+// element conditions of $elemMatch
+func formatField(path string, value interface{}) []string {
+	if re, ok := value.(primitive.Regex); ok {
+		return []string{formatTerm(path, "MATCHES", formatRegex(re.Pattern, re.Options))}
+	}
+	ops, ok := value.(map[string]interface{})
+	if !ok || !isOperatorMap(ops) {
+		return []string{formatTerm(path, "=", formatValue(value))}
+	}
+
+	// $options is written as the flags of the $regex
+	options, hasOptions := ops["$options"].(string)
+	_, hasPattern := ops["$regex"].(string)
+	var terms []string
+	for _, op := range sortedKeys(ops) {
+		operand := ops[op]
+		if op == "$options" && hasOptions && hasPattern {
+			continue
+		}
+		items, isList := operand.([]interface{})
+		sub, isDoc := operand.(map[string]interface{})
+		flag, isBool := operand.(bool)
+		pattern, isString := operand.(string)
+		re, isRegex := operand.(primitive.Regex)
+
+		var symbol string
+		for s, name := range exprComparisons {
+			if name == op {
+				symbol = s
+			}
+		}
+		switch {
+		case symbol != "":
+			terms = append(terms, formatTerm(path, symbol, formatValue(operand)))
+		case op == "$in" && isList:
+			terms = append(terms, formatTerm(path, "IN", formatValue(items)))
+		case op == "$nin" && isList:
+			terms = append(terms, formatTerm(path, "NOT IN", formatValue(items)))
+		case op == "$exists" && isBool && flag:
+			terms = append(terms, formatTerm(path, "EXISTS", ""))
+		case op == "$exists" && isBool:
+			terms = append(terms, formatTerm(path, "NOT EXISTS", ""))
+		case op == "$all" && isList && len(items) > 0 && isElemMatchClause(items[0]):
+			// Each clause must be met, by any element
+			for _, item := range items {
+				clause, _ := item.(map[string]interface{})
+				terms = append(terms, formatField(path, clause)...)
+			}
+		case op == "$all" && len(items) == 1:
+			terms = append(terms, formatTerm(path, "CONTAINS", formatValue(items[0])))
+		case op == "$all" && isList:
+			terms = append(terms, formatTerm(path, "CONTAINS ALL", formatValue(items)))
+		case op == "$regex" && isString:
+			terms = append(terms, formatTerm(path, "MATCHES", formatRegex(pattern, options)))
+		case op == "$regex" && isRegex:
+			terms = append(terms, formatTerm(path, "MATCHES", formatRegex(re.Pattern, re.Options)))
+		case op == "$size":
+			terms = append(terms, formatTerm(path, "SIZE", formatValue(operand)))
+		case op == "$type":
+			terms = append(terms, formatTerm(path, "TYPE", formatValue(operand)))
+		case op == "$mod" && len(items) == 2:
+			terms = append(terms, formatTerm(path, "MOD", formatValue(items[0])+" = "+formatValue(items[1])))
+		case op == "$not" && isOperatorMap(sub):
+			terms = append(terms, "NOT "+formatGroup(formatField(path, sub)))
+		case op == "$elemMatch" && isDoc:
+			var inner []string
+			if isElemMatchOperators(sub) {
+				inner = formatField("", sub)
+			} else {
+				inner = formatTerms(sub)
+			}
+			terms = append(terms, formatTerm(path, "ELEMMATCH", "("+strings.Join(inner, " AND ")+")"))
+		default:
+			terms = append(terms, formatTerm(path, op, formatValue(operand)))
+		}
+	}
+	return terms
+}
+
+// formatRegex writes pattern as /pattern/flags
+func formatRegex(pattern, options string) string {
+	flags := []byte(options)
+	sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+	return "/" + strings.ReplaceAll(pattern, "/", `\/`) + "/" + string(flags)
+}
+
+func isElemMatchClause(item interface{}) bool {
+	clause, ok := item.(map[string]interface{})
+	_, has := clause["$elemMatch"]
+	return ok && has && len(clause) == 1
+}
+
+func formatTerm(path, op, operand string) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{path, op, operand} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatPath quotes path with backticks unless it reads as a bare path
+func formatPath(path string) string {
+	if isBarePath(path) {
+		return path
+	}
+	return "`" + strings.ReplaceAll(path, "`", "``") + "`"
+}
+
+func isBarePath(path string) bool {
+	if path == "" || exprKeywords[strings.ToUpper(path)] {
+		return false
+	}
+	for i, r := range path {
+		if !isPathRune(r) || (i == 0 && !unicode.IsLetter(r) && r != '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func isPathRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+// formatValue renders value as relaxed Extended JSON with sorted keys
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool, int, int64:
+		return fmt.Sprint(v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			break
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			// Keep the value a double when it is read back
+			s += ".0"
+		}
+		return s
+	case string:
+		b, _ := json.Marshal(v)
+		return string(b)
+	case time.Time:
+		return `{"$date": "` + v.UTC().Format(time.RFC3339Nano) + `"}`
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = formatValue(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]interface{}:
+		parts := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			parts = append(parts, formatValue(key)+": "+formatValue(v[key]))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+
+	b, err := bson.MarshalExtJSON(bson.M{"v": MapBSON(value)}, false, false)
+	if err != nil {
+		return "null"
+	}
+	// Strip the {"v": ...} wrapper
+	return strings.TrimSuffix(strings.TrimPrefix(string(b), `{"v":`), "}")
+}
+
+// ParseExpr parses an expression such as age > 30 AND tags CONTAINS "x"
+// into a query document. The grammar is described above FormatExpr. Syntax
+// errors are *ParseError values giving the position in s.
+func ParseExpr(s string) (map[string]interface{}, error) {
+	return defaultEngine.ParseExpr(s)
+}
+
+// ParseExpr is like the package-level ParseExpr, checking the query against
+// e's operators so that expressions may use custom ones
+func (e *Engine) ParseExpr(s string) (map[string]interface{}, error) {
+	p := &exprParser{s: s}
+	node, err := p.parseOr(false)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.rest(10))
+	}
+	query, err := node.query()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.Compile(query); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// exprNode is a parsed expression: a condition on one path, which is empty
+// for element conditions, or AND, OR or NOT of its children
+type exprNode struct {
+	kind     string
+	children []*exprNode
+	path     string
+	op       string
+	operand  interface{}
+	pos      int
+}
+
+// query converts n into a query document
+func (n *exprNode) query() (map[string]interface{}, error) {
+	switch n.kind {
+	case "AND":
+		out := map[string]interface{}{}
+		var clauses []interface{}
+		for _, child := range n.children {
+			sub, err := child.query()
+			if err != nil {
+				return nil, err
+			}
+			if !mergeQuery(out, sub) {
+				clauses = append(clauses, sub)
+			}
+		}
+		if len(clauses) > 0 {
+			if and, ok := out["$and"].([]interface{}); ok {
+				clauses = append(and, clauses...)
+			}
+			out["$and"] = clauses
+		}
+		return out, nil
+	case "OR":
+		clauses := make([]interface{}, len(n.children))
+		for i, child := range n.children {
+			sub, err := child.query()
+			if err != nil {
+				return nil, err
+			}
+			clauses[i] = sub
+		}
+		return map[string]interface{}{"$or": clauses}, nil
+	case "NOT":
+		// NOT over conditions on a single path is $not, which keeps the
+		// path next to its condition; anything else is $nor
+		child := n.children[0]
+		if path, ok := child.singlePath(); ok {
+			ops, err := child.operators()
+			if err == nil {
+				return map[string]interface{}{path: map[string]interface{}{"$not": ops}}, nil
+			}
+		}
+		clauses := []interface{}{}
+		for _, c := range child.disjuncts() {
+			sub, err := c.query()
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, sub)
+		}
+		return map[string]interface{}{"$nor": clauses}, nil
+	}
+
+	if n.path == "" {
+		return nil, &ParseError{Pos: n.pos, Msg: "condition without a field outside ELEMMATCH"}
+	}
+	if _, isDoc := n.operand.(map[string]interface{}); n.op == "$eq" && !isDoc {
+		return map[string]interface{}{n.path: n.operand}, nil
+	}
+	return map[string]interface{}{n.path: map[string]interface{}{n.op: n.operand}}, nil
+}
+
+// mergeQuery adds the conditions of sub to out and reports whether they
+// could be merged without changing their meaning
+func mergeQuery(out, sub map[string]interface{}) bool {
+	for key, value := range sub {
+		existing, taken := out[key]
+		if !taken {
+			continue
+		}
+		a, aOps := existing.(map[string]interface{})
+		b, bOps := value.(map[string]interface{})
+		if key == "$and" || !aOps || !bOps || !isOperatorMap(a) || !isOperatorMap(b) {
+			return false
+		}
+		for op := range b {
+			if _, dup := a[op]; dup {
+				return false
+			}
+		}
+	}
+	for key, value := range sub {
+		if existing, ok := out[key].(map[string]interface{}); ok {
+			for op, operand := range value.(map[string]interface{}) {
+				existing[op] = operand
+			}
+			continue
+		}
+		out[key] = value
+	}
+	return true
+}
+
+// singlePath reports the path all conditions of n are on, if n is made
+// only of conditions and AND and NOT of them
+func (n *exprNode) singlePath() (string, bool) {
+	switch n.kind {
+	case "":
+		return n.path, true
+	case "OR":
+		return "", false
+	}
+	path, ok := n.children[0].singlePath()
+	for _, child := range n.children[1:] {
+		p, same := child.singlePath()
+		ok = ok && same && p == path
+	}
+	return path, ok
+}
+
+// operators converts n, made of conditions on a single path, into an
+// operator document
+func (n *exprNode) operators() (map[string]interface{}, error) {
+	switch n.kind {
+	case "":
+		return map[string]interface{}{n.op: n.operand}, nil
+	case "NOT":
+		ops, err := n.children[0].operators()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"$not": ops}, nil
+	case "AND":
+		out := map[string]interface{}{}
+		for _, child := range n.children {
+			ops, err := child.operators()
+			if err != nil {
+				return nil, err
+			}
+			for op, operand := range ops {
+				if _, dup := out[op]; dup {
+					return nil, &ParseError{Pos: child.pos, Msg: "operator " + op + " repeated on the same element"}
+				}
+				out[op] = operand
+			}
+		}
+		return out, nil
+	}
+	return nil, &ParseError{Pos: n.pos, Msg: "OR between conditions without a field"}
+}
+
+// disjuncts returns the children of an OR, or n itself
+func (n *exprNode) disjuncts() []*exprNode {
+	if n.kind == "OR" {
+		return n.children
+	}
+	return []*exprNode{n}
+}
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return &ParseError{Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// rest returns up to n bytes of the remaining input, for error messages
+func (p *exprParser) rest(n int) string {
+	if p.pos >= len(p.s) {
+		return "end of input"
+	}
+	if p.pos+n < len(p.s) {
+		return p.s[p.pos:p.pos+n] + "..."
+	}
+	return p.s[p.pos:]
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// keyword consumes the keyword kw if it comes next
+func (p *exprParser) keyword(kw string) bool {
+	p.skipSpace()
+	end := p.pos + len(kw)
+	if end > len(p.s) || !strings.EqualFold(p.s[p.pos:end], kw) {
+		return false
+	}
+	if end < len(p.s) && isPathRune(rune(p.s[end])) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// peekKeyword reports whether kw comes next without consuming it
+func (p *exprParser) peekKeyword(kw string) bool {
+	start := p.pos
+	ok := p.keyword(kw)
+	p.pos = start
+	return ok
+}
+
+func (p *exprParser) symbol(sym string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], sym) {
+		p.pos += len(sym)
+		return true
+	}
+	return false
+}
+
+// parseOr parses an expression; elements allows conditions without a path
+func (p *exprParser) parseOr(elements bool) (*exprNode, error) {
+	return p.parseList("OR", elements, p.parseAnd)
+}
+
+func (p *exprParser) parseAnd(elements bool) (*exprNode, error) {
+	return p.parseList("AND", elements, p.parseUnary)
+}
+
+func (p *exprParser) parseList(kw string, elements bool, next func(bool) (*exprNode, error)) (*exprNode, error) {
+	p.skipSpace()
+	start := p.pos
+	first, err := next(elements)
+	if err != nil {
+		return nil, err
+	}
+	node := &exprNode{kind: kw, children: []*exprNode{first}, pos: start}
+	for p.keyword(kw) {
+		child, err := next(elements)
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, child)
+	}
+	if len(node.children) == 1 {
+		return first, nil
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseUnary(elements bool) (*exprNode, error) {
+	p.skipSpace()
+	start := p.pos
+	if p.keyword("NOT") {
+		// NOT IN and NOT EXISTS are element conditions
+		if elements && (p.peekKeyword("IN") || p.peekKeyword("EXISTS")) {
+			p.pos = start
+			return p.parseCondition("", start)
+		}
+		child, err := p.parseUnary(elements)
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{kind: "NOT", children: []*exprNode{child}, pos: start}, nil
+	}
+	if p.symbol("(") {
+		node, err := p.parseOr(elements)
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, p.errorf("expected ) but found %q", p.rest(10))
+		}
+		return node, nil
+	}
+
+	path, err := p.parsePath(elements)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseCondition(path, start)
+}
+
+// parsePath reads a path, or returns "" if elements allows a condition
+// without one and an operator comes next
+func (p *exprParser) parsePath(elements bool) (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return "", p.errorf("expected a field but found end of input")
+	}
+	if p.s[p.pos] == '`' {
+		var sb strings.Builder
+		for i := p.pos + 1; i < len(p.s); i++ {
+			if p.s[i] != '`' {
+				sb.WriteByte(p.s[i])
+				continue
+			}
+			if i+1 < len(p.s) && p.s[i+1] == '`' {
+				sb.WriteByte('`')
+				i++
+				continue
+			}
+			if sb.Len() == 0 {
+				return "", p.errorf("empty field name")
+			}
+			p.pos = i + 1
+			return sb.String(), nil
+		}
+		return "", p.errorf("unterminated field name")
+	}
+
+	start := p.pos
+	end := start
+	for end < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[end:])
+		if !isPathRune(r) || (end == start && unicode.IsDigit(r)) {
+			break
+		}
+		end += size
+	}
+	word := p.s[start:end]
+	if word == "" || exprKeywords[strings.ToUpper(word)] {
+		if elements {
+			return "", nil
+		}
+		if word == "" {
+			return "", p.errorf("expected a field but found %q", p.rest(10))
+		}
+		return "", p.errorf("%s is a keyword; quote the field as `%s`", word, word)
+	}
+	p.pos = end
+	return word, nil
+}
+
+// parseCondition parses the operator and operand that follow path
+func (p *exprParser) parseCondition(path string, start int) (*exprNode, error) {
+	p.skipSpace()
+	opPos := p.pos
+	cond := func(op string, operand interface{}) *exprNode {
+		return &exprNode{path: path, op: op, operand: operand, pos: start}
+	}
+
+	for _, sym := range []string{"!=", ">=", "<=", "=", ">", "<"} {
+		if p.symbol(sym) {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			return cond(exprComparisons[sym], v), nil
+		}
+	}
+
+	switch {
+	case p.keyword("NOT"):
+		switch {
+		case p.keyword("IN"):
+			v, err := p.parseArray()
+			return cond("$nin", v), err
+		case p.keyword("EXISTS"):
+			return cond("$exists", false), nil
+		}
+		return nil, p.errorf("expected IN or EXISTS after NOT")
+	case p.keyword("IN"):
+		v, err := p.parseArray()
+		return cond("$in", v), err
+	case p.keyword("EXISTS"):
+		return cond("$exists", true), nil
+	case p.keyword("CONTAINS"):
+		if p.keyword("ALL") {
+			v, err := p.parseArray()
+			return cond("$all", v), err
+		}
+		v, err := p.parseValue()
+		return cond("$all", []interface{}{v}), err
+	case p.keyword("MATCHES"):
+		v, err := p.parseRegex()
+		return cond("$regex", v), err
+	case p.keyword("SIZE"):
+		v, err := p.parseValue()
+		return cond("$size", v), err
+	case p.keyword("TYPE"):
+		v, err := p.parseValue()
+		return cond("$type", v), err
+	case p.keyword("MOD"):
+		divisor, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol("=") {
+			return nil, p.errorf("expected = after the MOD divisor")
+		}
+		remainder, err := p.parseValue()
+		return cond("$mod", []interface{}{divisor, remainder}), err
+	case p.keyword("ELEMMATCH"):
+		v, err := p.parseElemMatch()
+		return cond("$elemMatch", v), err
+	}
+
+	if p.pos < len(p.s) && p.s[p.pos] == '$' {
+		end := p.pos + 1
+		for end < len(p.s) && isPathRune(rune(p.s[end])) && p.s[end] != '.' {
+			end++
+		}
+		op := p.s[p.pos:end]
+		p.pos = end
+		v, err := p.parseValue()
+		return cond(op, v), err
+	}
+
+	p.pos = opPos
+	if path == "" {
+		return nil, p.errorf("expected a field but found %q", p.rest(10))
+	}
+	return nil, p.errorf("expected an operator after %s but found %q", path, p.rest(10))
+}
+
+// parseElemMatch parses the parenthesized criteria of ELEMMATCH, which are
+// either all element conditions or all conditions on fields
+func (p *exprParser) parseElemMatch() (map[string]interface{}, error) {
+	if !p.symbol("(") {
+		return nil, p.errorf("expected ( after ELEMMATCH")
+	}
+	if p.symbol(")") {
+		return map[string]interface{}{}, nil
+	}
+	node, err := p.parseOr(true)
+	if err != nil {
+		return nil, err
+	}
+	if !p.symbol(")") {
+		return nil, p.errorf("expected ) but found %q", p.rest(10))
+	}
+
+	if path, ok := node.singlePath(); ok && path == "" {
+		return node.operators()
+	}
+	if bad := node.findElementCondition(); bad != nil {
+		return nil, &ParseError{Pos: bad.pos, Msg: "ELEMMATCH cannot mix conditions with and without a field"}
+	}
+	return node.query()
+}
+
+// findElementCondition returns a condition of n without a path
+func (n *exprNode) findElementCondition() *exprNode {
+	if n.kind == "" {
+		if n.path == "" {
+			return n
+		}
+		return nil
+	}
+	for _, child := range n.children {
+		if bad := child.findElementCondition(); bad != nil {
+			return bad
+		}
+	}
+	return nil
+}
+
+// parseValue reads one Extended JSON value
+func (p *exprParser) parseValue() (interface{}, error) {
+	p.skipSpace()
+	start := p.pos
+	dec := json.NewDecoder(strings.NewReader(p.s[start:]))
+	dec.UseNumber()
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return nil, p.errorf("expected a value but found %q", p.rest(10))
+	}
+	p.pos = start + int(dec.InputOffset())
+
+	doc, err := ParseExtJSON([]byte(`{"v": ` + string(raw) + `}`))
+	if err != nil {
+		return nil, &ParseError{Pos: start, Msg: err.Error()}
+	}
+	return doc["v"], nil
+}
+
+// parseArray reads a value that must be an array
+func (p *exprParser) parseArray() (interface{}, error) {
+	p.skipSpace()
+	start := p.pos
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.([]interface{}); !ok {
+		return nil, &ParseError{Pos: start, Msg: "expected an array"}
+	}
+	return v, nil
+}
+
+// parseRegex reads /pattern/flags; the flags i, m and s become a (?ims)
+// prefix of the pattern
+func (p *exprParser) parseRegex() (string, error) {
+	p.skipSpace()
+	if !p.symbol("/") {
+		return "", p.errorf("expected a /regular expression/")
+	}
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return "", p.errorf("unterminated regular expression")
+		}
+		c := p.s[p.pos]
+		p.pos++
+		if c == '/' {
+			break
+		}
+		if c == '\\' && p.pos < len(p.s) && p.s[p.pos] == '/' {
+			c = '/'
+			p.pos++
+		}
+		sb.WriteByte(c)
+	}
+
+	var flags []byte
+	for p.pos < len(p.s) && isPathRune(rune(p.s[p.pos])) {
+		flag := p.s[p.pos]
+		if !strings.ContainsRune("ims", rune(flag)) {
+			return "", p.errorf("unknown regular expression flag %q", flag)
+		}
+		flags = append(flags, flag)
+		p.pos++
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+	if len(flags) > 0 {
+		return "(?" + string(flags) + ")" + sb.String(), nil
+	}
+	return sb.String(), nil
+}
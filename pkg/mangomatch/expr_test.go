@@ -0,0 +1,219 @@
+package mangomatch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{name: "Equality", expr: `status = "open"`, want: `{"status": "open"}`},
+		{name: "Comparisons", expr: `age > 30 AND age <= 65 AND n != 1.5`, want: `{"age": {"$gt": 30, "$lte": 65}, "n": {"$ne": 1.5}}`},
+		{name: "Repeated operator", expr: `a > 1 AND a > 2`, want: `{"a": {"$gt": 1}, "$and": [{"a": {"$gt": 2}}]}`},
+		{name: "Precedence", expr: `a = 1 OR b = 2 AND c = 3`, want: `{"$or": [{"a": 1}, {"b": 2, "c": 3}]}`},
+		{name: "Grouping", expr: `(a = 1 OR b = 2) AND c = 3`, want: `{"$or": [{"a": 1}, {"b": 2}], "c": 3}`},
+		{name: "Keywords are case insensitive", expr: `a in [1, 2] and b not in [3] or c exists`, want: `{"$or": [{"a": {"$in": [1, 2]}, "b": {"$nin": [3]}}, {"c": {"$exists": true}}]}`},
+		{name: "NOT EXISTS", expr: `deleted NOT EXISTS`, want: `{"deleted": {"$exists": false}}`},
+		{name: "CONTAINS", expr: `tags CONTAINS "x"`, want: `{"tags": {"$all": ["x"]}}`},
+		{name: "CONTAINS ALL", expr: `tags CONTAINS ALL ["x", "y"]`, want: `{"tags": {"$all": ["x", "y"]}}`},
+		{name: "MATCHES", expr: `name MATCHES /^a\/b/i`, want: `{"name": {"$regex": "(?i)^a/b"}}`},
+		{name: "SIZE, TYPE and MOD", expr: `tags SIZE 2 AND n TYPE "int" AND n MOD 4 = 1`, want: `{"tags": {"$size": 2}, "n": {"$type": "int", "$mod": [4, 1]}}`},
+		{name: "NOT on one field", expr: `NOT name MATCHES /^a/`, want: `{"name": {"$not": {"$regex": "^a"}}}`},
+		{name: "NOT on a range", expr: `NOT (age > 1 AND age < 5)`, want: `{"age": {"$not": {"$gt": 1, "$lt": 5}}}`},
+		{name: "NOT on several fields", expr: `NOT (a = 1 OR b = 2)`, want: `{"$nor": [{"a": 1}, {"b": 2}]}`},
+		{name: "ELEMMATCH on elements", expr: `scores ELEMMATCH (> 80 AND < 90)`, want: `{"scores": {"$elemMatch": {"$gt": 80, "$lt": 90}}}`},
+		{name: "ELEMMATCH NOT IN", expr: `scores ELEMMATCH (NOT IN [1] AND NOT = 2)`, want: `{"scores": {"$elemMatch": {"$nin": [1], "$not": {"$eq": 2}}}}`},
+		{name: "ELEMMATCH on documents", expr: `items ELEMMATCH (sku = "x" OR qty > 2)`, want: `{"items": {"$elemMatch": {"$or": [{"sku": "x"}, {"qty": {"$gt": 2}}]}}}`},
+		{name: "Empty ELEMMATCH", expr: `items ELEMMATCH ()`, want: `{"items": {"$elemMatch": {}}}`},
+		{name: "Quoted field", expr: "`order` = 1 AND `a b` = 2", want: `{"order": 1, "a b": 2}`},
+		{name: "Dotted path", expr: `address.city = "Paris" AND items.0.qty > 1`, want: `{"address.city": "Paris", "items.0.qty": {"$gt": 1}}`},
+		{name: "Document value", expr: `a = {"x": 1}`, want: `{"a": {"$eq": {"x": 1}}}`},
+		{name: "Extended JSON value", expr: `at >= {"$date": "2024-01-01T00:00:00Z"}`, want: `{"at": {"$gte": {"$date": "2024-01-01T00:00:00Z"}}}`},
+		{name: "Generic operator", expr: `n $gte 3`, want: `{"n": {"$gte": 3}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := parseQuery(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseExpr() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{expr: ``, pos: 0},
+		{expr: `age >`, pos: 5},
+		{expr: `age > x`, pos: 6},
+		{expr: `age 30`, pos: 4},
+		{expr: `a = 1 b = 2`, pos: 6},
+		{expr: `(a = 1`, pos: 6},
+		{expr: `in = 1`, pos: 0},
+		{expr: `a IN 1`, pos: 5},
+		{expr: `a NOT 1`, pos: 6},
+		{expr: `a MATCHES /x/g`, pos: 13},
+		{expr: `a MATCHES /x`, pos: 12},
+		{expr: `a MOD 2 1`, pos: 8},
+		{expr: `a = 1 AND > 2`, pos: 10},
+		{expr: `a ELEMMATCH (> 1 OR < 0)`, pos: 13},
+		{expr: `a ELEMMATCH (> 1 AND b = 2)`, pos: 13},
+		{expr: "`a = 1", pos: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseExpr(tt.expr)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("ParseExpr() error = %v, want a *ParseError", err)
+			}
+			if pe.Pos != tt.pos {
+				t.Errorf("ParseExpr() error at %d, want %d: %v", pe.Pos, tt.pos, err)
+			}
+		})
+	}
+
+	// Well-formed expressions can still be invalid queries
+	if _, err := ParseExpr(`a SIZE "x"`); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("ParseExpr() error = %v, want ErrInvalidQuery", err)
+	}
+	if _, err := ParseExpr(`a $even true`); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("ParseExpr() error = %v, want ErrInvalidQuery", err)
+	}
+
+	e := NewEngine()
+	e.RegisterOperator("$even", func(operand interface{}) (Predicate, error) {
+		want, _ := operand.(bool)
+		return func(value interface{}) bool {
+			n, ok := value.(int)
+			return ok && (n%2 == 0) == want
+		}, nil
+	})
+	query, err := e.ParseExpr(`a $even true`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q, err := e.Compile(query); err != nil || !q.Match(map[string]interface{}{"a": 4}) {
+		t.Error("custom operator did not match")
+	}
+}
+
+func TestFormatExprRoundTrip(t *testing.T) {
+	docs := []string{
+		`{}`,
+		`{"age": 25, "status": "a", "tags": ["x", "y"], "name": "ann"}`,
+		`{"age": 40, "status": "b", "tags": ["x"], "name": "Bob", "n": 9}`,
+		`{"age": 70, "status": "c", "tags": [], "name": "a/b", "deleted": true, "n": 4.0}`,
+		`{"age": [10, 50], "tags": "x", "scores": [82, 95], "n": 5}`,
+		`{"scores": [55, 85], "items": [{"sku": "x", "qty": 1}, {"sku": "y", "qty": 5}]}`,
+		`{"items": [{"sku": "z", "qty": 3}], "a b": 1, "order": {"x": 1}, "at": {"$date": "2024-06-01T00:00:00Z"}}`,
+	}
+	queries := []string{
+		`{"age": {"$gt": 30}, "$or": [{"status": {"$in": ["a", "b"]}}, {"tags": {"$all": ["x"]}}]}`,
+		`{"age": {"$gte": 20, "$lt": 60}, "status": {"$ne": "c"}}`,
+		`{"status": {"$nin": ["a"]}, "deleted": {"$exists": false}}`,
+		`{"tags": {"$all": ["x", "y"]}, "tags.0": "x"}`,
+		`{"tags": {"$size": 0}}`,
+		`{"name": {"$regex": "^a"}}`,
+		`{"name": {"$regex": "(?i)^b"}}`,
+		`{"name": {"$regex": "a/b"}}`,
+		`{"name": {"$regex": "^B", "$options": "i"}}`,
+		`{"name": {"$regex": {"$regularExpression": {"pattern": "^A", "options": "i"}}}}`,
+		`{"name": {"$regularExpression": {"pattern": "^a", "options": ""}}}`,
+		`{"name": {"$not": {"$regex": "^b", "$options": "i"}}}`,
+		`{"name": {"$not": {"$regex": "^a"}}}`,
+		`{"age": {"$not": {"$gt": 20, "$lt": 60}}}`,
+		`{"n": {"$type": "double"}}`,
+		`{"n": {"$type": ["int", "long"]}}`,
+		`{"n": {"$mod": [2, 1]}}`,
+		`{"scores": {"$elemMatch": {"$gt": 80, "$lt": 90}}}`,
+		`{"scores": {"$elemMatch": {"$not": {"$gt": 80}}}}`,
+		`{"items": {"$elemMatch": {"sku": "y", "qty": {"$gt": 2}}}}`,
+		`{"items": {"$elemMatch": {"$or": [{"sku": "z"}, {"qty": 1}]}}}`,
+		`{"items": {"$elemMatch": {}}}`,
+		`{"items": {"$all": [{"$elemMatch": {"sku": "x"}}, {"$elemMatch": {"qty": 5}}]}}`,
+		`{"$nor": [{"status": "a"}, {"tags": "y"}]}`,
+		`{"$nor": [{"status": "a", "age": 25}]}`,
+		`{"$and": [{"age": {"$gt": 1}}, {"age": {"$gt": 30}}]}`,
+		`{"$or": [{"$and": [{"n": 5}, {"age": {"$lt": 20}}]}, {"n": 9}]}`,
+		`{"a b": 1, "order": {"x": 1}}`,
+		`{"n": 4.0}`,
+		`{"at": {"$gt": {"$date": "2024-01-01T00:00:00Z"}}}`,
+		`{"status": null}`,
+	}
+
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			query := parseQuery(t, q)
+			s := FormatExpr(query)
+			parsed, err := ParseExpr(s)
+			if err != nil {
+				t.Fatalf("ParseExpr(%s): %v", s, err)
+			}
+			// $and clauses may be merged, after which the text is fixed
+			s = FormatExpr(parsed)
+			if again, err := ParseExpr(s); err != nil || FormatExpr(again) != s {
+				t.Errorf("FormatExpr() is not stable: %s, then %v, %v", s, again, err)
+			}
+			for _, d := range docs {
+				doc := parseQuery(t, d)
+				if want, got := Match(query, doc), Match(parsed, doc); got != want {
+					t.Errorf("ParseExpr(%s) matches %s: %v, want %v", s, d, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatExprRegexOptions(t *testing.T) {
+	tests := []struct {
+		query map[string]interface{}
+		want  string
+	}{
+		{map[string]interface{}{"a": map[string]interface{}{"$regex": "x", "$options": "si"}}, "a MATCHES /x/is"},
+		{map[string]interface{}{"a": map[string]interface{}{"$regex": primitive.Regex{Pattern: "x/y", Options: "m"}}}, `a MATCHES /x\/y/m`},
+		{map[string]interface{}{"a": primitive.Regex{Pattern: "x", Options: "i"}}, "a MATCHES /x/i"},
+	}
+	for _, tt := range tests {
+		if got := FormatExpr(tt.query); got != tt.want {
+			t.Errorf("FormatExpr(%v) = %s, want %s", tt.query, got, tt.want)
+		}
+		if _, err := ParseExpr(tt.want); err != nil {
+			t.Errorf("ParseExpr(%s): %v", tt.want, err)
+		}
+	}
+}
+
+func ExampleFormatExpr() {
+	query := map[string]interface{}{
+		"age": map[string]interface{}{"$gt": 30},
+		"$or": []interface{}{
+			map[string]interface{}{"status": map[string]interface{}{"$in": []interface{}{"a", "b"}}},
+			map[string]interface{}{"tags": map[string]interface{}{"$all": []interface{}{"x"}}},
+		},
+	}
+	fmt.Println(FormatExpr(query))
+	// Output: age > 30 AND (status IN ["a", "b"] OR tags CONTAINS "x")
+}
+
+func ExampleParseExpr() {
+	query, _ := ParseExpr(`age > 30 AND (status IN ["a", "b"] OR tags CONTAINS "x")`)
+	fmt.Println(Match(query, map[string]interface{}{"age": 42, "tags": []interface{}{"x"}}))
+	// Output: true
+}
@@ -0,0 +1,78 @@
+package mangomatch
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// ParseExtJSON parses a MongoDB Extended JSON document, in canonical or
+// relaxed form, into the types Match compares. Plain JSON is valid relaxed
+// Extended JSON, so this also works for ordinary JSON objects. Typed values
+// such as {"$date": ...} become time.Time, and numbers become int, int64 for
+// longs, or float64.
+func ParseExtJSON(data []byte) (map[string]interface{}, error) {
+	var raw bson.Raw
+	if err := bson.UnmarshalExtJSON(data, false, &raw); err != nil {
+		return nil, err
+	}
+	doc, _ := decodeRawValue(bson.RawValue{Type: bsontype.EmbeddedDocument, Value: raw}).(map[string]interface{})
+	return doc, nil
+}
+
+// ParsePipeline parses an Extended JSON array of aggregation stages for
+// Aggregate. Values are decoded as in ParseExtJSON, except that $sort
+// specifications are kept as an ordered bson.D.
+func ParsePipeline(data []byte) ([]interface{}, error) {
+	// Extended JSON must be a document at the top level
+	wrapped := make([]byte, 0, len(data)+13)
+	wrapped = append(wrapped, `{"pipeline":`...)
+	wrapped = append(wrapped, data...)
+	wrapped = append(wrapped, '}')
+
+	var raw bson.Raw
+	if err := bson.UnmarshalExtJSON(wrapped, false, &raw); err != nil {
+		return nil, err
+	}
+	arr, ok := raw.Lookup("pipeline").ArrayOK()
+	if !ok {
+		return nil, errors.New("mangomatch: pipeline must be an array")
+	}
+	values, err := arr.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := make([]interface{}, len(values))
+	for i, value := range values {
+		stageDoc, ok := value.DocumentOK()
+		if !ok {
+			return nil, fmt.Errorf("mangomatch: pipeline stage %d must be a document", i)
+		}
+		elements, err := stageDoc.Elements()
+		if err != nil {
+			return nil, err
+		}
+		stage := make(map[string]interface{}, len(elements))
+		for _, elem := range elements {
+			stage[elem.Key()] = decodeRawValue(elem.Value())
+			if spec, ok := elem.Value().DocumentOK(); ok && elem.Key() == "$sort" {
+				stage[elem.Key()] = orderedRawDocument(spec)
+			}
+		}
+		pipeline[i] = stage
+	}
+	return pipeline, nil
+}
+
+// orderedRawDocument decodes the top level of doc into a bson.D
+func orderedRawDocument(doc bson.Raw) bson.D {
+	elements, _ := doc.Elements()
+	out := make(bson.D, len(elements))
+	for i, elem := range elements {
+		out[i] = bson.E{Key: elem.Key(), Value: decodeRawValue(elem.Value())}
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package mangomatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExtJSON(t *testing.T) {
+	doc, err := ParseExtJSON([]byte(`{
+		"name": "John",
+		"age": 30,
+		"big": 3000000000,
+		"score": {"$numberDouble": "4.5"},
+		"created": {"$date": "2024-01-02T03:04:05Z"},
+		"tags": ["a", "b"],
+		"address": {"city": "New York"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["age"] != 30 || doc["big"] != int64(3000000000) || doc["score"] != 4.5 {
+		t.Errorf("Expected numbers to decode as int, int64 and float64, got %#v %#v %#v", doc["age"], doc["big"], doc["score"])
+	}
+	if created, ok := doc["created"].(time.Time); !ok || !created.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Expected $date to decode as time.Time, got %#v", doc["created"])
+	}
+
+	query, err := ParseExtJSON([]byte(`{"created": {"$lt": {"$date": "2025-01-01T00:00:00Z"}}, "tags": {"$in": ["b"]}, "address.city": "New York"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Match(query, doc) {
+		t.Error("Expected Extended JSON query to match Extended JSON document")
+	}
+}
+
+func TestParseExtJSONInvalid(t *testing.T) {
+	for _, input := range []string{`{"a":`, `[1, 2]`, `"text"`, ``} {
+		if _, err := ParseExtJSON([]byte(input)); err == nil {
+			t.Errorf("Expected ParseExtJSON(%q) to fail", input)
+		}
+	}
+}
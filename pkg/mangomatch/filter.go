@@ -0,0 +1,86 @@
+package mangomatch
+
+// Filter returns the items that match query, preserving their order. The
+// query is compiled once; see Compile for the accepted forms. Pass a *Query
+// built with WithAccessor to read items of a custom type.
+func Filter[T any](items []T, query interface{}) ([]T, error) {
+	q, err := Compile(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []T
+	for _, item := range items {
+		if q.Match(item) {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// First returns the first item that matches query
+func First[T any](items []T, query interface{}) (T, bool, error) {
+	var zero T
+	q, err := Compile(query)
+	if err != nil {
+		return zero, false, err
+	}
+
+	for _, item := range items {
+		if q.Match(item) {
+			return item, true, nil
+		}
+	}
+	return zero, false, nil
+}
+
+// Count returns the number of items that match query
+func Count[T any](items []T, query interface{}) (int, error) {
+	q, err := Compile(query)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, item := range items {
+		if q.Match(item) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Partition splits items into those that match query and those that don't
+func Partition[T any](items []T, query interface{}) (matched []T, rest []T, err error) {
+	q, err := Compile(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, item := range items {
+		if q.Match(item) {
+			matched = append(matched, item)
+		} else {
+			rest = append(rest, item)
+		}
+	}
+	return matched, rest, nil
+}
+
+// FilterSeq lazily filters an iterator. Both seq and the result have the
+// shape of iter.Seq[T], so they work with range-over-func and slices.Values.
+func FilterSeq[T any](seq func(yield func(T) bool), query interface{}) (func(yield func(T) bool), error) {
+	q, err := Compile(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(T) bool) {
+		seq(func(item T) bool {
+			if !q.Match(item) {
+				return true
+			}
+			return yield(item)
+		})
+	}, nil
+}
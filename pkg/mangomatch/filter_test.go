@@ -0,0 +1,125 @@
+package mangomatch
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFilterHelpers(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"name": "John", "age": 35},
+		{"name": "Jane", "age": 25},
+		{"name": "Bob", "age": 45},
+	}
+	query := map[string]interface{}{"age": map[string]interface{}{"$gt": 30}}
+
+	matched, err := Filter(docs, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 2 || matched[0]["name"] != "John" || matched[1]["name"] != "Bob" {
+		t.Errorf("Filter() = %v", matched)
+	}
+
+	first, ok, err := First(docs, query)
+	if err != nil || !ok || first["name"] != "John" {
+		t.Errorf("First() = %v, %v, %v", first, ok, err)
+	}
+
+	if _, ok, _ := First(docs, map[string]interface{}{"age": 99}); ok {
+		t.Error("Expected First() to report no match")
+	}
+
+	count, err := Count(docs, query)
+	if err != nil || count != 2 {
+		t.Errorf("Count() = %d, %v", count, err)
+	}
+
+	in, out, err := Partition(docs, query)
+	if err != nil || len(in) != 2 || len(out) != 1 || out[0]["name"] != "Jane" {
+		t.Errorf("Partition() = %v, %v, %v", in, out, err)
+	}
+}
+
+func TestFilterStructsAndBSON(t *testing.T) {
+	users := []testUser{
+		{Name: "John", Age: 35, Tags: []string{"premium"}},
+		{Name: "Jane", Age: 25},
+	}
+	matched, err := Filter(users, bson.D{{Key: "tags", Value: "premium"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 1 || matched[0].Name != "John" {
+		t.Errorf("Filter() on structs = %v", matched)
+	}
+
+	docs := []bson.D{
+		{{Key: "status", Value: "active"}},
+		{{Key: "status", Value: "inactive"}},
+	}
+	count, err := Count(docs, bson.M{"status": "active"})
+	if err != nil || count != 1 {
+		t.Errorf("Count() on bson.D = %d, %v", count, err)
+	}
+}
+
+func TestFilterInvalidQuery(t *testing.T) {
+	docs := []map[string]interface{}{{"a": 1}}
+	invalid := map[string]interface{}{"a": map[string]interface{}{"$bogus": 1}}
+
+	if _, err := Filter(docs, invalid); err == nil {
+		t.Error("Expected Filter() to return an error")
+	}
+	if _, _, err := First(docs, invalid); err == nil {
+		t.Error("Expected First() to return an error")
+	}
+	if _, err := Count(docs, invalid); err == nil {
+		t.Error("Expected Count() to return an error")
+	}
+	if _, _, err := Partition(docs, invalid); err == nil {
+		t.Error("Expected Partition() to return an error")
+	}
+	if _, err := FilterSeq(sliceSeq(docs), invalid); err == nil {
+		t.Error("Expected FilterSeq() to return an error")
+	}
+}
+
+func TestFilterSeq(t *testing.T) {
+	nums := []map[string]interface{}{{"n": 1}, {"n": 2}, {"n": 3}, {"n": 4}}
+	seq, err := FilterSeq(sliceSeq(nums), map[string]interface{}{"n": map[string]interface{}{"$mod": []interface{}{2, 0}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []interface{}
+	seq(func(doc map[string]interface{}) bool {
+		got = append(got, doc["n"])
+		return true
+	})
+	if !reflect.DeepEqual(got, []interface{}{2, 4}) {
+		t.Errorf("FilterSeq() yielded %v", got)
+	}
+
+	// Stopping early must stop the underlying iteration
+	visited := 0
+	seq(func(doc map[string]interface{}) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("Expected iteration to stop after first item, visited %d", visited)
+	}
+}
+
+func sliceSeq[T any](items []T) func(yield func(T) bool) {
+	return func(yield func(T) bool) {
+		for _, item := range items {
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
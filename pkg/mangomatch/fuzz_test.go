@@ -0,0 +1,210 @@
+package mangomatch
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The fuzz targets run their seeds as part of go test; to fuzz one:
+//
+//	go test -run '^$' -fuzz FuzzMatch ./pkg/mangomatch
+
+// extJSON encodes v as relaxed Extended JSON for seeding
+func extJSON(t testing.TB, v map[string]interface{}) string {
+	t.Helper()
+	b, err := bson.MarshalExtJSON(MapBSON(v), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// addMatchSeeds seeds f with the comprehensive tests and the conformance
+// fixtures, as query and document Extended JSON
+func addMatchSeeds(f *testing.F) {
+	doc := extJSON(f, createTestDocument())
+	for _, tc := range comprehensiveCases() {
+		f.Add(extJSON(f, tc.query), doc)
+	}
+	paths, _ := filepath.Glob(filepath.Join("testdata", "conformance", "*.json"))
+	for _, path := range paths {
+		for _, tc := range readConformanceFile(f, path).Tests {
+			f.Add(string(tc.Query), string(tc.Doc))
+		}
+	}
+	// Invalid operands on missing fields used to panic
+	f.Add(`{"a": {"$exists": 1}}`, `{}`)
+	f.Add(`{"a": {"$exists": "yes"}, "b": {"$not": 1}}`, `{"b": 1}`)
+}
+
+func FuzzMatch(f *testing.F) {
+	addMatchSeeds(f)
+	f.Fuzz(func(t *testing.T, queryJSON, docJSON string) {
+		query, err := ParseExtJSON([]byte(queryJSON))
+		if err != nil {
+			return
+		}
+		doc, err := ParseExtJSON([]byte(docJSON))
+		if err != nil {
+			return
+		}
+		got := Match(query, doc)
+
+		// $nor is the complement of $or
+		nor := map[string]interface{}{"$nor": []interface{}{query}}
+		if Match(nor, doc) == got {
+			t.Errorf("$nor of %v matches %v like the query", query, doc)
+		}
+
+		q, err := Compile(query)
+		if err != nil {
+			return
+		}
+		if q.Match(doc) != got {
+			t.Errorf("compiled %v matches %v: %v, Match %v", query, doc, !got, got)
+		}
+		normalized, err := Normalize(query)
+		if err != nil {
+			t.Fatalf("Normalize(%v): %v", query, err)
+		}
+		if MustCompile(normalized).Match(doc) != got {
+			t.Errorf("normalized %v matches %v: %v, original %v", normalized, doc, !got, got)
+		}
+
+		for key, value := range query {
+			if strings.HasPrefix(key, "$") {
+				continue
+			}
+			checkNotComplement(t, key, value, doc)
+			checkSingleIn(t, key, value, doc)
+		}
+	})
+}
+
+// checkNotComplement checks that {key: {"$not": ops}} is the complement of
+// {key: ops} where the field is present; a missing field only ever matches
+// {"$exists": false}
+func checkNotComplement(t *testing.T, key string, value interface{}, doc map[string]interface{}) {
+	if _, ok := MapDocument(doc).Lookup(strings.Split(key, ".")); !ok {
+		return
+	}
+	ops, ok := value.(map[string]interface{})
+	if !ok || !isOperatorMap(ops) {
+		ops = map[string]interface{}{"$eq": value}
+	}
+	cond := map[string]interface{}{key: ops}
+	not := map[string]interface{}{key: map[string]interface{}{"$not": ops}}
+	if _, err := Compile(not); err != nil {
+		return
+	}
+	if Match(not, doc) == Match(cond, doc) {
+		t.Errorf("%v matches %v like %v", not, doc, cond)
+	}
+}
+
+// checkSingleIn checks that $in of one value matches like $eq of it
+func checkSingleIn(t *testing.T, key string, value interface{}, doc map[string]interface{}) {
+	operand := value
+	if ops, ok := value.(map[string]interface{}); ok {
+		if len(ops) != 1 || ops["$eq"] == nil {
+			return
+		}
+		operand = ops["$eq"]
+	}
+	switch operand.(type) {
+	case map[string]interface{}, primitive.Regex:
+		// $in matches regular expressions and reads documents as values
+		return
+	}
+	eq := map[string]interface{}{key: map[string]interface{}{"$eq": operand}}
+	in := map[string]interface{}{key: map[string]interface{}{"$in": []interface{}{operand}}}
+	if Match(eq, doc) != Match(in, doc) {
+		t.Errorf("%v and %v differ on %v", eq, in, doc)
+	}
+}
+
+func FuzzMatchBSON(f *testing.F) {
+	doc, err := bson.Marshal(MapBSON(createTestDocument()))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, tc := range comprehensiveCases() {
+		f.Add(extJSON(f, tc.query), doc)
+	}
+	f.Fuzz(func(t *testing.T, queryJSON string, data []byte) {
+		query, err := ParseExtJSON([]byte(queryJSON))
+		if err != nil {
+			return
+		}
+		raw := bson.Raw(data)
+		got := MatchBSON(query, raw)
+		if MatchRaw(query, raw) != got {
+			t.Errorf("MatchRaw and MatchBSON differ on %v", query)
+		}
+		if validateRaw(raw) != nil {
+			return
+		}
+		decoded, _ := decodeRawValue(bson.RawValue{Type: bsontype.EmbeddedDocument, Value: raw}).(map[string]interface{})
+		if Match(query, decoded) != got {
+			t.Errorf("%v matches %v: %v, raw %v", query, decoded, !got, got)
+		}
+	})
+}
+
+func FuzzParseExtJSON(f *testing.F) {
+	f.Add(extJSON(f, createTestDocument()))
+	for _, tc := range comprehensiveCases() {
+		f.Add(extJSON(f, tc.query))
+	}
+	f.Add(`{"d": {"$date": "2024-01-01T00:00:00Z"}, "o": {"$oid": "5f1d7e3b9c1e4a2b3c4d5e6f"}, "n": {"$numberDouble": "NaN"}}`)
+	f.Add(`{"l": {"$numberLong": "9007199254740993"}, "r": {"$regularExpression": {"pattern": "^a", "options": "i"}}}`)
+	f.Fuzz(func(t *testing.T, data string) {
+		doc, err := ParseExtJSON([]byte(data))
+		if err != nil || !utf8.ValidString(data) {
+			// Invalid UTF-8 is replaced when encoding
+			return
+		}
+		// Parsed documents encode and parse back to the same values
+		encoded, err := bson.MarshalExtJSON(MapBSON(doc), true, false)
+		if err != nil {
+			t.Fatalf("MarshalExtJSON(%v): %v", doc, err)
+		}
+		again, err := ParseExtJSON(encoded)
+		if err != nil {
+			t.Fatalf("ParseExtJSON(%s): %v", encoded, err)
+		}
+		if fmt.Sprint(again) != fmt.Sprint(doc) {
+			t.Errorf("round trip of %s gave %v, want %v", data, again, doc)
+		}
+	})
+}
+
+// FuzzAggregate fuzzes pipelines over the comprehensive test document. The
+// package has no update operators, so Aggregate is the only API that
+// rewrites documents.
+func FuzzAggregate(f *testing.F) {
+	for _, pipeline := range []string{
+		`[{"$match": {"age": {"$gt": 30}}}]`,
+		`[{"$project": {"name": 1, "address.city": 1}}, {"$sort": {"name": -1}}]`,
+		`[{"$unwind": "$tags"}, {"$group": {"_id": "$tags", "n": {"$sum": 1}}}]`,
+		`[{"$skip": 1}, {"$limit": 2}, {"$count": "n"}]`,
+	} {
+		f.Add(pipeline)
+	}
+	doc := createTestDocument()
+	f.Fuzz(func(t *testing.T, data string) {
+		pipeline, err := ParsePipeline([]byte(data))
+		if err != nil {
+			return
+		}
+		// Invalid stages are errors, never panics
+		_, _ = Aggregate([]map[string]interface{}{doc, {"age": 20}}, pipeline)
+	})
+}
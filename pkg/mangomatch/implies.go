@@ -0,0 +1,655 @@
+package mangomatch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrUndecidable is wrapped by the errors Implies returns when the answer
+// depends on conditions it cannot reason about
+var ErrUndecidable = errors.New("mangomatch: implication cannot be decided")
+
+// maxImplicationCases bounds the $or combinations of a and the assignments
+// of b's conditions that Implies examines
+const maxImplicationCases = 1 << 14
+
+// Implies reports whether every document matching a also matches b, such
+// as whether a requested filter stays within the scope a user is allowed.
+// It reasons about equality, $in, $gt, $gte, $lt, $lte, $exists, $and and
+// $or, allowing for fields that hold arrays: {"age": {"$gte": 25, "$lte":
+// 25}} does not imply {"age": 25}, since {"age": [20, 30]} matches only the
+// first.
+//
+// Other operators and $nor are understood only where b repeats a condition
+// of a verbatim. When the answer depends on them, or on paths such as "a"
+// and "a.b" that overlap, Implies returns an error wrapping ErrUndecidable
+// instead of false. Like find and the $match stage, an empty a or b
+// matches every document.
+func Implies(a, b map[string]interface{}) (bool, error) {
+	na, err := Normalize(a)
+	if err != nil {
+		return false, err
+	}
+	nb, err := Normalize(b)
+	if err != nil {
+		return false, err
+	}
+
+	im := &implication{ids: make(map[string]int)}
+	goal := &formula{op: formulaAnd}
+	if len(nb) > 0 {
+		goal = im.formula(nb)
+	}
+	cases := [][]fact{nil}
+	if len(na) > 0 {
+		if cases, err = im.dnf(na); err != nil {
+			return false, err
+		}
+	}
+	im.checkOverlap(cases)
+
+	var undecided error
+	for _, facts := range cases {
+		ok, err := im.check(facts, goal)
+		if err != nil {
+			undecided = err
+			continue
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	if undecided != nil {
+		return false, undecided
+	}
+	return true, nil
+}
+
+// fact is an operator condition on a path, or a top-level $nor when path
+// is empty
+type fact struct {
+	path string
+	a    atom
+}
+
+type factKind int
+
+const (
+	factPresent factKind = iota
+	factMissing
+	// factElement is a condition met by an element of an array field
+	factElement
+	// factOpaque is a condition Implies does not reason about
+	factOpaque
+)
+
+func (f fact) kind() factKind {
+	if f.path == "" {
+		return factOpaque
+	}
+	switch f.a.op {
+	case "$exists":
+		if f.a.operand == true {
+			return factPresent
+		}
+		return factMissing
+	case "$eq", "$in", "$gt", "$gte", "$lt", "$lte":
+		return factElement
+	}
+	return factOpaque
+}
+
+func (f fact) key() string {
+	return f.path + "\x00" + f.a.op + "\x00" + string(canonicalValue(f.a.operand))
+}
+
+// fieldFacts splits the condition on path into its operators
+func fieldFacts(path string, value interface{}) []fact {
+	atoms := conditionAtoms(value)
+	facts := make([]fact, len(atoms))
+	for i, a := range atoms {
+		facts[i] = fact{path: path, a: a}
+	}
+	return facts
+}
+
+type formulaOp int
+
+const (
+	formulaAnd formulaOp = iota
+	formulaOr
+	formulaLit
+)
+
+// formula is b as a tree of the conditions it is built from
+type formula struct {
+	op       formulaOp
+	children []*formula
+	lit      int
+}
+
+func (f *formula) eval(truth []bool) bool {
+	switch f.op {
+	case formulaLit:
+		return truth[f.lit]
+	case formulaOr:
+		for _, c := range f.children {
+			if c.eval(truth) {
+				return true
+			}
+		}
+		return false
+	default:
+		for _, c := range f.children {
+			if !c.eval(truth) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+type implication struct {
+	lits  []fact // the conditions of b
+	preds []Predicate
+	ids   map[string]int
+
+	overlap string
+}
+
+func undecidable(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrUndecidable}, args...)...)
+}
+
+// formula builds the formula of a normalized query of b
+func (im *implication) formula(doc bson.D) *formula {
+	if len(doc) == 0 {
+		// An empty clause matches nothing
+		return &formula{op: formulaOr}
+	}
+	f := &formula{op: formulaAnd}
+	for _, e := range doc {
+		switch e.Key {
+		case "$and":
+			for _, clause := range e.Value.(bson.A) {
+				f.children = append(f.children, im.formula(clause.(bson.D)))
+			}
+		case "$or":
+			or := &formula{op: formulaOr}
+			for _, clause := range e.Value.(bson.A) {
+				or.children = append(or.children, im.formula(clause.(bson.D)))
+			}
+			f.children = append(f.children, or)
+		case "$nor":
+			f.children = append(f.children, im.lit(fact{a: atom{op: e.Key, operand: e.Value}}))
+		default:
+			for _, fa := range fieldFacts(e.Key, e.Value) {
+				f.children = append(f.children, im.lit(fa))
+			}
+		}
+	}
+	return f
+}
+
+func (im *implication) lit(f fact) *formula {
+	id, ok := im.ids[f.key()]
+	if !ok {
+		id = len(im.lits)
+		im.ids[f.key()] = id
+		im.lits = append(im.lits, f)
+		var pred Predicate
+		if f.kind() == factElement {
+			pred = elementPredicate(f.a)
+		}
+		im.preds = append(im.preds, pred)
+	}
+	return &formula{op: formulaLit, lit: id}
+}
+
+// dnf expands a normalized query of a into the alternative sets of facts
+// that make it match
+func (im *implication) dnf(doc bson.D) ([][]fact, error) {
+	if len(doc) == 0 {
+		return nil, nil
+	}
+	cases := [][]fact{nil}
+	for _, e := range doc {
+		var alts [][]fact
+		switch e.Key {
+		case "$and":
+			alts = [][]fact{nil}
+			for _, clause := range e.Value.(bson.A) {
+				sub, err := im.dnf(clause.(bson.D))
+				if err != nil {
+					return nil, err
+				}
+				if alts, err = productFacts(alts, sub); err != nil {
+					return nil, err
+				}
+			}
+		case "$or":
+			for _, clause := range e.Value.(bson.A) {
+				sub, err := im.dnf(clause.(bson.D))
+				if err != nil {
+					return nil, err
+				}
+				alts = append(alts, sub...)
+			}
+		case "$nor":
+			alts = [][]fact{{{a: atom{op: e.Key, operand: e.Value}}}}
+		default:
+			alts = [][]fact{fieldFacts(e.Key, e.Value)}
+		}
+		var err error
+		if cases, err = productFacts(cases, alts); err != nil {
+			return nil, err
+		}
+	}
+	return cases, nil
+}
+
+func productFacts(xs, ys [][]fact) ([][]fact, error) {
+	if len(xs)*len(ys) > maxImplicationCases {
+		return nil, undecidable("too many $or combinations")
+	}
+	out := make([][]fact, 0, len(xs)*len(ys))
+	for _, x := range xs {
+		for _, y := range ys {
+			c := make([]fact, 0, len(x)+len(y))
+			out = append(out, append(append(c, x...), y...))
+		}
+	}
+	return out, nil
+}
+
+// checkOverlap records a pair of paths where one lies inside the other,
+// whose values Implies cannot choose independently
+func (im *implication) checkOverlap(cases [][]fact) {
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	for _, l := range im.lits {
+		add(l.path)
+	}
+	for _, facts := range cases {
+		for _, f := range facts {
+			add(f.path)
+		}
+	}
+	sort.Strings(paths)
+	for i := 1; i < len(paths); i++ {
+		for j := 0; j < i; j++ {
+			if strings.HasPrefix(paths[i], paths[j]+".") {
+				im.overlap = fmt.Sprintf("paths %q and %q overlap", paths[j], paths[i])
+				return
+			}
+		}
+	}
+}
+
+// pathFacts are the facts of one case of a on a path. present is set when
+// one of them fails on a missing field, and missing when one fails on any
+// value.
+type pathFacts struct {
+	present  bool
+	missing  bool
+	elements []atom
+}
+
+// check reports whether every document matching the facts matches goal. A
+// path holds either nothing or some values, any of which may meet each
+// element condition, so the documents to try are one per combination of
+// the least sets of b's conditions that each path can make true.
+func (im *implication) check(facts []fact, goal *formula) (bool, error) {
+	uncertain := im.overlap
+	held := make(map[string]bool)
+	paths := make(map[string]*pathFacts)
+	for _, f := range facts {
+		held[f.key()] = true
+		if f.path == "" {
+			uncertain = fmt.Sprintf("a uses %s", f.a.op)
+			continue
+		}
+		p := paths[f.path]
+		if p == nil {
+			p = &pathFacts{}
+			paths[f.path] = p
+		}
+		if !holdsOnMissing([]atom{f.a}) {
+			p.present = true
+		}
+		switch f.kind() {
+		case factMissing:
+			p.missing = true
+		case factElement:
+			p.elements = append(p.elements, f.a)
+		case factOpaque:
+			uncertain = fmt.Sprintf("a uses %s", f.a.op)
+		}
+	}
+
+	// A case that no document meets implies anything
+	for _, p := range paths {
+		if p.present && !im.canBePresent(p) {
+			return true, nil
+		}
+	}
+
+	base := make([]bool, len(im.lits))
+	byPath := make(map[string][]int)
+	var order []string
+	for id, l := range im.lits {
+		if l.kind() == factOpaque {
+			if held[l.key()] {
+				base[id] = true
+			} else if uncertain == "" {
+				uncertain = fmt.Sprintf("b uses %s", l.a.op)
+			}
+			continue
+		}
+		if _, ok := byPath[l.path]; !ok {
+			order = append(order, l.path)
+		}
+		byPath[l.path] = append(byPath[l.path], id)
+	}
+
+	options := make([][][]bool, len(order))
+	total := 1
+	for i, path := range order {
+		opts, err := im.pathOptions(paths[path], byPath[path])
+		if err != nil {
+			return false, err
+		}
+		options[i] = opts
+		if total *= len(opts); total > maxImplicationCases {
+			return false, undecidable("too many cases")
+		}
+	}
+
+	truth := make([]bool, len(im.lits))
+	idx := make([]int, len(options))
+	for {
+		copy(truth, base)
+		for i, opts := range options {
+			union(truth, opts[idx[i]])
+		}
+		if !goal.eval(truth) {
+			if uncertain != "" {
+				return false, undecidable("%s", uncertain)
+			}
+			return false, nil
+		}
+
+		i := 0
+		for ; i < len(idx); i++ {
+			if idx[i]++; idx[i] < len(options[i]) {
+				break
+			}
+			idx[i] = 0
+		}
+		if i == len(idx) {
+			return true, nil
+		}
+	}
+}
+
+// pathOptions returns the least sets of the conditions ids, all on one
+// path, that the path can make true under p
+func (im *implication) pathOptions(p *pathFacts, ids []int) ([][]bool, error) {
+	set := func(kind factKind) []bool {
+		truth := make([]bool, len(im.lits))
+		for _, id := range ids {
+			truth[id] = im.lits[id].kind() == kind
+		}
+		return truth
+	}
+	if p == nil {
+		p = &pathFacts{}
+	}
+	var missing []bool
+	if !p.present {
+		missing = make([]bool, len(im.lits))
+		for _, id := range ids {
+			missing[id] = holdsOnMissing([]atom{im.lits[id].a})
+		}
+		if !im.canBePresent(p) {
+			return [][]bool{missing}, nil
+		}
+	}
+
+	// Present as an empty array, unless each element condition of a needs
+	// one value meeting it
+	opts := [][]bool{set(factPresent)}
+	for _, e := range p.elements {
+		var cells [][]bool
+		for _, w := range im.candidates(e, ids) {
+			truth := make([]bool, len(im.lits))
+			for _, id := range ids {
+				truth[id] = im.preds[id] != nil && im.preds[id](w)
+			}
+			cells = append(cells, truth)
+		}
+		var next [][]bool
+		for _, o := range opts {
+			for _, c := range minimalSets(cells) {
+				truth := append([]bool(nil), o...)
+				union(truth, c)
+				next = append(next, truth)
+			}
+		}
+		if opts = minimalSets(next); len(opts) > maxImplicationCases {
+			return nil, undecidable("too many cases")
+		}
+	}
+	if missing != nil {
+		opts = append(opts, missing)
+	}
+	return opts, nil
+}
+
+// canBePresent reports whether a present field can meet the facts p
+func (im *implication) canBePresent(p *pathFacts) bool {
+	if p.missing {
+		return false
+	}
+	for _, e := range p.elements {
+		if len(im.candidates(e, nil)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// candidates returns values meeting e, one for each way the element
+// conditions ids can treat such a value
+func (im *implication) candidates(e atom, ids []int) []interface{} {
+	var values []interface{}
+	switch e.op {
+	case "$eq":
+		values = []interface{}{e.operand}
+	case "$in":
+		values = e.operand.(bson.A)
+	default:
+		// Every condition is constant between the values of the family
+		// that any of them mentions
+		family := valueFamily(e.operand)
+		if family == "" {
+			return nil
+		}
+		points := []interface{}{e.operand}
+		for _, id := range ids {
+			for _, v := range atomValues(im.lits[id]) {
+				if valueFamily(v) == family {
+					points = append(points, v)
+				}
+			}
+		}
+		values = fillGaps(points)
+	}
+
+	pred := elementPredicate(e)
+	var out []interface{}
+	for _, v := range values {
+		if pred(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// atomValues returns the values an element condition compares with
+func atomValues(f fact) []interface{} {
+	if f.kind() != factElement {
+		return nil
+	}
+	if list, ok := f.a.operand.(bson.A); ok {
+		return list
+	}
+	return []interface{}{f.a.operand}
+}
+
+// fillGaps sorts values of one family and adds a value below, between and
+// above them wherever one exists
+func fillGaps(values []interface{}) []interface{} {
+	sort.Slice(values, func(i, j int) bool { return compareFamily(values[i], values[j]) < 0 })
+	var points []interface{}
+	if v, ok := stepBelow(values[0]); ok {
+		points = append(points, v)
+	}
+	for i, v := range values {
+		if i > 0 && compareFamily(values[i-1], v) == 0 {
+			continue
+		}
+		if i > 0 {
+			if m, ok := midpoint(values[i-1], v); ok {
+				points = append(points, m)
+			}
+		}
+		points = append(points, v)
+	}
+	if v, ok := stepAbove(values[len(values)-1]); ok {
+		points = append(points, v)
+	}
+	return points
+}
+
+func stepBelow(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int, float64:
+		return math.Nextafter(toFloat(v), math.Inf(-1)), true
+	case string:
+		return "", v != ""
+	case time.Time:
+		return v.Add(-time.Nanosecond), true
+	}
+	return nil, false
+}
+
+func stepAbove(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int, float64:
+		return math.Nextafter(toFloat(v), math.Inf(1)), true
+	case string:
+		return v + "\x00", true
+	case time.Time:
+		return v.Add(time.Nanosecond), true
+	}
+	return nil, false
+}
+
+// midpoint returns a value strictly between lo and hi, if there is one
+func midpoint(lo, hi interface{}) (interface{}, bool) {
+	var m []interface{}
+	switch l := lo.(type) {
+	case int, float64:
+		m = append(m, toFloat(lo)/2+toFloat(hi)/2)
+		if h, ok := hi.(int); ok {
+			if l, ok := l.(int); ok {
+				// Large ints may have no float between them
+				if l < 0 && h > 0 {
+					m = append(m, 0)
+				} else {
+					m = append(m, l+(h-l)/2)
+				}
+			}
+		}
+	case string:
+		m = append(m, l+"\x00")
+	case time.Time:
+		m = append(m, l.Add(time.Nanosecond))
+	}
+	for _, v := range m {
+		if compareFamily(lo, v) < 0 && compareFamily(v, hi) < 0 {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// elementPredicate builds the predicate of an element condition with the
+// built-in operators
+func elementPredicate(a atom) Predicate {
+	pred, err := defaultEngine.compileOperator(a.op, ConvertBSON(a.operand))
+	if err != nil {
+		return func(interface{}) bool { return false }
+	}
+	return func(value interface{}) bool {
+		return pred(value, nil)
+	}
+}
+
+// holdsOnMissing reports whether every atom holds on a missing field
+func holdsOnMissing(atoms []atom) bool {
+	for _, a := range atoms {
+		if !elementPredicate(a)(missingField{}) {
+			return false
+		}
+	}
+	return true
+}
+
+func union(dst, src []bool) {
+	for i, v := range src {
+		if v {
+			dst[i] = true
+		}
+	}
+}
+
+// minimalSets drops the sets that contain another set
+func minimalSets(sets [][]bool) [][]bool {
+	var out [][]bool
+	for i, s := range sets {
+		minimal := true
+		for j, other := range sets {
+			if i != j && subset(other, s) && (!subset(s, other) || j < i) {
+				minimal = false
+				break
+			}
+		}
+		if minimal {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func subset(a, b []bool) bool {
+	for i, v := range a {
+		if v && !b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package mangomatch
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestImplies(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+		// undecidable means Implies should report ErrUndecidable
+		undecidable bool
+	}{
+		{name: "Same query", a: `{"status": "a"}`, b: `{"status": "a"}`, want: true},
+		{name: "Equality within $in", a: `{"status": "a"}`, b: `{"status": {"$in": ["a", "b"]}}`, want: true},
+		{name: "$in within a larger $in", a: `{"status": {"$in": ["a", "b"]}}`, b: `{"status": {"$in": ["a", "b", "c"]}}`, want: true},
+		{name: "$in outside a smaller $in", a: `{"status": {"$in": ["a", "b"]}}`, b: `{"status": {"$in": ["a"]}}`, want: false},
+		{name: "Different values", a: `{"status": "a"}`, b: `{"status": "b"}`, want: false},
+		{name: "Int and float", a: `{"n": 1}`, b: `{"n": {"$in": [1.0, 2]}}`, want: true},
+		{name: "Extra condition", a: `{"status": "a", "tenant": 7}`, b: `{"tenant": 7}`, want: true},
+		{name: "Missing condition", a: `{"status": "a"}`, b: `{"status": "a", "tenant": 7}`, want: false},
+		{name: "Narrower range", a: `{"age": {"$gt": 20, "$lt": 30}}`, b: `{"age": {"$gte": 20}}`, want: true},
+		{name: "Wider range", a: `{"age": {"$gte": 20}}`, b: `{"age": {"$gt": 20}}`, want: false},
+		{name: "Range on both sides", a: `{"age": {"$gt": 20, "$lt": 30}}`, b: `{"age": {"$gte": 20, "$lte": 30}}`, want: true},
+		{name: "Equality in range", a: `{"age": 25}`, b: `{"age": {"$gt": 20, "$lt": 30}}`, want: true},
+		{name: "Range of another type", a: `{"age": {"$gt": 20}}`, b: `{"age": {"$gt": "a"}}`, want: false},
+		{name: "String range", a: `{"name": {"$gte": "b", "$lt": "c"}}`, b: `{"name": {"$gt": "a"}}`, want: true},
+		{name: "Point range is not equality on arrays", a: `{"age": {"$gte": 25, "$lte": 25}}`, b: `{"age": 25}`, want: false},
+		{name: "Equality implies presence", a: `{"a": 1}`, b: `{"a": {"$exists": true}}`, want: true},
+		{name: "Null matches a missing field", a: `{"a": {"$exists": false}}`, b: `{"a": null}`, want: true},
+		{name: "Null is not presence", a: `{"a": null}`, b: `{"a": {"$exists": true}}`, want: false},
+		{name: "$gte null is null", a: `{"a": {"$gte": null}}`, b: `{"a": {"$in": [null, 1]}}`, want: true},
+		{name: "Presence does not imply equality", a: `{"a": {"$exists": true}}`, b: `{"a": 1}`, want: false},
+		{name: "Missing", a: `{"a": {"$exists": false}, "b": 1}`, b: `{"a": {"$exists": false}}`, want: true},
+		{name: "Missing is not present", a: `{"a": {"$exists": false}}`, b: `{"a": {"$exists": true}}`, want: false},
+		{name: "Every $or branch implies b", a: `{"$or": [{"a": 1}, {"a": 2}]}`, b: `{"a": {"$in": [1, 2]}}`, want: true},
+		{name: "One $or branch does not", a: `{"$or": [{"a": 1}, {"a": 3}]}`, b: `{"a": {"$in": [1, 2]}}`, want: false},
+		{name: "$in implies an $or", a: `{"a": {"$in": [1, 2]}}`, b: `{"$or": [{"a": 1}, {"a": 2}]}`, want: true},
+		{name: "Range split by an $or", a: `{"a": {"$gt": 0}}`, b: `{"$or": [{"a": {"$gt": 5}}, {"a": {"$lte": 5}}]}`, want: true},
+		{name: "Range not covered by an $or", a: `{"a": {"$gt": 0}}`, b: `{"$or": [{"a": {"$gt": 5}}, {"a": {"$lt": 5}}]}`, want: false},
+		{name: "$or over different fields", a: `{"a": 1, "b": 2}`, b: `{"$or": [{"a": 2}, {"b": 2}]}`, want: true},
+		{name: "$and in b", a: `{"a": 1, "b": 2}`, b: `{"$and": [{"a": 1}, {"b": {"$gt": 1}}]}`, want: true},
+		{name: "Contradiction implies anything", a: `{"a": {"$in": []}}`, b: `{"b": 1}`, want: true},
+		{name: "Missing and present contradict", a: `{"$and": [{"a": {"$exists": false}}, {"a": 1}]}`, b: `{"b": 1}`, want: true},
+		{name: "Empty b matches everything", a: `{"a": 1}`, b: `{}`, want: true},
+		{name: "Empty a matches everything", a: `{}`, b: `{"a": 1}`, want: false},
+		{name: "Repeated unsupported condition", a: `{"name": {"$regex": "^a"}, "age": 30}`, b: `{"name": {"$regex": "^a"}}`, want: true},
+		{name: "Unsupported condition in b", a: `{"name": "ann"}`, b: `{"name": {"$regex": "^a"}}`, undecidable: true},
+		{name: "Unsupported condition in a", a: `{"name": {"$regex": "^a"}}`, b: `{"name": "ann"}`, undecidable: true},
+		{name: "Unsupported condition that does not matter", a: `{"name": {"$regex": "^a"}, "age": 30}`, b: `{"age": {"$gt": 20}}`, want: true},
+		{name: "$nor", a: `{"$nor": [{"a": 1}]}`, b: `{"a": 2}`, undecidable: true},
+		{name: "Overlapping paths", a: `{"a": {"$exists": false}}`, b: `{"a.b": {"$exists": false}}`, undecidable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Implies(parseQuery(t, tt.a), parseQuery(t, tt.b))
+			if tt.undecidable {
+				if !errors.Is(err, ErrUndecidable) {
+					t.Fatalf("Implies() = %v, %v, want ErrUndecidable", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Implies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Implies(map[string]interface{}{"a": map[string]interface{}{"$foo": 1}}, nil); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Implies() error = %v, want ErrInvalidQuery", err)
+	}
+}
+
+// TestImpliesExhaustive checks Implies on random queries against every
+// document over a set of values that includes a value in every gap between
+// the constants of the queries
+func TestImpliesExhaustive(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	constants := []interface{}{1, 2, 3, "a", "b", true, nil}
+	values := []interface{}{0, 1, 1.5, 2, 2.5, 3, 4, "", "a", "a5", "b", "c", true, nil}
+
+	var fieldValues []interface{}
+	fieldValues = append(fieldValues, []interface{}{})
+	for i, v := range values {
+		fieldValues = append(fieldValues, v)
+		for _, w := range values[i:] {
+			fieldValues = append(fieldValues, []interface{}{v, w})
+		}
+	}
+	// missing stands for a field the document lacks
+	type missing struct{}
+	var docs []map[string]interface{}
+	for _, x := range append(fieldValues, missing{}) {
+		for _, y := range append(fieldValues, missing{}) {
+			doc := map[string]interface{}{}
+			if x != (missing{}) {
+				doc["x"] = x
+			}
+			if y != (missing{}) {
+				doc["y"] = y
+			}
+			docs = append(docs, doc)
+		}
+	}
+
+	operator := func() (string, interface{}) {
+		switch op := []string{"$eq", "$in", "$gt", "$gte", "$lt", "$lte", "$exists"}[r.Intn(7)]; op {
+		case "$in":
+			list := make([]interface{}, r.Intn(3))
+			for i := range list {
+				list[i] = constants[r.Intn(len(constants))]
+			}
+			return op, list
+		case "$exists":
+			return op, r.Intn(2) == 0
+		default:
+			return op, constants[r.Intn(len(constants))]
+		}
+	}
+	condition := func(n int) map[string]interface{} {
+		ops := map[string]interface{}{}
+		for i := 0; i < n; i++ {
+			op, operand := operator()
+			ops[op] = operand
+		}
+		return ops
+	}
+	field := func() string { return []string{"x", "y"}[r.Intn(2)] }
+	// a has at most two element conditions per field in each $or branch,
+	// which the pairs in docs can always meet
+	randomA := func() map[string]interface{} {
+		q := map[string]interface{}{field(): condition(1)}
+		if r.Intn(2) == 0 {
+			q["$or"] = []interface{}{
+				map[string]interface{}{field(): condition(1)},
+				map[string]interface{}{field(): condition(1)},
+			}
+		}
+		return q
+	}
+	var randomB func(depth int) map[string]interface{}
+	randomB = func(depth int) map[string]interface{} {
+		q := map[string]interface{}{field(): condition(1 + r.Intn(2))}
+		if depth > 0 && r.Intn(2) == 0 {
+			clauses := []interface{}{randomB(depth - 1), randomB(depth - 1)}
+			q[[]string{"$and", "$or"}[r.Intn(2)]] = clauses
+		}
+		return q
+	}
+
+	decided := map[bool]int{}
+	for i := 0; i < 150; i++ {
+		a, b := randomA(), randomB(1)
+		got, err := Implies(a, b)
+		if err != nil {
+			t.Fatalf("Implies(%v, %v): %v", a, b, err)
+		}
+		decided[got]++
+
+		qa, qb := MustCompile(a), MustCompile(b)
+		var counterexample map[string]interface{}
+		for _, doc := range docs {
+			if qa.Match(doc) && !qb.Match(doc) {
+				counterexample = doc
+				break
+			}
+		}
+		if got != (counterexample == nil) {
+			t.Fatalf("Implies(%v, %v) = %v, counterexample %v", a, b, got, counterexample)
+		}
+	}
+	if decided[true] == 0 || decided[false] == 0 {
+		t.Errorf("random queries did not exercise both answers: %v", decided)
+	}
+}
+
+func ExampleImplies() {
+	scope := map[string]interface{}{"tenant": "acme", "age": map[string]interface{}{"$gte": 18}}
+	requested := map[string]interface{}{"tenant": "acme", "age": map[string]interface{}{"$gt": 30}, "active": true}
+	ok, _ := Implies(requested, scope)
+	fmt.Println(ok)
+	// Output: true
+}
+
+// TestImpliesConcurrentRegister runs Implies while operators are registered
+// on the default engine, for the race detector
+func TestImpliesConcurrentRegister(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			defaultEngine.RegisterOperator("$impliesRaceTest", func(interface{}) (Predicate, error) {
+				return func(interface{}) bool { return false }, nil
+			})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := Implies(parseQuery(t, `{"age": {"$gt": 20, "$lt": 30}}`), parseQuery(t, `{"age": {"$gte": 20}}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
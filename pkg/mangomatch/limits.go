@@ -0,0 +1,209 @@
+package mangomatch
+
+import (
+	"context"
+	"fmt"
+)
+
+// Limits bounds the cost of evaluating untrusted queries. Zero fields are
+// unlimited. MaxDepth, MaxInListSize and MaxRegexLength are checked when a
+// query is compiled; MaxArrayScan and MaxSteps are checked by MatchContext
+// while a document is evaluated.
+type Limits struct {
+	// MaxDepth is the deepest nesting of query documents, counting the
+	// top-level query as 1 and each $and, $or, $nor, $not and $elemMatch
+	// as one more level
+	MaxDepth int
+	// MaxInListSize is the longest operand of $in, $nin and $all
+	MaxInListSize int
+	// MaxRegexLength is the longest $regex pattern
+	MaxRegexLength int
+	// MaxArrayScan is the largest array a condition may be evaluated against
+	MaxArrayScan int
+	// MaxSteps is the number of conditions that may be evaluated per document
+	MaxSteps int
+}
+
+// LimitError reports a query or document that exceeded one of the Limits
+type LimitError struct {
+	Limit string // name of the Limits field, e.g. "MaxSteps"
+	Max   int
+	Field string // dotted path of the condition, if there is one
+}
+
+func (e *LimitError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("mangomatch: %s limit of %d exceeded", e.Limit, e.Max)
+	}
+	return fmt.Sprintf("mangomatch: %s limit of %d exceeded at field %q", e.Limit, e.Max, e.Field)
+}
+
+// SetLimits makes queries compiled by e afterwards subject to limits
+func (e *Engine) SetLimits(limits Limits) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limits = limits
+}
+
+// Limits returns the limits set on e
+func (e *Engine) Limits() Limits {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.limits
+}
+
+// MatchContext evaluates query against doc like Match, but stops once ctx is
+// done. The default engine has no limits and cannot be given any; use
+// (*Engine).MatchContext on an engine with SetLimits to bound evaluation. It
+// returns ErrInvalidQuery or ctx.Err() instead of a result when evaluation
+// cannot complete.
+func MatchContext(ctx context.Context, query map[string]interface{}, doc map[string]interface{}) (bool, error) {
+	return defaultEngine.MatchContext(ctx, query, doc)
+}
+
+// MatchContext is like the package-level MatchContext, using the operators
+// of e, and returns a *LimitError when evaluation exceeds the limits of e
+func (e *Engine) MatchContext(ctx context.Context, query map[string]interface{}, doc map[string]interface{}) (bool, error) {
+	q, err := e.Compile(query)
+	if err != nil {
+		return false, err
+	}
+	return q.MatchContext(ctx, doc)
+}
+
+// MatchContext is like Match, but enforces the evaluation limits of the
+// engine that compiled q and stops once ctx is done
+func (q *Query) MatchContext(ctx context.Context, item interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	doc, ok := q.accessor(item)
+	if !ok {
+		return false, nil
+	}
+
+	b := &budget{ctx: ctx, limits: q.limits}
+	matched := q.match(doc, b)
+	if b.err != nil {
+		return false, b.err
+	}
+	return matched, nil
+}
+
+// ctxCheckInterval is how many steps are taken between checks of ctx
+const ctxCheckInterval = 256
+
+// budget tracks the cost of one evaluation. Once err is set every matcher
+// returns false, unwinding the evaluation. A nil budget is unlimited.
+type budget struct {
+	ctx    context.Context
+	limits Limits
+	steps  int
+	err    error
+}
+
+// step accounts for evaluating one condition and reports whether
+// evaluation may continue
+func (b *budget) step(field string) bool {
+	if b == nil {
+		return true
+	}
+	if b.err != nil {
+		return false
+	}
+	b.steps++
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		b.err = &LimitError{Limit: "MaxSteps", Max: b.limits.MaxSteps, Field: field}
+		return false
+	}
+	if b.steps%ctxCheckInterval == 0 {
+		if err := b.ctx.Err(); err != nil {
+			b.err = err
+			return false
+		}
+	}
+	return true
+}
+
+// scan reports whether a condition on field may be evaluated against value,
+// which is too expensive if it is an array longer than MaxArrayScan
+func (b *budget) scan(field string, value interface{}) bool {
+	if b == nil || b.limits.MaxArrayScan <= 0 {
+		return true
+	}
+	if arr, ok := value.([]interface{}); ok && len(arr) > b.limits.MaxArrayScan {
+		b.err = &LimitError{Limit: "MaxArrayScan", Max: b.limits.MaxArrayScan, Field: field}
+		return false
+	}
+	return true
+}
+
+// checkLimits enforces the compile-time limits on a validated query
+// document at the given depth
+func checkLimits(query map[string]interface{}, limits Limits, depth int) error {
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return &LimitError{Limit: "MaxDepth", Max: limits.MaxDepth}
+	}
+	for key, value := range query {
+		switch key {
+		case "$and", "$or", "$nor":
+			clauses, _ := value.([]interface{})
+			for _, clause := range clauses {
+				sub, _ := clause.(map[string]interface{})
+				if err := checkLimits(sub, limits, depth+1); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if ops, ok := value.(map[string]interface{}); ok && isOperatorMap(ops) {
+			if err := checkOperatorLimits(key, ops, limits, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkOperatorLimits(field string, ops map[string]interface{}, limits Limits, depth int) error {
+	for op, operand := range ops {
+		switch op {
+		case "$in", "$nin", "$all":
+			list, _ := operand.([]interface{})
+			if limits.MaxInListSize > 0 && len(list) > limits.MaxInListSize {
+				return &LimitError{Limit: "MaxInListSize", Max: limits.MaxInListSize, Field: field}
+			}
+			if op != "$all" {
+				continue
+			}
+			// $elemMatch clauses of $all
+			for _, item := range list {
+				if clause, ok := item.(map[string]interface{}); ok && isOperatorMap(clause) {
+					if err := checkOperatorLimits(field, clause, limits, depth); err != nil {
+						return err
+					}
+				}
+			}
+		case "$regex":
+			pattern, _ := operand.(string)
+			if limits.MaxRegexLength > 0 && len(pattern) > limits.MaxRegexLength {
+				return &LimitError{Limit: "MaxRegexLength", Max: limits.MaxRegexLength, Field: field}
+			}
+		case "$not", "$elemMatch":
+			if limits.MaxDepth > 0 && depth+1 > limits.MaxDepth {
+				return &LimitError{Limit: "MaxDepth", Max: limits.MaxDepth, Field: field}
+			}
+			sub, _ := operand.(map[string]interface{})
+			var err error
+			if op == "$not" || isElemMatchOperators(sub) {
+				err = checkOperatorLimits(field, sub, limits, depth+1)
+			} else {
+				err = checkLimits(sub, limits, depth+1)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package mangomatch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompileLimits(t *testing.T) {
+	limits := Limits{MaxDepth: 3, MaxInListSize: 3, MaxRegexLength: 8}
+	tests := []struct {
+		name      string
+		query     string
+		wantLimit string
+	}{
+		{name: "Within limits", query: `{"$or": [{"a": {"$in": [1, 2, 3]}}, {"b": {"$regex": "^abc"}}]}`},
+		{name: "Long $in", query: `{"a": {"$in": [1, 2, 3, 4]}}`, wantLimit: "MaxInListSize"},
+		{name: "Long $nin", query: `{"a": {"$nin": [1, 2, 3, 4]}}`, wantLimit: "MaxInListSize"},
+		{name: "Long $all under $not", query: `{"a": {"$not": {"$all": [1, 2, 3, 4]}}}`, wantLimit: "MaxInListSize"},
+		{name: "Long regex", query: `{"a": {"$regex": "^(a+)+$$$"}}`, wantLimit: "MaxRegexLength"},
+		{name: "Depth 3", query: `{"$or": [{"$and": [{"a": 1}]}]}`},
+		{name: "Depth 4", query: `{"$or": [{"$and": [{"$nor": [{"a": 1}]}]}]}`, wantLimit: "MaxDepth"},
+		{name: "Depth through $not", query: `{"$or": [{"$and": [{"a": {"$not": {"$gt": 1}}}]}]}`, wantLimit: "MaxDepth"},
+		{name: "Depth through $elemMatch", query: `{"$or": [{"a": {"$elemMatch": {"b": {"$not": {"$gt": 1}}}}}]}`, wantLimit: "MaxDepth"},
+		{name: "Depth through $or in $elemMatch", query: `{"a": {"$elemMatch": {"$or": [{"b": {"$not": {"$gt": 1}}}]}}}`, wantLimit: "MaxDepth"},
+		{name: "Depth through $all", query: `{"$or": [{"a": {"$all": [{"$elemMatch": {"b": {"$not": {"$gt": 1}}}}]}}]}`, wantLimit: "MaxDepth"},
+	}
+
+	e := NewEngine()
+	e.SetLimits(limits)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseExtJSON([]byte(tt.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = e.Compile(query)
+			var limitErr *LimitError
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("Compile() error = %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.wantLimit {
+				t.Fatalf("Compile() error = %v, want %s LimitError", err, tt.wantLimit)
+			}
+
+			// The default engine has no limits
+			if _, err := Compile(query); err != nil {
+				t.Errorf("Compile() without limits error = %v", err)
+			}
+		})
+	}
+}
+
+func TestMatchContextLimits(t *testing.T) {
+	big := make([]interface{}, 1000)
+	for i := range big {
+		big[i] = i
+	}
+	wide := make([]interface{}, 100)
+	for i := range wide {
+		wide[i] = map[string]interface{}{"a": -1}
+	}
+
+	orders := make([]interface{}, 50)
+	for i := range orders {
+		orders[i] = map[string]interface{}{"a": 1, "big": big}
+	}
+	doc := map[string]interface{}{"a": 5, "big": big, "items": []interface{}{big, big}, "orders": orders}
+	// $elemMatch clauses that exceed MaxSteps and MaxArrayScan in every element
+	manySteps := map[string]interface{}{"$elemMatch": map[string]interface{}{"$or": wide}}
+	largeArray := map[string]interface{}{"$elemMatch": map[string]interface{}{"big": 999}}
+
+	tests := []struct {
+		name      string
+		limits    Limits
+		query     map[string]interface{}
+		want      bool
+		wantLimit string
+		wantField string
+	}{
+		{name: "Unlimited", query: map[string]interface{}{"big": 999}, want: true},
+		{name: "Array scan", limits: Limits{MaxArrayScan: 100}, query: map[string]interface{}{"big": 999}, wantLimit: "MaxArrayScan", wantField: "big"},
+		{name: "$elemMatch over a large array", limits: Limits{MaxArrayScan: 100},
+			query:     map[string]interface{}{"big": map[string]interface{}{"$elemMatch": map[string]interface{}{"$gt": 998}}},
+			wantLimit: "MaxArrayScan", wantField: "big"},
+		{name: "Array scan within limit", limits: Limits{MaxArrayScan: 1000}, query: map[string]interface{}{"big": 999}, want: true},
+		{name: "Small arrays are fine", limits: Limits{MaxArrayScan: 100}, query: map[string]interface{}{"a": 5}, want: true},
+		{name: "Steps", limits: Limits{MaxSteps: 50}, query: map[string]interface{}{"$or": wide}, wantLimit: "MaxSteps", wantField: "a"},
+		{name: "Steps within limit", limits: Limits{MaxSteps: 200}, query: map[string]interface{}{"$or": wide}, want: false},
+		{name: "Exceeded $nor does not match", limits: Limits{MaxSteps: 50}, query: map[string]interface{}{"$nor": wide}, wantLimit: "MaxSteps"},
+		{name: "Steps in $or under $elemMatch", limits: Limits{MaxSteps: 5},
+			query:     map[string]interface{}{"orders": map[string]interface{}{"$elemMatch": map[string]interface{}{"$or": wide}}},
+			wantLimit: "MaxSteps", wantField: "a"},
+		{name: "Array scan under $elemMatch", limits: Limits{MaxArrayScan: 100},
+			query:     map[string]interface{}{"orders": largeArray},
+			wantLimit: "MaxArrayScan", wantField: "big"},
+		{name: "Steps under $not", limits: Limits{MaxSteps: 5},
+			query:     map[string]interface{}{"orders": map[string]interface{}{"$not": manySteps}},
+			wantLimit: "MaxSteps", wantField: "a"},
+		{name: "Array scan under $not", limits: Limits{MaxArrayScan: 100},
+			query:     map[string]interface{}{"orders": map[string]interface{}{"$not": largeArray}},
+			wantLimit: "MaxArrayScan", wantField: "big"},
+		{name: "Steps under $all", limits: Limits{MaxSteps: 5},
+			query:     map[string]interface{}{"orders": map[string]interface{}{"$all": []interface{}{manySteps}}},
+			wantLimit: "MaxSteps", wantField: "a"},
+		{name: "Array scan under $all", limits: Limits{MaxArrayScan: 100},
+			query:     map[string]interface{}{"orders": map[string]interface{}{"$all": []interface{}{largeArray}}},
+			wantLimit: "MaxArrayScan", wantField: "big"},
+		{name: "$elemMatch within limits", limits: Limits{MaxSteps: 5, MaxArrayScan: 100},
+			query: map[string]interface{}{"orders": map[string]interface{}{"$elemMatch": map[string]interface{}{"a": 1}}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine()
+			e.SetLimits(tt.limits)
+			got, err := e.MatchContext(context.Background(), tt.query, doc)
+			if tt.wantLimit == "" {
+				if err != nil || got != tt.want {
+					t.Fatalf("MatchContext() = %v, %v, want %v", got, err, tt.want)
+				}
+				return
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.wantLimit {
+				t.Fatalf("MatchContext() = %v, %v, want %s LimitError", got, err, tt.wantLimit)
+			}
+			if got {
+				t.Error("Expected no match alongside an error")
+			}
+			if tt.wantField != "" && limitErr.Field != tt.wantField {
+				t.Errorf("LimitError.Field = %q, want %q", limitErr.Field, tt.wantField)
+			}
+			if !strings.Contains(err.Error(), tt.wantLimit) {
+				t.Errorf("Error() = %q, want mention of %s", err.Error(), tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestMatchContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := MatchContext(ctx, map[string]interface{}{"a": 1}, map[string]interface{}{"a": 1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("MatchContext() error = %v, want context.Canceled", err)
+	}
+
+	// Cancellation during a long evaluation is noticed between steps
+	wide := make([]interface{}, 10*ctxCheckInterval)
+	for i := range wide {
+		wide[i] = map[string]interface{}{"a": -1}
+	}
+	q := MustCompile(map[string]interface{}{"$or": wide})
+	b := &budget{ctx: ctx}
+	if q.match(MapDocument(map[string]interface{}{"a": 1}), b) || !errors.Is(b.err, context.Canceled) {
+		t.Errorf("Expected evaluation to stop with context.Canceled, got %v", b.err)
+	}
+
+	got, err := MatchContext(context.Background(), map[string]interface{}{"a": 1}, map[string]interface{}{"a": 1})
+	if err != nil || !got {
+		t.Errorf("MatchContext() = %v, %v, want true", got, err)
+	}
+	if _, err := MatchContext(context.Background(), map[string]interface{}{"a": map[string]interface{}{"$foo": 1}}, nil); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("MatchContext() error = %v, want ErrInvalidQuery", err)
+	}
+}
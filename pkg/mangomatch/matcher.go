@@ -1,166 +1,95 @@
 package mangomatch
 
 import (
+	"math"
 	"regexp"
 	"strconv"
-	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func Match(query map[string]interface{}, doc map[string]interface{}) bool {
-	for key, value := range query {
-		if strings.HasPrefix(key, "$") {
-			switch key {
-			case "$and":
-				return evaluateAnd(value, doc)
-			case "$or":
-				return evaluateOr(value, doc)
-			case "$nor":
-				return !evaluateOr(value, doc)
-			default:
-				return false
-			}
-		} else {
-			fieldValue, exists := getNestedValue(doc, key)
-			if !exists {
-				if mapValue, ok := value.(map[string]interface{}); ok {
-					if existsVal, hasExists := mapValue["$exists"]; hasExists {
-						return existsVal.(bool) == exists
-					}
-				}
-				return false
-			}
+	return defaultEngine.Match(query, doc)
+}
 
-			if !matchValue(value, fieldValue) {
-				return false
-			}
-		}
-	}
-	return len(query) > 0
+// MatchDocument evaluates query against any Document implementation
+func MatchDocument(query map[string]interface{}, doc Document) bool {
+	return defaultEngine.MatchDocument(query, doc)
 }
 
-func evaluateAnd(value interface{}, doc map[string]interface{}) bool {
-	conditions, ok := value.([]interface{})
-	if !ok {
-		return false
-	}
+// Match evaluates query against doc using the operators registered on e
+func (e *Engine) Match(query map[string]interface{}, doc map[string]interface{}) bool {
+	return e.MatchDocument(query, MapDocument(doc))
+}
 
-	for _, condition := range conditions {
-		if condMap, ok := condition.(map[string]interface{}); ok {
-			if !Match(condMap, doc) {
-				return false
-			}
-		} else {
-			return false
+// MatchDocument evaluates query against any Document implementation using
+// the operators registered on e. The query is compiled on every call; use
+// Compile to evaluate one query against many documents.
+func (e *Engine) MatchDocument(query map[string]interface{}, doc Document) bool {
+	return e.compileMatcher(query)(doc, nil)
+}
+
+// negatedOperators hold for a path only if they hold for every value found
+// at it, as MongoDB evaluates them: {"items.qty": {"$ne": 0}} rejects a
+// document where any item has a qty of 0
+var negatedOperators = map[string]bool{"$ne": true, "$nin": true, "$not": true}
+
+// valueTest is one operator of a field condition. It holds if any of the
+// values found at the path meets pred, or every value for the negations.
+type valueTest struct {
+	pred budgetPredicate
+	all  bool
+}
+
+func (t valueTest) holds(values []interface{}, b *budget) bool {
+	for _, v := range values {
+		if t.pred(v, b) != t.all {
+			return !t.all
 		}
 	}
-	return true
+	return t.all
 }
 
-func evaluateOr(value interface{}, doc map[string]interface{}) bool {
-	conditions, ok := value.([]interface{})
+// compileCondition splits a field condition into the tests that must all
+// hold. Each operator is tested on the values independently, and $all is
+// split into one test per value, so different values may meet them.
+func (e *Engine) compileCondition(value interface{}) ([]valueTest, error) {
+	if re, ok := value.(primitive.Regex); ok {
+		// A regular expression value matches like $regex
+		pred, err := e.compileOperator("$regex", re)
+		return []valueTest{{pred: pred}}, err
+	}
+	ops, ok := value.(map[string]interface{})
 	if !ok {
-		return false
+		pred, err := unbudgeted(e.collator.collate(value, comparisonOperator(compareEqualAny)))
+		return []valueTest{{pred: pred}}, err
 	}
-
-	for _, condition := range conditions {
-		if condMap, ok := condition.(map[string]interface{}); ok {
-			if Match(condMap, doc) {
-				return true
-			}
-		}
+	if !isOperatorMap(ops) {
+		// Embedded documents are not compared by value
+		return []valueTest{{pred: func(interface{}, *budget) bool { return false }}}, nil
 	}
-	return false
-}
+	ops = withRegexOptions(ops)
 
-func matchValue(queryValue interface{}, docValue interface{}) bool {
-	switch queryVal := queryValue.(type) {
-	case map[string]interface{}:
-		return evaluateOperators(queryVal, docValue)
-	default:
-		// Handle the case where docValue is an array
-		if docArray, ok := docValue.([]interface{}); ok {
-			for _, item := range docArray {
-				if compareEqual(queryValue, item) {
-					return true
+	tests := make([]valueTest, 0, len(ops))
+	for op, operand := range ops {
+		if items, ok := operand.([]interface{}); ok && op == "$all" && len(items) > 1 {
+			for _, item := range items {
+				pred, err := e.compileOperator(op, []interface{}{item})
+				if err != nil {
+					return nil, err
 				}
+				tests = append(tests, valueTest{pred: pred})
 			}
-			return false
+			continue
 		}
-		return compareEqual(queryValue, docValue)
-	}
-}
-
-func evaluateOperators(operators map[string]interface{}, docValue interface{}) bool {
-	for op, val := range operators {
-		switch op {
-		case "$eq":
-			if !compareEqual(val, docValue) {
-				return false
-			}
-		case "$ne":
-			if compareEqual(val, docValue) {
-				return false
-			}
-		case "$gt":
-			if !compareGreaterThan(val, docValue) {
-				return false
-			}
-		case "$gte":
-			if !compareGreaterThanEqual(val, docValue) {
-				return false
-			}
-		case "$lt":
-			if !compareLessThan(val, docValue) {
-				return false
-			}
-		case "$lte":
-			if !compareLessThanEqual(val, docValue) {
-				return false
-			}
-		case "$in":
-			if !evaluateIn(val, docValue) {
-				return false
-			}
-		case "$nin":
-			if evaluateIn(val, docValue) {
-				return false
-			}
-		case "$exists":
-			return val.(bool)
-		case "$not":
-			if subMap, ok := val.(map[string]interface{}); ok {
-				return !evaluateOperators(subMap, docValue)
-			}
-			return false
-		case "$regex":
-			if !evaluateRegex(val, docValue) {
-				return false
-			}
-		case "$size":
-			if !evaluateSize(val, docValue) {
-				return false
-			}
-		case "$all":
-			if !evaluateAll(val, docValue) {
-				return false
-			}
-		case "$elemMatch":
-			if !evaluateElemMatch(val, docValue) {
-				return false
-			}
-		case "$type":
-			if !evaluateType(val, docValue) {
-				return false
-			}
-		case "$mod":
-			if !evaluateMod(val, docValue) {
-				return false
-			}
-		default:
-			return false
+		pred, err := e.compileOperator(op, operand)
+		if err != nil {
+			return nil, err
 		}
+		tests = append(tests, valueTest{pred: pred, all: negatedOperators[op]})
 	}
-	return true
+	return tests, nil
 }
 
 func evaluateIn(queryValue interface{}, docValue interface{}) bool {
@@ -189,24 +118,13 @@ func evaluateIn(queryValue interface{}, docValue interface{}) bool {
 	return false
 }
 
-func evaluateRegex(queryValue interface{}, docValue interface{}) bool {
-	pattern, ok := queryValue.(string)
-	if !ok {
-		return false
-	}
-
+// matchRegex checks a string, or any string element of an array, against re
+func matchRegex(re *regexp.Regexp, docValue interface{}) bool {
 	// Handle the case where docValue is an array
 	if docArray, ok := docValue.([]interface{}); ok {
 		for _, item := range docArray {
-			itemStr, isStr := item.(string)
-			if isStr {
-				re, err := regexp.Compile(pattern)
-				if err != nil {
-					return false
-				}
-				if re.MatchString(itemStr) {
-					return true
-				}
+			if itemStr, isStr := item.(string); isStr && re.MatchString(itemStr) {
+				return true
 			}
 		}
 		return false
@@ -216,16 +134,52 @@ func evaluateRegex(queryValue interface{}, docValue interface{}) bool {
 	if !ok {
 		return false
 	}
+	return re.MatchString(docStr)
+}
 
-	re, err := regexp.Compile(pattern)
-	if err != nil {
+// compareEqualAny is the equality of $eq and of implicit equality: an array
+// matches if any of its elements is equal to a
+func compareEqualAny(a, b interface{}) bool {
+	if bArray, ok := b.([]interface{}); ok {
+		for _, item := range bArray {
+			if compareEqual(a, item) {
+				return true
+			}
+		}
 		return false
 	}
+	return compareEqual(a, b)
+}
 
-	return re.MatchString(docStr)
+// widenNumber converts the sized numeric types that the BSON decoders and
+// Go structs produce into the int and float64 the comparisons work on
+func widenNumber(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int8:
+		return int(n)
+	case int16:
+		return int(n)
+	case int32:
+		return int(n)
+	case int64:
+		if n > math.MaxInt || n < math.MinInt {
+			return float64(n)
+		}
+		return int(n)
+	case uint8:
+		return int(n)
+	case uint16:
+		return int(n)
+	case uint32:
+		return int(n)
+	case float32:
+		return float64(n)
+	}
+	return v
 }
 
 func compareEqual(a, b interface{}) bool {
+	a, b = widenNumber(a), widenNumber(b)
 	switch aVal := a.(type) {
 	case int:
 		if bVal, ok := b.(int); ok {
@@ -249,6 +203,12 @@ func compareEqual(a, b interface{}) bool {
 		if bVal, ok := b.(bool); ok {
 			return aVal == bVal
 		}
+	case time.Time:
+		if bVal, ok := b.(time.Time); ok {
+			return aVal.Equal(bVal)
+		}
+	case nil:
+		return b == nil
 	}
 	return false
 }
@@ -267,6 +227,7 @@ func compareGreaterThan(a, b interface{}) bool {
 }
 
 func compareSimpleGreaterThan(a, b interface{}) bool {
+	a, b = widenNumber(a), widenNumber(b)
 	switch aVal := a.(type) {
 	case int:
 		if bVal, ok := b.(int); ok {
@@ -286,6 +247,10 @@ func compareSimpleGreaterThan(a, b interface{}) bool {
 		if bVal, ok := b.(string); ok {
 			return bVal > aVal
 		}
+	case time.Time:
+		if bVal, ok := b.(time.Time); ok {
+			return bVal.After(aVal)
+		}
 	}
 	return false
 }
@@ -304,6 +269,7 @@ func compareGreaterThanEqual(a, b interface{}) bool {
 }
 
 func compareSimpleGreaterThanEqual(a, b interface{}) bool {
+	a, b = widenNumber(a), widenNumber(b)
 	switch aVal := a.(type) {
 	case int:
 		if bVal, ok := b.(int); ok {
@@ -323,6 +289,12 @@ func compareSimpleGreaterThanEqual(a, b interface{}) bool {
 		if bVal, ok := b.(string); ok {
 			return bVal >= aVal
 		}
+	case time.Time:
+		if bVal, ok := b.(time.Time); ok {
+			return !bVal.Before(aVal)
+		}
+	case nil:
+		return b == nil
 	}
 	return false
 }
@@ -341,6 +313,7 @@ func compareLessThan(a, b interface{}) bool {
 }
 
 func compareSimpleLessThan(a, b interface{}) bool {
+	a, b = widenNumber(a), widenNumber(b)
 	switch aVal := a.(type) {
 	case int:
 		if bVal, ok := b.(int); ok {
@@ -360,6 +333,10 @@ func compareSimpleLessThan(a, b interface{}) bool {
 		if bVal, ok := b.(string); ok {
 			return bVal < aVal
 		}
+	case time.Time:
+		if bVal, ok := b.(time.Time); ok {
+			return bVal.Before(aVal)
+		}
 	}
 	return false
 }
@@ -378,6 +355,7 @@ func compareLessThanEqual(a, b interface{}) bool {
 }
 
 func compareSimpleLessThanEqual(a, b interface{}) bool {
+	a, b = widenNumber(a), widenNumber(b)
 	switch aVal := a.(type) {
 	case int:
 		if bVal, ok := b.(int); ok {
@@ -397,99 +375,74 @@ func compareSimpleLessThanEqual(a, b interface{}) bool {
 		if bVal, ok := b.(string); ok {
 			return bVal <= aVal
 		}
+	case time.Time:
+		if bVal, ok := b.(time.Time); ok {
+			return !bVal.After(aVal)
+		}
+	case nil:
+		return b == nil
 	}
 	return false
 }
 
-func getNestedValue(doc map[string]interface{}, key string) (interface{}, bool) {
-	parts := strings.Split(key, ".")
+// getNestedValue returns the value at parts for code that needs a single
+// value, such as sort keys: the value itself when the path reaches one, or
+// the list of values it reaches through arrays
+func getNestedValue(doc map[string]interface{}, parts []string) (interface{}, bool) {
+	values := lookupPath(doc, parts, nil)
+	switch len(values) {
+	case 0:
+		return nil, false
+	case 1:
+		return values[0], true
+	}
+	return values, true
+}
 
-	// For the leaf part, we need special handling for array fields
-	if len(parts) == 1 {
-		val, exists := doc[parts[0]]
-		return val, exists
+// lookupPath appends every value that parts reaches from current to out,
+// following MongoDB: a segment is looked up in every embedded document of an
+// array, and a numeric segment is both an object key and an array position.
+// Arrays nested directly in arrays are not descended into.
+func lookupPath(current interface{}, parts []string, out []interface{}) []interface{} {
+	if len(parts) == 0 {
+		return append(out, current)
 	}
 
-	var current interface{} = doc
-
-	// For non-leaf parts
-	for i, part := range parts {
-		// Check if the part is an array index
-		isArrayIndex := false
-		arrayIndex := -1
-		if idx, err := strconv.Atoi(part); err == nil {
-			isArrayIndex = true
-			arrayIndex = idx
+	switch v := current.(type) {
+	case map[string]interface{}:
+		if val, ok := v[parts[0]]; ok {
+			out = lookupPath(val, parts[1:], out)
 		}
-
-		if i == len(parts)-1 {
-			// Last segment - handle arrays specially
-			if currentMap, ok := current.(map[string]interface{}); ok {
-				val, exists := currentMap[part]
-				return val, exists
-			}
-
-			// Handle direct array access by index
-			if isArrayIndex && arrayIndex >= 0 {
-				if arr, ok := current.([]interface{}); ok && arrayIndex < len(arr) {
-					return arr[arrayIndex], true
-				}
-			}
-
-			// Handle array elements
-			if currentArray, ok := current.([]interface{}); ok {
-				for _, item := range currentArray {
-					if itemMap, ok := item.(map[string]interface{}); ok {
-						if val, exists := itemMap[part]; exists {
-							return val, true
-						}
-					}
-				}
-			}
-
-			return nil, false
+	case []interface{}:
+		if idx, ok := arrayIndex(parts[0]); ok && idx < len(v) {
+			out = lookupPath(v[idx], parts[1:], out)
 		}
-
-		if isArrayIndex && arrayIndex >= 0 {
-			// Handle array access
-			if arr, ok := current.([]interface{}); ok && arrayIndex < len(arr) {
-				current = arr[arrayIndex]
-				continue
+		for _, item := range v {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				out = lookupPath(itemMap, parts, out)
 			}
-			return nil, false
 		}
+	}
+	return out
+}
 
-		if currentMap, ok := current.(map[string]interface{}); ok {
-			current, ok = currentMap[part]
-			if !ok {
-				return nil, false
-			}
-		} else if currentArray, ok := current.([]interface{}); ok {
-			// For array elements, try to find the next part in each item
-			found := false
-			for _, item := range currentArray {
-				if itemMap, ok := item.(map[string]interface{}); ok {
-					if val, exists := itemMap[part]; exists {
-						current = val
-						found = true
-						break
-					}
-				}
-			}
-			if !found {
-				return nil, false
-			}
-		} else {
-			return nil, false
+// arrayIndex parses a path segment made only of digits as an array position
+func arrayIndex(part string) (int, bool) {
+	if part == "" {
+		return 0, false
+	}
+	for _, c := range part {
+		if c < '0' || c > '9' {
+			return 0, false
 		}
 	}
-
-	return current, true
+	idx, err := strconv.Atoi(part)
+	return idx, err == nil
 }
 
 // evaluateSize checks if an array has exactly the specified number of elements
 func evaluateSize(queryValue interface{}, docValue interface{}) bool {
-	sizeVal, ok := queryValue.(int)
+	sizeVal, ok := widenNumber(queryValue).(int)
 	if !ok {
 		// Try to convert from float64 which is the default number type in JSON
 		if floatVal, floatOk := queryValue.(float64); floatOk {
@@ -536,124 +489,6 @@ func evaluateAll(queryValue interface{}, docValue interface{}) bool {
 	return true
 }
 
-// evaluateElemMatch checks if at least one element in an array matches all the specified criteria
-func evaluateElemMatch(queryValue interface{}, docValue interface{}) bool {
-	criteria, ok := queryValue.(map[string]interface{})
-	if !ok {
-		return false
-	}
-
-	// Check if docValue is an array
-	docArray, ok := docValue.([]interface{})
-	if !ok {
-		return false
-	}
-
-	// Check each element of the array against the criteria
-	for _, item := range docArray {
-		// If the item is a map, check if it matches all criteria
-		if itemMap, ok := item.(map[string]interface{}); ok {
-			allMatch := true
-			for k, v := range criteria {
-				// Handle operators directly applied to the document
-				if strings.HasPrefix(k, "$") {
-					// This is an operator applied directly to the array element
-					if !evaluateOperators(map[string]interface{}{k: v}, item) {
-						allMatch = false
-						break
-					}
-				} else {
-					// Check if the field exists and matches
-					fieldValue, exists := itemMap[k]
-					if !exists {
-						allMatch = false
-						break
-					}
-
-					// Check if the value matches
-					if valueMap, ok := v.(map[string]interface{}); ok {
-						// This is a query with operators
-						if !evaluateOperators(valueMap, fieldValue) {
-							allMatch = false
-							break
-						}
-					} else {
-						// Handle case where field value is an array and the query is looking for a direct match
-						if fieldArray, isArray := fieldValue.([]interface{}); isArray {
-							found := false
-							for _, arrayItem := range fieldArray {
-								if compareEqual(v, arrayItem) {
-									found = true
-									break
-								}
-							}
-							if !found {
-								allMatch = false
-								break
-							}
-						} else {
-							// This is a direct value comparison
-							if !compareEqual(v, fieldValue) {
-								allMatch = false
-								break
-							}
-						}
-					}
-				}
-			}
-			if allMatch {
-				return true
-			}
-		} else {
-			// For primitive values, check if they match all operators
-			allOperators := true
-			for k := range criteria {
-				if !strings.HasPrefix(k, "$") {
-					allOperators = false
-					break
-				}
-			}
-
-			if allOperators && evaluateOperators(criteria, item) {
-				return true
-			}
-		}
-	}
-
-	return false
-}
-
-// evaluateType checks if a value is of the specified type
-func evaluateType(queryValue interface{}, docValue interface{}) bool {
-	typeStr, ok := queryValue.(string)
-	if !ok {
-		return false
-	}
-
-	switch typeStr {
-	case "string":
-		_, ok := docValue.(string)
-		return ok
-	case "number":
-		_, ok1 := docValue.(int)
-		_, ok2 := docValue.(float64)
-		return ok1 || ok2
-	case "boolean":
-		_, ok := docValue.(bool)
-		return ok
-	case "object":
-		_, ok := docValue.(map[string]interface{})
-		return ok
-	case "array":
-		_, ok := docValue.([]interface{})
-		return ok
-	case "null":
-		return docValue == nil
-	default:
-		return false
-	}
-}
-
 // evaluateMod checks if the modulo operation on a number matches the specified criteria
 func evaluateMod(queryValue interface{}, docValue interface{}) bool {
 	// The $mod operator expects an array with exactly two elements: [divisor, remainder]
@@ -666,7 +501,7 @@ func evaluateMod(queryValue interface{}, docValue interface{}) bool {
 	var divisor, remainder int
 
 	// Handle divisor
-	switch d := modParams[0].(type) {
+	switch d := widenNumber(modParams[0]).(type) {
 	case int:
 		divisor = d
 	case float64:
@@ -676,7 +511,7 @@ func evaluateMod(queryValue interface{}, docValue interface{}) bool {
 	}
 
 	// Handle remainder
-	switch r := modParams[1].(type) {
+	switch r := widenNumber(modParams[1]).(type) {
 	case int:
 		remainder = r
 	case float64:
@@ -692,7 +527,7 @@ func evaluateMod(queryValue interface{}, docValue interface{}) bool {
 
 	// Get the document value as an integer
 	var docInt int
-	switch dv := docValue.(type) {
+	switch dv := widenNumber(docValue).(type) {
 	case int:
 		docInt = dv
 	case float64:
@@ -704,7 +539,7 @@ func evaluateMod(queryValue interface{}, docValue interface{}) bool {
 			for _, item := range docArray {
 				// Get the item value as an integer
 				var itemInt int
-				switch iv := item.(type) {
+				switch iv := widenNumber(item).(type) {
 				case int:
 					itemInt = iv
 				case float64:
@@ -2,6 +2,9 @@ package mangomatch
 
 import (
 	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestComparisonOperators(t *testing.T) {
@@ -149,6 +152,24 @@ func TestArrayOperators(t *testing.T) {
 			doc:   map[string]interface{}{"status": "active", "name": "John"},
 			want:  false,
 		},
+		{
+			name:  "$eq matches an array element",
+			query: map[string]interface{}{"tags": map[string]interface{}{"$eq": "b"}},
+			doc:   map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			want:  true,
+		},
+		{
+			name:  "$ne rejects an array containing the value",
+			query: map[string]interface{}{"tags": map[string]interface{}{"$ne": "b"}},
+			doc:   map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			want:  false,
+		},
+		{
+			name:  "$ne on an array without the value",
+			query: map[string]interface{}{"tags": map[string]interface{}{"$ne": "c"}},
+			doc:   map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			want:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -256,6 +277,33 @@ func TestLogicalOperators(t *testing.T) {
 			doc:   map[string]interface{}{"age": 25, "name": "John"},
 			want:  false,
 		},
+		{
+			name: "Field condition alongside a matching $or",
+			query: map[string]interface{}{
+				"name": "Jane",
+				"$or":  []interface{}{map[string]interface{}{"age": 25}},
+			},
+			doc:  map[string]interface{}{"age": 25, "name": "John"},
+			want: false,
+		},
+		{
+			name: "Field condition alongside a failing $nor",
+			query: map[string]interface{}{
+				"name": "John",
+				"$nor": []interface{}{map[string]interface{}{"age": 25}},
+			},
+			doc:  map[string]interface{}{"age": 25, "name": "John"},
+			want: false,
+		},
+		{
+			name: "Field condition alongside $and",
+			query: map[string]interface{}{
+				"name": "John",
+				"$and": []interface{}{map[string]interface{}{"age": 25}},
+			},
+			doc:  map[string]interface{}{"age": 25, "name": "John"},
+			want: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -298,6 +346,39 @@ func TestExistenceOperator(t *testing.T) {
 			doc:   map[string]interface{}{"age": 25, "name": "John"},
 			want:  false,
 		},
+		{
+			name: "$exists false alongside a failing field condition",
+			query: map[string]interface{}{
+				"age":  map[string]interface{}{"$exists": false},
+				"name": "Jane",
+			},
+			doc:  map[string]interface{}{"name": "John"},
+			want: false,
+		},
+		{
+			name: "$exists false still checks sibling fields",
+			query: map[string]interface{}{
+				"a": map[string]interface{}{"$exists": false},
+				"b": 1,
+			},
+			doc:  map[string]interface{}{"b": 2},
+			want: false,
+		},
+		{
+			name: "$exists false with matching sibling fields",
+			query: map[string]interface{}{
+				"a": map[string]interface{}{"$exists": false},
+				"b": 1,
+			},
+			doc:  map[string]interface{}{"b": 1},
+			want: true,
+		},
+		{
+			name:  "Non-boolean $exists on a missing field",
+			query: map[string]interface{}{"age": map[string]interface{}{"$exists": 1}},
+			doc:   map[string]interface{}{"name": "John"},
+			want:  false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -309,6 +390,53 @@ func TestExistenceOperator(t *testing.T) {
 	}
 }
 
+func TestMissingFieldAsNull(t *testing.T) {
+	doc := map[string]interface{}{"name": "John", "nickname": nil}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: `{"age": null}`, want: true},
+		{query: `{"nickname": null}`, want: true},
+		{query: `{"age": {"$ne": 30}}`, want: true},
+		{query: `{"age": {"$ne": null}}`, want: false},
+		{query: `{"nickname": {"$ne": null}}`, want: false},
+		{query: `{"age": {"$nin": [30, 40]}}`, want: true},
+		{query: `{"age": {"$in": [null, 30]}}`, want: true},
+		{query: `{"age": {"$not": {"$gt": 30}}}`, want: true},
+		{query: `{"age": {"$not": {"$exists": true}}}`, want: true},
+		{query: `{"age": {"$exists": false, "$ne": 30}}`, want: true},
+		{query: `{"age": {"$exists": false, "$gt": 30}}`, want: false},
+		{query: `{"age": {"$type": "null"}}`, want: false},
+		{query: `{"nickname": {"$type": "null"}}`, want: true},
+		{query: `{"age": {"$elemMatch": {"$gt": 1}}}`, want: false},
+		{query: `{"name.first": null}`, want: true},
+	}
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		query := parseQuery(t, tt.query)
+		if got := Match(query, doc); got != tt.want {
+			t.Errorf("Match(%s) = %v, want %v", tt.query, got, tt.want)
+		}
+		if got := MatchRaw(query, raw); got != tt.want {
+			t.Errorf("MatchRaw(%s) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Registered operators see a missing field as nil
+	e := NewEngine()
+	e.RegisterOperator("$isNil", func(operand interface{}) (Predicate, error) {
+		return func(value interface{}) bool { return value == nil }, nil
+	})
+	if !e.Match(map[string]interface{}{"age": map[string]interface{}{"$isNil": true}}, doc) {
+		t.Error("Expected a registered operator to get nil for a missing field")
+	}
+}
+
 func TestRegexOperator(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -328,6 +456,30 @@ func TestRegexOperator(t *testing.T) {
 			doc:   map[string]interface{}{"name": "Bob", "age": 25},
 			want:  false,
 		},
+		{
+			name:  "$regex with $options",
+			query: map[string]interface{}{"name": map[string]interface{}{"$regex": "^jo", "$options": "i"}},
+			doc:   map[string]interface{}{"name": "John"},
+			want:  true,
+		},
+		{
+			name:  "$regex with a primitive.Regex",
+			query: map[string]interface{}{"name": map[string]interface{}{"$regex": primitive.Regex{Pattern: "^jo", Options: "i"}}},
+			doc:   map[string]interface{}{"name": "John"},
+			want:  true,
+		},
+		{
+			name:  "primitive.Regex value",
+			query: map[string]interface{}{"name": primitive.Regex{Pattern: "^Jo"}},
+			doc:   map[string]interface{}{"name": "John"},
+			want:  true,
+		},
+		{
+			name:  "Unsupported $options",
+			query: map[string]interface{}{"name": map[string]interface{}{"$regex": "^Jo", "$options": "x"}},
+			doc:   map[string]interface{}{"name": "John"},
+			want:  false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -374,3 +526,98 @@ func TestNestedDocuments(t *testing.T) {
 		})
 	}
 }
+
+func TestElemMatch(t *testing.T) {
+	doc := `{
+		"items": [
+			{"sku": "a", "qty": 5, "dim": {"h": 3, "w": 10}, "parts": [{"id": 1, "ok": true}, {"id": 2, "ok": false}]},
+			{"sku": "b", "qty": 20, "dim": {"h": 8, "w": 2}, "parts": [{"id": 3, "ok": true}]}
+		],
+		"mixed": [1, "x", {"v": 7}, [2, 3]],
+		"scores": [55, 82, 91]
+	}`
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{name: "Fields of one element", query: `{"items": {"$elemMatch": {"sku": "b", "qty": {"$gt": 10}}}}`, want: true},
+		{name: "Fields met by different elements", query: `{"items": {"$elemMatch": {"sku": "a", "qty": {"$gt": 10}}}}`, want: false},
+		{name: "$or", query: `{"items": {"$elemMatch": {"$or": [{"sku": "z"}, {"qty": 20}]}}}`, want: true},
+		{name: "$or with a field", query: `{"items": {"$elemMatch": {"sku": "a", "$or": [{"qty": 20}, {"dim.h": 3}]}}}`, want: true},
+		{name: "$or with a field of another element", query: `{"items": {"$elemMatch": {"sku": "a", "$or": [{"qty": 20}, {"dim.h": 8}]}}}`, want: false},
+		{name: "$and", query: `{"items": {"$elemMatch": {"$and": [{"qty": {"$gt": 1}}, {"qty": {"$lt": 10}}]}}}`, want: true},
+		{name: "$nor", query: `{"items": {"$elemMatch": {"$nor": [{"sku": "a"}, {"sku": "b"}]}}}`, want: false},
+		{name: "Dotted path", query: `{"items": {"$elemMatch": {"dim.h": {"$gt": 5}, "dim.w": {"$lt": 5}}}}`, want: true},
+		{name: "Dotted path across elements", query: `{"items": {"$elemMatch": {"dim.h": {"$gt": 5}, "dim.w": {"$gt": 5}}}}`, want: false},
+		{name: "Dotted path into an array", query: `{"items": {"$elemMatch": {"parts.id": 3}}}`, want: true},
+		{name: "Nested $elemMatch", query: `{"items": {"$elemMatch": {"sku": "a", "parts": {"$elemMatch": {"id": 2, "ok": false}}}}}`, want: true},
+		{name: "Nested $elemMatch on another element", query: `{"items": {"$elemMatch": {"sku": "b", "parts": {"$elemMatch": {"ok": false}}}}}`, want: false},
+		{name: "$exists false in an element", query: `{"items": {"$elemMatch": {"color": {"$exists": false}, "qty": 5}}}`, want: true},
+		{name: "Empty query matches a document element", query: `{"mixed": {"$elemMatch": {}}}`, want: true},
+		{name: "Empty query on scalars", query: `{"scores": {"$elemMatch": {}}}`, want: false},
+		{name: "Field query skips scalars", query: `{"mixed": {"$elemMatch": {"v": 7}}}`, want: true},
+		{name: "Operators on scalars", query: `{"mixed": {"$elemMatch": {"$gt": 0, "$lt": 2}}}`, want: true},
+		{name: "Operators on elements of one type", query: `{"mixed": {"$elemMatch": {"$type": "string"}}}`, want: true},
+		{name: "Range on one element", query: `{"scores": {"$elemMatch": {"$gt": 80, "$lt": 85}}}`, want: true},
+		{name: "Range met by no single element", query: `{"scores": {"$elemMatch": {"$gt": 85, "$lt": 90}}}`, want: false},
+		{name: "$all with $elemMatch clauses", query: `{"items": {"$all": [{"$elemMatch": {"sku": "a"}}, {"$elemMatch": {"qty": {"$gte": 20}}}]}}`, want: true},
+		{name: "$all with a failing clause", query: `{"items": {"$all": [{"$elemMatch": {"sku": "a"}}, {"$elemMatch": {"qty": {"$gt": 50}}}]}}`, want: false},
+		{name: "$all with operator clauses", query: `{"scores": {"$all": [{"$elemMatch": {"$lt": 60}}, {"$elemMatch": {"$gt": 90}}]}}`, want: true},
+		{name: "Not an array", query: `{"items.0.dim": {"$elemMatch": {"h": 3}}}`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := parseQuery(t, tt.query)
+			for kind, d := range pathAdapters(t, doc) {
+				if got := MatchDocument(query, d); got != tt.want {
+					t.Errorf("%s: MatchDocument() = %v, want %v", kind, got, tt.want)
+				}
+				if got := MustCompile(query).Match(d); got != tt.want {
+					t.Errorf("%s: Query.Match() = %v, want %v", kind, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestElemMatchInvalid(t *testing.T) {
+	for _, query := range []string{
+		`{"a": {"$elemMatch": {"$or": [{"b": {"$foo": 1}}]}}}`,
+		`{"a": {"$elemMatch": {"$or": []}}}`,
+		`{"a": {"$elemMatch": {"b": {"$elemMatch": {"$foo": 1}}}}}`,
+		`{"a": {"$all": [{"$elemMatch": {"b": 1}}, 2]}}`,
+		`{"a": {"$all": [{"$elemMatch": {"b": {"$foo": 1}}}]}}`,
+	} {
+		if _, err := Compile(parseQuery(t, query)); err == nil {
+			t.Errorf("Compile(%s) succeeded, want an error", query)
+		}
+	}
+}
+
+// TestMatchInvalidConditions checks that Match, which does not validate the
+// query, treats an invalid condition as not matching rather than rejecting
+// the whole query
+func TestMatchInvalidConditions(t *testing.T) {
+	doc := map[string]interface{}{"a": 1, "b": "x"}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: `{"a": {"$foo": 1}}`, want: false},
+		{query: `{"b": {"$regex": "("}}`, want: false},
+		{query: `{"$foo": 1}`, want: false},
+		{query: `{"$and": 1}`, want: false},
+		{query: `{"$or": [{"a": {"$foo": 1}}, {"b": "x"}]}`, want: true},
+		{query: `{"$nor": [{"a": {"$foo": 1}}]}`, want: true},
+		{query: `{"a": {"$not": {"$foo": 1}}, "b": "x"}`, want: false},
+		{query: `{"c": {"$exists": false, "$foo": 1}}`, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(parseQuery(t, tt.query), doc); got != tt.want {
+			t.Errorf("Match(%s) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
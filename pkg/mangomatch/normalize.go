@@ -0,0 +1,317 @@
+package mangomatch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Normalize rewrites query into a canonical form that matches exactly the
+// same documents, so that equivalent queries written differently normalize
+// to the same document:
+//
+//   - keys are sorted at every level and the result is a bson.D
+//   - $and clauses, nested $and and single-clause $or are flattened into
+//     their parent; conditions on a field that is already constrained stay
+//     in a residual $and
+//   - nested $or clauses are spliced into their parent $or, and the clauses
+//     of $and, $or and $nor are sorted and deduplicated
+//   - {"$eq": v} and {"$in": [v]} become the implicit {"f": v}, and
+//     {"$nin": [v]} becomes {"$ne": v}
+//   - $in, $nin and $all lists are sorted and deduplicated
+//   - whole-number floats become ints
+//
+// The query is validated with the default engine first.
+func Normalize(query interface{}) (bson.D, error) {
+	q, err := Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeQuery(q.Filter()), nil
+}
+
+// Fingerprint returns a stable hash of the normalized query, suitable as a
+// cache key: queries that normalize to the same document share it.
+func Fingerprint(query interface{}) (string, error) {
+	normalized, err := Normalize(query)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonicalBytes(normalized))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// conjunct is one condition of a query document
+type conjunct struct {
+	key   string
+	value interface{}
+}
+
+func normalizeQuery(query map[string]interface{}) bson.D {
+	conds := collectConjuncts(query, nil)
+	sort.SliceStable(conds, func(i, j int) bool {
+		if conds[i].key != conds[j].key {
+			return conds[i].key < conds[j].key
+		}
+		return bytes.Compare(canonicalValue(conds[i].value), canonicalValue(conds[j].value)) < 0
+	})
+
+	// The first condition on each key stays at the top level; further
+	// conditions on the same field cannot be merged without changing which
+	// array elements must satisfy them, so they go into $and
+	out := bson.D{}
+	var residual []interface{}
+	seen := make(map[string]bool)
+	for i, c := range conds {
+		if i > 0 && c.key == conds[i-1].key && bytes.Equal(canonicalValue(c.value), canonicalValue(conds[i-1].value)) {
+			// The same condition twice
+			continue
+		}
+		if c.key == "$and" || seen[c.key] {
+			residual = append(residual, bson.D{{Key: c.key, Value: c.value}})
+			continue
+		}
+		seen[c.key] = true
+		out = append(out, bson.E{Key: c.key, Value: c.value})
+	}
+	if len(residual) > 0 {
+		out = append(out, bson.E{Key: "$and", Value: sortClauses(residual)})
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	}
+	return out
+}
+
+// collectConjuncts appends the normalized conditions of query to conds,
+// flattening $and and single-clause $or
+func collectConjuncts(query map[string]interface{}, conds []conjunct) []conjunct {
+	for key, value := range query {
+		switch key {
+		case "$and":
+			clauses, _ := value.([]interface{})
+			for _, clause := range clauses {
+				sub, _ := clause.(map[string]interface{})
+				if len(sub) == 0 {
+					// An empty query matches nothing, so it cannot be
+					// flattened away
+					conds = append(conds, conjunct{key: "$and", value: bson.A{bson.D{}}})
+					continue
+				}
+				conds = collectConjuncts(sub, conds)
+			}
+		case "$or":
+			clauses := normalizeOr(value)
+			if len(clauses) == 1 && len(clauses[0].(bson.D)) > 0 {
+				conds = append(conds, conjunctsOf(clauses[0].(bson.D))...)
+				continue
+			}
+			conds = append(conds, conjunct{key: key, value: clauses})
+		case "$nor":
+			conds = append(conds, conjunct{key: key, value: normalizeClauses(value)})
+		default:
+			conds = append(conds, conjunct{key: key, value: normalizeCondition(value)})
+		}
+	}
+	return conds
+}
+
+// conjunctsOf splits a normalized query back into its conditions, so that
+// a flattened $or clause merges with the conditions around it
+func conjunctsOf(doc bson.D) []conjunct {
+	var conds []conjunct
+	for _, e := range doc {
+		if e.Key == "$and" {
+			for _, clause := range e.Value.(bson.A) {
+				conds = append(conds, conjunctsOf(clause.(bson.D))...)
+			}
+			continue
+		}
+		conds = append(conds, conjunct{key: e.Key, value: e.Value})
+	}
+	return conds
+}
+
+// normalizeOr normalizes the clauses of $or, splicing in the clauses of any
+// clause that is itself only an $or
+func normalizeOr(value interface{}) bson.A {
+	var clauses []interface{}
+	for _, clause := range normalizeClauses(value) {
+		doc := clause.(bson.D)
+		if len(doc) == 1 && doc[0].Key == "$or" {
+			clauses = append(clauses, doc[0].Value.(bson.A)...)
+			continue
+		}
+		clauses = append(clauses, doc)
+	}
+	return sortClauses(clauses)
+}
+
+func normalizeClauses(value interface{}) bson.A {
+	clauses, _ := value.([]interface{})
+	out := make([]interface{}, len(clauses))
+	for i, clause := range clauses {
+		sub, _ := clause.(map[string]interface{})
+		out[i] = normalizeQuery(sub)
+	}
+	return sortClauses(out)
+}
+
+// sortClauses sorts values by their canonical encoding and drops duplicates
+func sortClauses(values []interface{}) bson.A {
+	type keyed struct {
+		key   []byte
+		value interface{}
+	}
+	items := make([]keyed, len(values))
+	for i, v := range values {
+		items[i] = keyed{key: canonicalValue(v), value: v}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return bytes.Compare(items[i].key, items[j].key) < 0 })
+
+	out := bson.A{}
+	for i, item := range items {
+		if i > 0 && bytes.Equal(item.key, items[i-1].key) {
+			continue
+		}
+		out = append(out, item.value)
+	}
+	return out
+}
+
+// normalizeCondition normalizes the value of a field condition
+func normalizeCondition(value interface{}) interface{} {
+	ops, ok := value.(map[string]interface{})
+	if !ok {
+		return normalizeValue(value)
+	}
+	if !isOperatorMap(ops) {
+		return normalizeValue(ops)
+	}
+
+	out := normalizeOperators(ops)
+	if len(out) == 1 && out[0].Key == "$eq" {
+		if _, isDoc := out[0].Value.(bson.D); !isDoc {
+			// A document operand would read as embedded document equality
+			return out[0].Value
+		}
+	}
+	return out
+}
+
+// normalizeOperators normalizes an operator document; {"$in": [v]} becomes
+// {"$eq": v} and {"$nin": [v]} becomes {"$ne": v} when that operator is not
+// already present, and regex options become a (?flags) prefix
+func normalizeOperators(ops map[string]interface{}) bson.D {
+	out := bson.D{}
+	for op, operand := range withRegexOptions(ops) {
+		switch op {
+		case "$in", "$nin", "$all":
+			list := normalizeList(operand)
+			if op == "$all" {
+				normalizeElemMatchClauses(operand, list)
+			}
+			values := sortClauses(list)
+			single := map[string]string{"$in": "$eq", "$nin": "$ne"}[op]
+			if _, taken := ops[single]; single != "" && len(values) == 1 && !taken {
+				if _, isDoc := values[0].(bson.D); !isDoc {
+					out = append(out, bson.E{Key: single, Value: values[0]})
+					continue
+				}
+			}
+			out = append(out, bson.E{Key: op, Value: values})
+		case "$not":
+			sub, _ := operand.(map[string]interface{})
+			out = append(out, bson.E{Key: op, Value: normalizeOperators(sub)})
+		case "$elemMatch":
+			sub, _ := operand.(map[string]interface{})
+			if isElemMatchOperators(sub) {
+				out = append(out, bson.E{Key: op, Value: normalizeOperators(sub)})
+			} else {
+				out = append(out, bson.E{Key: op, Value: normalizeValue(sub)})
+			}
+		case "$regex":
+			if pattern, err := regexPattern(operand); err == nil {
+				operand = pattern
+			}
+			out = append(out, bson.E{Key: op, Value: operand})
+		default:
+			out = append(out, bson.E{Key: op, Value: normalizeValue(operand)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// normalizeElemMatchClauses normalizes the {"$elemMatch": ...} clauses among
+// the $all items as operators rather than values
+func normalizeElemMatchClauses(operand interface{}, values []interface{}) {
+	items, _ := operand.([]interface{})
+	for i, item := range items {
+		if clause, ok := item.(map[string]interface{}); ok && len(clause) == 1 && clause["$elemMatch"] != nil {
+			values[i] = normalizeOperators(clause)
+		}
+	}
+}
+
+func normalizeList(operand interface{}) []interface{} {
+	values, _ := operand.([]interface{})
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = normalizeValue(v)
+	}
+	return out
+}
+
+// normalizeValue sorts the keys of embedded documents and turns sized numbers
+// and whole-number floats into ints, which compare equal to them
+func normalizeValue(value interface{}) interface{} {
+	switch v := widenNumber(value).(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int(v)
+		}
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make(bson.D, len(keys))
+		for i, k := range keys {
+			out[i] = bson.E{Key: k, Value: normalizeValue(v[k])}
+		}
+		return out
+	case []interface{}:
+		out := make(bson.A, len(v))
+		for i, item := range v {
+			out[i] = normalizeValue(item)
+		}
+		return out
+	case time.Time:
+		return v.UTC()
+	default:
+		return v
+	}
+}
+
+// canonicalBytes encodes a normalized document as canonical Extended JSON,
+// which keeps key order and distinguishes value types
+func canonicalBytes(doc bson.D) []byte {
+	data, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		// Only operands bson cannot encode, which custom operators may
+		// take, get here
+		return []byte(fmt.Sprintf("%#v", doc))
+	}
+	return data
+}
+
+func canonicalValue(v interface{}) []byte {
+	return canonicalBytes(bson.D{{Key: "v", Value: v}})
+}
@@ -0,0 +1,147 @@
+package mangomatch
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// normalizeDocs exercises arrays, nested documents and missing fields
+var normalizeDocs = []map[string]interface{}{
+	{},
+	{"a": 1, "b": "x", "tags": []interface{}{"x", "y"}},
+	{"a": 2.5, "b": "y", "tags": []interface{}{}, "n": nil},
+	{"a": []interface{}{1, 5}, "b": []interface{}{"x", "z"}, "c": true},
+	{"a": "1", "items": []interface{}{map[string]interface{}{"q": 1}, map[string]interface{}{"q": 7}}},
+	{"a": 5, "c": false, "d": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{"b": "x", "items": []interface{}{map[string]interface{}{"q": 4}}},
+}
+
+func TestNormalizeEquivalent(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"Key order", `{"a": 1, "b": "x"}`, `{"b": "x", "a": 1}`},
+		{"$eq", `{"a": {"$eq": 1}}`, `{"a": 1}`},
+		{"Single $in", `{"a": {"$in": [1]}}`, `{"a": 1}`},
+		{"Single $nin", `{"a": {"$nin": [1]}}`, `{"a": {"$ne": 1}}`},
+		{"$in order and duplicates", `{"a": {"$in": [3, 1, 3, 2]}}`, `{"a": {"$in": [1, 2, 3]}}`},
+		{"Whole floats", `{"a": {"$gt": 1.0, "$in": [2.0, 3]}}`, `{"a": {"$in": [3, 2], "$gt": 1}}`},
+		{"Single $and", `{"$and": [{"a": 1}]}`, `{"a": 1}`},
+		{"Nested $and", `{"$and": [{"a": 1}, {"$and": [{"b": "x"}, {"c": true}]}]}`, `{"a": 1, "b": "x", "c": true}`},
+		{"$and mixed with fields", `{"c": true, "$and": [{"a": 1}, {"b": "x"}]}`, `{"a": 1, "b": "x", "c": true}`},
+		{"Single $or", `{"$or": [{"a": 1, "b": "x"}]}`, `{"b": "x", "a": 1}`},
+		{"Nested $or", `{"$or": [{"a": 1}, {"$or": [{"b": "x"}, {"c": true}]}]}`, `{"$or": [{"c": true}, {"b": "x"}, {"a": 1}]}`},
+		{"$or duplicates", `{"$or": [{"a": 1}, {"a": {"$eq": 1}}, {"b": "x"}]}`, `{"$or": [{"b": "x"}, {"a": 1}]}`},
+		{"Repeated field in $and", `{"$and": [{"a": {"$gt": 1}}, {"a": {"$lt": 5}}]}`, `{"$and": [{"a": {"$lt": 5}}, {"a": {"$gt": 1}}]}`},
+		{"Duplicate condition", `{"$and": [{"a": 1}, {"a": 1}]}`, `{"a": 1}`},
+		{"$not inner", `{"a": {"$not": {"$in": [2]}}}`, `{"a": {"$not": {"$eq": 2}}}`},
+		{"$elemMatch clauses of $all", `{"items": {"$all": [{"$elemMatch": {"q": {"$gt": 1}}}, {"$elemMatch": {"$in": [4]}}]}}`, `{"items": {"$all": [{"$elemMatch": {"$eq": 4}}, {"$elemMatch": {"q": {"$gt": 1}}}]}}`},
+		{"Regex options", `{"a": {"$regex": "x", "$options": "si"}}`, `{"a": {"$regex": {"$regularExpression": {"pattern": "x", "options": "is"}}}}`},
+		{"Regex flags", `{"a": {"$regex": "x", "$options": "i"}}`, `{"a": {"$regex": "(?i)x"}}`},
+		{"$nor clause order", `{"$nor": [{"a": 1}, {"b": "x"}]}`, `{"$nor": [{"b": "x"}, {"a": {"$eq": 1}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := parseQuery(t, tt.a), parseQuery(t, tt.b)
+			fa, err := Fingerprint(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fb, err := Fingerprint(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fa != fb {
+				na, _ := Normalize(a)
+				nb, _ := Normalize(b)
+				t.Errorf("fingerprints differ:\n%v\n%v", na, nb)
+			}
+			checkNormalizePreserves(t, a)
+			checkNormalizePreserves(t, b)
+		})
+	}
+}
+
+func TestNormalizeDistinct(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"Values", `{"a": 1}`, `{"a": 2}`},
+		{"Types", `{"a": 1}`, `{"a": "1"}`},
+		{"Fractional float", `{"a": 1}`, `{"a": 1.5}`},
+		{"Operators", `{"a": {"$gt": 1}}`, `{"a": {"$gte": 1}}`},
+		{"Or versus and", `{"$or": [{"a": 1}, {"b": "x"}]}`, `{"a": 1, "b": "x"}`},
+		{"Nor", `{"$nor": [{"a": 1}]}`, `{"a": {"$ne": 1}}`},
+		{"$all is not $eq", `{"tags": {"$all": ["x"]}}`, `{"tags": "x"}`},
+		{"Empty clause", `{"a": 1, "$and": [{}]}`, `{"a": 1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fa, _ := Fingerprint(parseQuery(t, tt.a))
+			fb, _ := Fingerprint(parseQuery(t, tt.b))
+			if fa == fb {
+				t.Errorf("Expected different fingerprints for %s and %s", tt.a, tt.b)
+			}
+			checkNormalizePreserves(t, parseQuery(t, tt.a))
+			checkNormalizePreserves(t, parseQuery(t, tt.b))
+		})
+	}
+}
+
+func TestNormalizeForm(t *testing.T) {
+	got, err := Normalize(bson.D{
+		{Key: "z", Value: bson.M{"$in": bson.A{2.0}}},
+		{Key: "$and", Value: bson.A{bson.M{"a": bson.M{"$lt": 5}}, bson.M{"a": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{
+		{Key: "$and", Value: bson.A{bson.D{{Key: "a", Value: bson.D{{Key: "$lt", Value: 5}}}}}},
+		{Key: "a", Value: bson.D{{Key: "$gt", Value: 1}}},
+		{Key: "z", Value: 2},
+	}
+	gotJSON, _ := bson.MarshalExtJSON(got, true, false)
+	wantJSON, _ := bson.MarshalExtJSON(want, true, false)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("Normalize() = %s, want %s", gotJSON, wantJSON)
+	}
+
+	if _, err := Normalize(map[string]interface{}{"a": map[string]interface{}{"$foo": 1}}); err == nil {
+		t.Error("Expected an error for an invalid query")
+	}
+	if _, err := Fingerprint("nope"); err == nil {
+		t.Error("Expected an error for a query that is not a document")
+	}
+}
+
+func parseQuery(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	q, err := ParseExtJSON([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// checkNormalizePreserves checks that the normalized query matches the
+// same documents as query
+func checkNormalizePreserves(t *testing.T, query map[string]interface{}) {
+	t.Helper()
+	normalized, err := Normalize(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nq := MustCompile(normalized)
+	for _, doc := range normalizeDocs {
+		if got, want := nq.Match(doc), Match(query, doc); got != want {
+			t.Errorf("normalized %v matches %v: %v, original %v", normalized, doc, got, want)
+		}
+	}
+}
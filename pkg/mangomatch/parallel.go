@@ -0,0 +1,197 @@
+package mangomatch
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelOptions configures FilterParallel and FilterParallelFunc
+type ParallelOptions struct {
+	// Workers is the number of goroutines evaluating the query; zero uses
+	// runtime.GOMAXPROCS(0)
+	Workers int
+	// ChunkSize is the number of items a worker takes at a time; zero uses
+	// 1024
+	ChunkSize int
+	// PreserveOrder delivers matches in the order of the input. Otherwise
+	// matches are delivered as chunks complete.
+	PreserveOrder bool
+	// Limit stops evaluation once this many matches have been delivered;
+	// zero delivers every match
+	Limit int
+}
+
+const defaultChunkSize = 1024
+
+// FilterParallel is like Filter, but evaluates the query on opts.Workers
+// goroutines sharing one compiled query. Items must be safe to read
+// concurrently.
+func FilterParallel[T any](ctx context.Context, items []T, query interface{}, opts ParallelOptions) ([]T, error) {
+	var out []T
+	err := FilterParallelFunc(ctx, items, query, opts, func(item T) bool {
+		out = append(out, item)
+		return true
+	})
+	return out, err
+}
+
+// FilterParallelFunc evaluates the query like FilterParallel and calls fn
+// with each match as soon as it can be delivered. fn is called from the
+// calling goroutine only; returning false stops evaluation. It returns
+// ctx.Err() if ctx is done first, or the *LimitError of a query compiled
+// with limits.
+func FilterParallelFunc[T any](ctx context.Context, items []T, query interface{}, opts ParallelOptions, fn func(T) bool) error {
+	q, err := Compile(query)
+	if err != nil {
+		return err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	chunks := (len(items) + chunkSize - 1) / chunkSize
+	if workers > chunks {
+		workers = chunks
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		chunk   int
+		matches []T
+		err     error
+	}
+
+	// A worker holds a token from taking a chunk until the collector has
+	// delivered it, which bounds the results buffered for PreserveOrder
+	window := 2 * workers
+	tokens := make(chan struct{}, window)
+	results := make(chan result, window)
+	var next int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case tokens <- struct{}{}:
+				case <-runCtx.Done():
+					return
+				}
+				chunk := int(atomic.AddInt64(&next, 1) - 1)
+				if chunk >= chunks {
+					return
+				}
+				end := (chunk + 1) * chunkSize
+				if end > len(items) {
+					end = len(items)
+				}
+				res := result{chunk: chunk}
+				res.matches, res.err = matchChunk(runCtx, q, items[chunk*chunkSize:end])
+				results <- res
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	delivered := 0
+	stopped := false
+	var firstErr error
+	deliver := func(res result) {
+		<-tokens
+		if stopped {
+			return
+		}
+		if res.err != nil {
+			firstErr, stopped = res.err, true
+			return
+		}
+		for _, item := range res.matches {
+			if !fn(item) {
+				stopped = true
+				return
+			}
+			delivered++
+			if opts.Limit > 0 && delivered >= opts.Limit {
+				stopped = true
+				return
+			}
+		}
+	}
+
+	pending := make(map[int]result)
+	emit := 0
+	for res := range results {
+		if !opts.PreserveOrder {
+			deliver(res)
+		} else {
+			pending[res.chunk] = res
+			for {
+				r, ok := pending[emit]
+				if !ok {
+					break
+				}
+				delete(pending, emit)
+				emit++
+				deliver(r)
+			}
+		}
+		if stopped {
+			cancel()
+		}
+	}
+
+	// Results after a stop are discarded, so firstErr is never caused by
+	// our own cancellation
+	if firstErr != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return firstErr
+	}
+	if !stopped {
+		// Workers leave without reporting once ctx is done
+		return ctx.Err()
+	}
+	return nil
+}
+
+// matchChunk returns the items of chunk that match q
+func matchChunk[T any](ctx context.Context, q *Query, chunk []T) ([]T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var matches []T
+	if q.limits == (Limits{}) {
+		for _, item := range chunk {
+			if q.Match(item) {
+				matches = append(matches, item)
+			}
+		}
+		return matches, nil
+	}
+
+	for _, item := range chunk {
+		ok, err := q.MatchContext(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, item)
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,155 @@
+package mangomatch
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+)
+
+func parallelDocs(n int) []map[string]interface{} {
+	docs := make([]map[string]interface{}, n)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"i": i, "even": i%2 == 0, "tags": []interface{}{"a", i % 7}}
+	}
+	return docs
+}
+
+func TestFilterParallel(t *testing.T) {
+	docs := parallelDocs(10000)
+	query := map[string]interface{}{"even": true, "tags": 3}
+	want, err := Filter(docs, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts ParallelOptions
+	}{
+		{name: "Defaults", opts: ParallelOptions{}},
+		{name: "Ordered", opts: ParallelOptions{Workers: 8, ChunkSize: 7, PreserveOrder: true}},
+		{name: "Unordered", opts: ParallelOptions{Workers: 8, ChunkSize: 100}},
+		{name: "One worker", opts: ParallelOptions{Workers: 1, ChunkSize: 3, PreserveOrder: true}},
+		{name: "More workers than chunks", opts: ParallelOptions{Workers: 64, ChunkSize: 5000, PreserveOrder: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FilterParallel(context.Background(), docs, query, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.opts.PreserveOrder {
+				sort.Slice(got, func(i, j int) bool { return got[i]["i"].(int) < got[j]["i"].(int) })
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d matches, want %d", len(got), len(want))
+			}
+			for i := range got {
+				if got[i]["i"] != want[i]["i"] {
+					t.Fatalf("match %d = %v, want %v", i, got[i]["i"], want[i]["i"])
+				}
+			}
+		})
+	}
+
+	empty, err := FilterParallel(context.Background(), []map[string]interface{}{}, query, ParallelOptions{})
+	if err != nil || len(empty) != 0 {
+		t.Errorf("FilterParallel(empty) = %v, %v", empty, err)
+	}
+}
+
+func TestFilterParallelLimit(t *testing.T) {
+	docs := parallelDocs(10000)
+	query := map[string]interface{}{"even": true}
+
+	got, err := FilterParallel(context.Background(), docs, query, ParallelOptions{Workers: 4, ChunkSize: 10, PreserveOrder: true, Limit: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 25 {
+		t.Fatalf("got %d matches, want 25", len(got))
+	}
+	for i, doc := range got {
+		if doc["i"] != 2*i {
+			t.Fatalf("match %d = %v, want the first matches in order", i, doc["i"])
+		}
+	}
+
+	got, err = FilterParallel(context.Background(), docs, query, ParallelOptions{Workers: 4, ChunkSize: 10, Limit: 25})
+	if err != nil || len(got) != 25 {
+		t.Fatalf("unordered Limit: got %d matches, err %v", len(got), err)
+	}
+
+	// Returning false from the callback stops delivery
+	calls := 0
+	err = FilterParallelFunc(context.Background(), docs, query, ParallelOptions{Workers: 4, ChunkSize: 10}, func(map[string]interface{}) bool {
+		calls++
+		return calls < 3
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("FilterParallelFunc() made %d calls, err %v; want 3", calls, err)
+	}
+}
+
+func TestFilterParallelErrors(t *testing.T) {
+	docs := parallelDocs(1000)
+
+	if _, err := FilterParallel(context.Background(), docs, map[string]interface{}{"i": map[string]interface{}{"$foo": 1}}, ParallelOptions{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := FilterParallel(ctx, docs, map[string]interface{}{"even": true}, ParallelOptions{ChunkSize: 10}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	e := NewEngine()
+	e.SetLimits(Limits{MaxArrayScan: 1})
+	q, err := e.Compile(map[string]interface{}{"tags": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limitErr *LimitError
+	if _, err := FilterParallel(context.Background(), docs, q, ParallelOptions{ChunkSize: 10, PreserveOrder: true}); !errors.As(err, &limitErr) {
+		t.Errorf("Expected a LimitError, got %v", err)
+	}
+}
+
+func BenchmarkFilterParallel(b *testing.B) {
+	docs := parallelDocs(100000)
+	query := map[string]interface{}{
+		"even": true,
+		"i":    map[string]interface{}{"$gte": 100, "$lt": 90000},
+		"tags": map[string]interface{}{"$in": []interface{}{3, 5}},
+	}
+
+	b.Run("Sequential", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			var out []map[string]interface{}
+			for _, doc := range docs {
+				if Match(query, doc) {
+					out = append(out, doc)
+				}
+			}
+		}
+	})
+	b.Run("Filter", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			_, _ = Filter(docs, query)
+		}
+	})
+	for _, ordered := range []bool{false, true} {
+		name := "Parallel"
+		if ordered {
+			name = "ParallelOrdered"
+		}
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				_, _ = FilterParallel(context.Background(), docs, query, ParallelOptions{PreserveOrder: ordered})
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package mangomatch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDenied is wrapped by the errors a Policy returns for queries it
+// refuses
+var ErrDenied = errors.New("mangomatch: denied by policy")
+
+// PolicyOptions configures NewPolicy
+type PolicyOptions struct {
+	// Operators lists the operators queries may use, logical ones such as
+	// "$or" included; implicit equality counts as "$eq". Nil allows every
+	// operator of the engine.
+	Operators []string
+	// Projection redacts the documents returned by Filter and Redact.
+	// Queries may not use the fields it hides, which they could otherwise
+	// probe one condition at a time.
+	Projection map[string]interface{}
+	// Engine evaluates queries; nil uses the default engine
+	Engine *Engine
+}
+
+// Policy enforces row-level security for one principal. Every query is
+// restricted to the documents the policy filter selects, may only use the
+// allowed operators, and the documents it returns are redacted:
+//
+//	p, err := mangomatch.NewPolicy(bson.M{"tenant": user.Tenant}, mangomatch.PolicyOptions{
+//		Operators:  []string{"$eq", "$in", "$gt", "$lt", "$and", "$or"},
+//		Projection: bson.M{"ssn": 0},
+//	})
+//	docs, err := p.Filter(userQuery, all)
+type Policy struct {
+	filter     map[string]interface{}
+	operators  map[string]bool
+	projection map[string]interface{}
+	include    bool
+	engine     *Engine
+}
+
+// NewPolicy returns a Policy restricting queries to the documents filter
+// selects. A nil or empty filter allows every document.
+func NewPolicy(filter interface{}, opts PolicyOptions) (*Policy, error) {
+	p := &Policy{engine: opts.Engine, projection: opts.Projection}
+	if p.engine == nil {
+		p.engine = defaultEngine
+	}
+	if filter != nil {
+		q, err := p.engine.Compile(filter)
+		if err != nil {
+			return nil, err
+		}
+		p.filter = q.Filter()
+	}
+	if opts.Operators != nil {
+		p.operators = make(map[string]bool, len(opts.Operators))
+		for _, op := range opts.Operators {
+			p.operators[op] = true
+		}
+	}
+	if p.projection != nil {
+		include, err := projectionMode(p.projection)
+		if err != nil {
+			return nil, err
+		}
+		p.include = include
+	}
+	return p, nil
+}
+
+// Restrict checks query against the policy and returns it ANDed with the
+// policy filter, so that not even a top-level $or can select documents
+// outside it. The result can be passed on to a $match stage or a MongoDB
+// find; like those, an empty result selects every document.
+func (p *Policy) Restrict(query interface{}) (map[string]interface{}, error) {
+	filter, err := p.restrict(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter) > 0 {
+		if _, err := p.engine.Compile(filter); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// Match reports whether doc matches both query and the policy filter
+func (p *Policy) Match(query interface{}, doc interface{}) (bool, error) {
+	q, err := p.compile(query)
+	if err != nil {
+		return false, err
+	}
+	return q == nil || q.Match(doc), nil
+}
+
+// Filter returns the documents that match both query and the policy
+// filter, redacted by the projection
+func (p *Policy) Filter(query interface{}, docs []map[string]interface{}) ([]map[string]interface{}, error) {
+	q, err := p.compile(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []map[string]interface{}
+	for _, doc := range docs {
+		if q != nil && !q.Match(doc) {
+			continue
+		}
+		redacted, err := p.Redact(doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, redacted)
+	}
+	return out, nil
+}
+
+// Redact returns a copy of doc shaped by the projection, or doc itself if
+// the policy has none
+func (p *Policy) Redact(doc map[string]interface{}) (map[string]interface{}, error) {
+	if p.projection == nil {
+		return doc, nil
+	}
+	return Project(doc, p.projection)
+}
+
+// compile returns the restricted query, or nil if it selects every
+// document
+func (p *Policy) compile(query interface{}) (*Query, error) {
+	filter, err := p.restrict(query)
+	if err != nil || len(filter) == 0 {
+		return nil, err
+	}
+	return p.engine.Compile(filter)
+}
+
+func (p *Policy) restrict(query interface{}) (map[string]interface{}, error) {
+	var filter map[string]interface{}
+	switch q := query.(type) {
+	case nil:
+	case *Query:
+		filter = q.Filter()
+	default:
+		var ok bool
+		if filter, ok = ConvertBSON(query).(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%w: expected a document, got %T", ErrInvalidQuery, query)
+		}
+	}
+	if err := p.check(filter, ""); err != nil {
+		return nil, err
+	}
+
+	// The policy filter is copied so that callers cannot change it
+	policy, _ := copyValue(p.filter).(map[string]interface{})
+	switch {
+	case len(filter) == 0:
+		return policy, nil
+	case len(policy) == 0:
+		return filter, nil
+	}
+	return map[string]interface{}{"$and": []interface{}{policy, filter}}, nil
+}
+
+// check rejects the operators outside the allowlist and the fields the
+// projection hides; prefix is the path of the enclosing $elemMatch
+func (p *Policy) check(query map[string]interface{}, prefix string) error {
+	for key, value := range query {
+		if strings.HasPrefix(key, "$") {
+			if err := p.allow(key); err != nil {
+				return err
+			}
+			clauses, _ := value.([]interface{})
+			for _, clause := range clauses {
+				if sub, ok := clause.(map[string]interface{}); ok {
+					if err := p.check(sub, prefix); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+
+		path := prefix + key
+		if !p.visible(path) {
+			return fmt.Errorf("%w: field %q is not visible", ErrDenied, path)
+		}
+		if err := p.checkCondition(path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Policy) checkCondition(path string, value interface{}) error {
+	ops, ok := value.(map[string]interface{})
+	if !ok || !isOperatorMap(ops) {
+		return p.allow("$eq")
+	}
+	for op, operand := range ops {
+		if err := p.allow(op); err != nil {
+			return err
+		}
+		sub, _ := operand.(map[string]interface{})
+		var err error
+		switch {
+		case op == "$not" && isOperatorMap(sub), op == "$elemMatch" && isElemMatchOperators(sub):
+			err = p.checkCondition(path, sub)
+		case op == "$elemMatch":
+			err = p.check(sub, path+".")
+		case op == "$all":
+			// $all may hold $elemMatch clauses
+			items, _ := operand.([]interface{})
+			for _, item := range items {
+				if clause, ok := item.(map[string]interface{}); ok && isOperatorMap(clause) && err == nil {
+					err = p.checkCondition(path, clause)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Policy) allow(op string) error {
+	if p.operators != nil && !p.operators[op] {
+		return fmt.Errorf("%w: operator %s is not allowed", ErrDenied, op)
+	}
+	return nil
+}
+
+// visible reports whether the projection leaves path and everything under
+// it in the documents it returns
+func (p *Policy) visible(path string) bool {
+	if p.projection == nil {
+		return true
+	}
+	if !p.include {
+		covered, partial, _ := p.walkProjection(path, false)
+		return !covered && !partial
+	}
+
+	if path == "_id" || strings.HasPrefix(path, "_id.") {
+		flag, ok := p.projection["_id"]
+		return !ok || projectionFlag(flag)
+	}
+	_, partial, escaped := p.walkProjection(path, true)
+	return !partial && !escaped
+}
+
+// walkProjection follows path through the projection keys whose flag is
+// flag. The matcher reads a numeric segment either as an array index or as
+// a field name, so both readings are followed. It reports whether some
+// reading reaches the end of a key (covered), stops short of one
+// (partial) or leaves them all (escaped).
+func (p *Policy) walkProjection(path string, flag bool) (covered, partial, escaped bool) {
+	keys := make(map[string]bool)
+	prefixes := make(map[string]bool)
+	for key, value := range p.projection {
+		if projectionFlag(value) != flag {
+			continue
+		}
+		keys[key] = true
+		for i := range key {
+			if key[i] == '.' {
+				prefixes[key[:i]] = true
+			}
+		}
+	}
+
+	type step struct {
+		next   int
+		prefix string
+	}
+	parts := strings.Split(path, ".")
+	seen := make(map[step]bool)
+	var walk func(s step)
+	walk = func(s step) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		if s.next == len(parts) {
+			partial = true
+			return
+		}
+		part := parts[s.next]
+		name := part
+		if s.prefix != "" {
+			name = s.prefix + "." + part
+		}
+		switch {
+		case keys[name]:
+			covered = true
+		case prefixes[name]:
+			walk(step{s.next + 1, name})
+		default:
+			escaped = true
+		}
+		if _, ok := arrayIndex(part); ok {
+			walk(step{s.next + 1, s.prefix})
+		}
+	}
+	walk(step{})
+	return covered, partial, escaped
+}
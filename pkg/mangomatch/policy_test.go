@@ -0,0 +1,236 @@
+package mangomatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPolicyMatch(t *testing.T) {
+	p, err := NewPolicy(bson.M{"tenant": "acme"}, PolicyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query interface{}
+		doc   map[string]interface{}
+		want  bool
+	}{
+		{
+			name:  "Query within the tenant",
+			query: map[string]interface{}{"status": "open"},
+			doc:   map[string]interface{}{"tenant": "acme", "status": "open"},
+			want:  true,
+		},
+		{
+			name:  "Query outside the tenant",
+			query: map[string]interface{}{"status": "open"},
+			doc:   map[string]interface{}{"tenant": "other", "status": "open"},
+			want:  false,
+		},
+		{
+			name: "Top-level $or cannot escape",
+			query: map[string]interface{}{"$or": []interface{}{
+				map[string]interface{}{"tenant": "other"},
+				map[string]interface{}{"status": "open"},
+			}},
+			doc:  map[string]interface{}{"tenant": "other", "status": "open"},
+			want: false,
+		},
+		{
+			name:  "Overriding the tenant field",
+			query: map[string]interface{}{"tenant": "other"},
+			doc:   map[string]interface{}{"tenant": "other"},
+			want:  false,
+		},
+		{
+			name:  "Empty query selects the whole tenant",
+			query: map[string]interface{}{},
+			doc:   map[string]interface{}{"tenant": "acme"},
+			want:  true,
+		},
+		{
+			name:  "Nil query",
+			query: nil,
+			doc:   map[string]interface{}{"tenant": "other"},
+			want:  false,
+		},
+		{
+			name:  "Compiled query",
+			query: MustCompile(map[string]interface{}{"status": "open"}),
+			doc:   map[string]interface{}{"tenant": "acme", "status": "open"},
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Match(tt.query, tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDenied(t *testing.T) {
+	p, err := NewPolicy(bson.M{"tenant": "acme"}, PolicyOptions{
+		Operators:  []string{"$eq", "$in", "$all", "$gt", "$lt", "$and", "$or", "$elemMatch"},
+		Projection: map[string]interface{}{"ssn": 0, "salary.base": 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		denied bool
+	}{
+		{name: "Allowed operators", query: `{"age": {"$gt": 18, "$lt": 65}, "$or": [{"role": "a"}, {"role": {"$in": ["b"]}}]}`},
+		{name: "Denied operator", query: `{"name": {"$regex": "^a"}}`, denied: true},
+		{name: "Denied logical operator", query: `{"$nor": [{"role": "a"}]}`, denied: true},
+		{name: "Denied operator inside $or", query: `{"$or": [{"role": "a"}, {"name": {"$regex": "^a"}}]}`, denied: true},
+		{name: "Denied operator inside $elemMatch", query: `{"items": {"$elemMatch": {"qty": {"$exists": true}}}}`, denied: true},
+		{name: "Hidden field", query: `{"ssn": "123"}`, denied: true},
+		{name: "Hidden field inside $and", query: `{"$and": [{"ssn": {"$gt": "1"}}]}`, denied: true},
+		{name: "Field under a hidden field", query: `{"ssn.last4": "1234"}`, denied: true},
+		{name: "Field containing a hidden field", query: `{"salary": {"$gt": 1}}`, denied: true},
+		{name: "Visible sibling of a hidden field", query: `{"salary.bonus": {"$gt": 1}}`},
+		{name: "Hidden field inside $elemMatch", query: `{"salary": {"$elemMatch": {"base": 1}}}`, denied: true},
+		{name: "Hidden field inside $or of $elemMatch", query: `{"salary": {"$elemMatch": {"$or": [{"base": 1}]}}}`, denied: true},
+		{name: "Hidden field inside $all", query: `{"salary": {"$all": [{"$elemMatch": {"base": 1}}]}}`, denied: true},
+		{name: "Hidden field through an array index", query: `{"salary.0.base": 1}`, denied: true},
+		{name: "Array element containing a hidden field", query: `{"salary.0": {"$gt": 1}}`, denied: true},
+		{name: "Visible field through an array index", query: `{"salary.0.bonus": {"$gt": 1}}`},
+		{name: "Denied operator inside $all", query: `{"items": {"$all": [{"$elemMatch": {"qty": {"$exists": true}}}]}}`, denied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Restrict(parseQuery(t, tt.query))
+			if tt.denied != errors.Is(err, ErrDenied) {
+				t.Errorf("Restrict() error = %v, want denied %v", err, tt.denied)
+			}
+			if !tt.denied && err != nil {
+				t.Errorf("Restrict() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestPolicyVisibleWithInclusion(t *testing.T) {
+	p, err := NewPolicy(nil, PolicyOptions{Projection: map[string]interface{}{"name": 1, "address.city": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{
+		"_id":          true,
+		"name":         true,
+		"name.first":   true,
+		"address.city": true,
+		"address":      false,
+		"address.zip":  false,
+		"email":        false,
+		"address.0":    false,
+		// "0" may also name a field of address that the projection drops
+		"address.0.city": false,
+		"address.0.zip":  false,
+		"name.0":         true,
+	} {
+		if got := p.visible(path); got != want {
+			t.Errorf("visible(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestPolicyFilter(t *testing.T) {
+	p, err := NewPolicy(bson.M{"tenant": "acme"}, PolicyOptions{Projection: map[string]interface{}{"ssn": 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []map[string]interface{}{
+		{"tenant": "acme", "name": "ann", "ssn": "1"},
+		{"tenant": "other", "name": "bob", "ssn": "2"},
+		{"tenant": "acme", "name": "cid", "ssn": "3"},
+	}
+
+	got, err := p.Filter(map[string]interface{}{"name": map[string]interface{}{"$ne": "cid"}}, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{{"tenant": "acme", "name": "ann"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter() = %v, want %v", got, want)
+	}
+	if _, ok := docs[0]["ssn"]; !ok {
+		t.Error("Filter() modified its input")
+	}
+
+	all, err := p.Filter(nil, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("Filter(nil) returned %d documents, want 2", len(all))
+	}
+}
+
+func TestPolicyRestrict(t *testing.T) {
+	p, err := NewPolicy(bson.M{"tenant": "acme"}, PolicyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := p.Restrict(bson.M{"status": "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"$and": []interface{}{
+		map[string]interface{}{"tenant": "acme"},
+		map[string]interface{}{"status": "open"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Restrict() = %v, want %v", got, want)
+	}
+
+	// Changing the result must not change the policy
+	got["$and"].([]interface{})[0].(map[string]interface{})["tenant"] = "other"
+	if ok, _ := p.Match(nil, map[string]interface{}{"tenant": "other"}); ok {
+		t.Error("Restrict() returned the policy filter itself")
+	}
+
+	if _, err := p.Restrict(bson.M{"status": bson.M{"$foo": 1}}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Restrict() error = %v, want ErrInvalidQuery", err)
+	}
+	if _, err := p.Restrict(42); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Restrict(42) error = %v, want ErrInvalidQuery", err)
+	}
+
+	open, err := NewPolicy(nil, PolicyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := open.Restrict(nil); err != nil || len(got) != 0 {
+		t.Errorf("Restrict(nil) = %v, %v, want an empty filter", got, err)
+	}
+	if ok, err := open.Match(nil, map[string]interface{}{"a": 1}); err != nil || !ok {
+		t.Errorf("Match() = %v, %v, want true", ok, err)
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	if _, err := NewPolicy(bson.M{"a": bson.M{"$foo": 1}}, PolicyOptions{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("NewPolicy() error = %v, want ErrInvalidQuery", err)
+	}
+	if _, err := NewPolicy(nil, PolicyOptions{Projection: map[string]interface{}{"a": 1, "b": 0}}); err == nil {
+		t.Error("Expected an error for a projection mixing inclusion and exclusion")
+	}
+}
@@ -0,0 +1,168 @@
+package mangomatch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Project returns a copy of doc shaped by a MongoDB-style projection such as
+// {"name": 1, "address.city": 1} or {"password": 0}. Inclusion and exclusion
+// cannot be mixed, except that _id may always be excluded. The _id field is
+// included by default in inclusion projections.
+func Project(doc map[string]interface{}, projection map[string]interface{}) (map[string]interface{}, error) {
+	include, err := projectionMode(projection)
+	if err != nil {
+		return nil, err
+	}
+
+	if !include {
+		out, _ := copyValue(doc).(map[string]interface{})
+		for path := range projection {
+			excludePath(out, strings.Split(path, "."))
+		}
+		return out, nil
+	}
+
+	out := make(map[string]interface{})
+	if keepID, ok := projection["_id"]; !ok || projectionFlag(keepID) {
+		if id, exists := doc["_id"]; exists {
+			out["_id"] = copyValue(id)
+		}
+	}
+	for path, flag := range projection {
+		if path == "_id" || !projectionFlag(flag) {
+			continue
+		}
+		includePath(out, doc, strings.Split(path, "."))
+	}
+	return out, nil
+}
+
+// projectionMode reports whether projection is an inclusion projection
+func projectionMode(projection map[string]interface{}) (bool, error) {
+	include, exclude := false, false
+	for path, flag := range projection {
+		switch flag.(type) {
+		case bool, int, float64:
+		default:
+			return false, fmt.Errorf("mangomatch: projection value for %q must be a number or boolean", path)
+		}
+		if path == "_id" {
+			continue
+		}
+		if projectionFlag(flag) {
+			include = true
+		} else {
+			exclude = true
+		}
+	}
+	if include && exclude {
+		return false, fmt.Errorf("mangomatch: projection cannot mix inclusion and exclusion")
+	}
+	if !include && !exclude {
+		// Only _id was mentioned: {_id: 0} excludes it, {_id: 1} keeps only it
+		if flag, ok := projection["_id"]; ok {
+			return projectionFlag(flag), nil
+		}
+	}
+	return include, nil
+}
+
+func projectionFlag(flag interface{}) bool {
+	switch f := widenNumber(flag).(type) {
+	case bool:
+		return f
+	case int:
+		return f != 0
+	case float64:
+		return f != 0
+	}
+	return false
+}
+
+// includePath copies the value at parts from src into dst, descending into
+// embedded documents and arrays of documents
+func includePath(dst, src map[string]interface{}, parts []string) {
+	val, exists := src[parts[0]]
+	if !exists {
+		return
+	}
+	if len(parts) == 1 {
+		dst[parts[0]] = copyValue(val)
+		return
+	}
+
+	switch v := val.(type) {
+	case map[string]interface{}:
+		sub, ok := dst[parts[0]].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+		}
+		includePath(sub, v, parts[1:])
+		dst[parts[0]] = sub
+	case []interface{}:
+		// Keep one projected document per embedded document in the array
+		existing, _ := dst[parts[0]].([]interface{})
+		var out []interface{}
+		j := 0
+		for _, item := range v {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var sub map[string]interface{}
+			if j < len(existing) {
+				sub, _ = existing[j].(map[string]interface{})
+			}
+			if sub == nil {
+				sub = make(map[string]interface{})
+			}
+			includePath(sub, itemMap, parts[1:])
+			out = append(out, sub)
+			j++
+		}
+		if out == nil {
+			out = []interface{}{}
+		}
+		dst[parts[0]] = out
+	}
+}
+
+// excludePath removes the value at parts from doc in place
+func excludePath(doc map[string]interface{}, parts []string) {
+	if len(parts) == 1 {
+		delete(doc, parts[0])
+		return
+	}
+
+	switch v := doc[parts[0]].(type) {
+	case map[string]interface{}:
+		excludePath(v, parts[1:])
+	case []interface{}:
+		for _, item := range v {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				excludePath(itemMap, parts[1:])
+			}
+		}
+	}
+}
+
+// copyValue deep copies maps and slices so projections never alias the input
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			out[key] = copyValue(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,100 @@
+package mangomatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	doc := map[string]interface{}{
+		"_id":  1,
+		"name": "John",
+		"age":  30,
+		"address": map[string]interface{}{
+			"city": "New York",
+			"zip":  "10001",
+		},
+		"orders": []interface{}{
+			map[string]interface{}{"id": "A1", "total": 50},
+			map[string]interface{}{"id": "B2", "total": 150},
+			"legacy",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		projection map[string]interface{}
+		want       map[string]interface{}
+	}{
+		{
+			name:       "inclusion keeps _id",
+			projection: map[string]interface{}{"name": 1},
+			want:       map[string]interface{}{"_id": 1, "name": "John"},
+		},
+		{
+			name:       "inclusion without _id",
+			projection: map[string]interface{}{"name": true, "_id": 0},
+			want:       map[string]interface{}{"name": "John"},
+		},
+		{
+			name:       "nested inclusion",
+			projection: map[string]interface{}{"address.city": 1, "_id": false},
+			want:       map[string]interface{}{"address": map[string]interface{}{"city": "New York"}},
+		},
+		{
+			name:       "inclusion through array of documents",
+			projection: map[string]interface{}{"orders.id": 1, "orders.total": 1, "_id": 0},
+			want: map[string]interface{}{"orders": []interface{}{
+				map[string]interface{}{"id": "A1", "total": 50},
+				map[string]interface{}{"id": "B2", "total": 150},
+			}},
+		},
+		{
+			name:       "exclusion",
+			projection: map[string]interface{}{"age": 0, "address.zip": 0, "orders": 0},
+			want: map[string]interface{}{
+				"_id":     1,
+				"name":    "John",
+				"address": map[string]interface{}{"city": "New York"},
+			},
+		},
+		{
+			name:       "only _id excluded",
+			projection: map[string]interface{}{"_id": 0, "orders": 0, "address": 0},
+			want:       map[string]interface{}{"name": "John", "age": 30},
+		},
+		{
+			name:       "missing field",
+			projection: map[string]interface{}{"email": 1, "_id": 0},
+			want:       map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Project(doc, tt.projection)
+			if err != nil {
+				t.Fatalf("Project() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Project() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if doc["address"].(map[string]interface{})["zip"] != "10001" {
+		t.Error("Expected Project not to modify the input document")
+	}
+}
+
+func TestProjectInvalid(t *testing.T) {
+	doc := map[string]interface{}{"a": 1, "b": 2}
+	for _, projection := range []map[string]interface{}{
+		{"a": 1, "b": 0},
+		{"a": "yes"},
+	} {
+		if _, err := Project(doc, projection); err == nil {
+			t.Errorf("Expected Project(%v) to fail", projection)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Package q is a fluent builder for mangomatch queries.
+//
+//	query := q.Field("age").Gt(30).And(q.Field("tags").In("a", "b")).Or(q.Field("vip").Eq(true))
+//	mangomatch.Match(query.Map(), doc)
+//
+// Expressions are immutable: every method returns a new Expr.
+package q
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// cond is one operator applied to a field, in the order it was added
+type cond struct {
+	op    string
+	value interface{}
+}
+
+// Expr is a query expression: a condition on a field, a bare operator list
+// (see Ops), or a logical combination of other expressions
+type Expr struct {
+	logical  string
+	field    string
+	conds    []cond
+	children []Expr
+}
+
+// Field starts a condition on a dotted field path
+func Field(name string) Expr {
+	return Expr{field: name}
+}
+
+// Ops starts an operator list that is not bound to a field, for use with
+// Not and ElemMatch
+func Ops() Expr {
+	return Expr{}
+}
+
+// And combines expressions with $and
+func And(exprs ...Expr) Expr {
+	return combine("$and", exprs)
+}
+
+// Or combines expressions with $or
+func Or(exprs ...Expr) Expr {
+	return combine("$or", exprs)
+}
+
+// Nor combines expressions with $nor
+func Nor(exprs ...Expr) Expr {
+	return combine("$nor", exprs)
+}
+
+func combine(logical string, exprs []Expr) Expr {
+	var children []Expr
+	for _, e := range exprs {
+		// Flatten nested expressions of the same kind: a AND (b AND c)
+		if e.logical == logical && logical != "$nor" {
+			children = append(children, e.children...)
+		} else {
+			children = append(children, e)
+		}
+	}
+	return Expr{logical: logical, children: children}
+}
+
+// And returns e AND others
+func (e Expr) And(others ...Expr) Expr {
+	return And(append([]Expr{e}, others...)...)
+}
+
+// Or returns e OR others
+func (e Expr) Or(others ...Expr) Expr {
+	return Or(append([]Expr{e}, others...)...)
+}
+
+// Nor returns NOT (e OR others)
+func (e Expr) Nor(others ...Expr) Expr {
+	return Nor(append([]Expr{e}, others...)...)
+}
+
+// Op adds an arbitrary operator, such as one registered on a custom Engine
+func (e Expr) Op(name string, value interface{}) Expr {
+	conds := make([]cond, len(e.conds), len(e.conds)+1)
+	copy(conds, e.conds)
+	e.conds = append(conds, cond{op: name, value: value})
+	return e
+}
+
+func (e Expr) Eq(value interface{}) Expr  { return e.Op("$eq", value) }
+func (e Expr) Ne(value interface{}) Expr  { return e.Op("$ne", value) }
+func (e Expr) Gt(value interface{}) Expr  { return e.Op("$gt", value) }
+func (e Expr) Gte(value interface{}) Expr { return e.Op("$gte", value) }
+func (e Expr) Lt(value interface{}) Expr  { return e.Op("$lt", value) }
+func (e Expr) Lte(value interface{}) Expr { return e.Op("$lte", value) }
+
+func (e Expr) In(values ...interface{}) Expr  { return e.Op("$in", values) }
+func (e Expr) Nin(values ...interface{}) Expr { return e.Op("$nin", values) }
+func (e Expr) All(values ...interface{}) Expr { return e.Op("$all", values) }
+
+func (e Expr) Exists(exists bool) Expr   { return e.Op("$exists", exists) }
+func (e Expr) Regex(pattern string) Expr { return e.Op("$regex", pattern) }
+func (e Expr) Size(size int) Expr        { return e.Op("$size", size) }
+func (e Expr) Type(typeName string) Expr { return e.Op("$type", typeName) }
+func (e Expr) Mod(divisor, remainder int) Expr {
+	return e.Op("$mod", []interface{}{divisor, remainder})
+}
+
+// Not negates an operator list built with Ops
+func (e Expr) Not(ops Expr) Expr {
+	return e.Op("$not", ops)
+}
+
+// ElemMatch matches arrays with an element satisfying inner, which is either
+// an operator list built with Ops or a query over the element's fields
+func (e Expr) ElemMatch(inner Expr) Expr {
+	return e.Op("$elemMatch", inner)
+}
+
+// Map renders the expression in the form accepted by mangomatch.Match
+func (e Expr) Map() map[string]interface{} {
+	if e.logical == "$fields" {
+		fields := make(map[string]interface{}, len(e.children))
+		for _, child := range e.children {
+			fields[child.field] = child.Map()[child.field]
+		}
+		return fields
+	}
+	if e.logical != "" {
+		children := make([]interface{}, len(e.children))
+		for i, child := range e.children {
+			children[i] = child.Map()
+		}
+		return map[string]interface{}{e.logical: children}
+	}
+
+	ops := e.opsMap()
+	if e.field == "" {
+		return ops
+	}
+	// A lone equality is written the short way: {"field": value}
+	if len(e.conds) == 1 && e.conds[0].op == "$eq" {
+		return map[string]interface{}{e.field: ops["$eq"]}
+	}
+	return map[string]interface{}{e.field: ops}
+}
+
+func (e Expr) opsMap() map[string]interface{} {
+	ops := make(map[string]interface{}, len(e.conds))
+	for _, c := range e.conds {
+		if inner, ok := c.value.(Expr); ok {
+			ops[c.op] = inner.merged().Map()
+		} else {
+			ops[c.op] = c.value
+		}
+	}
+	return ops
+}
+
+// merged rewrites an And of conditions on distinct fields into a single
+// field-level document, which is the form $elemMatch expects
+func (e Expr) merged() Expr {
+	if e.logical != "$and" {
+		return e
+	}
+	seen := make(map[string]bool, len(e.children))
+	for _, child := range e.children {
+		if child.logical != "" || child.field == "" || seen[child.field] {
+			return e
+		}
+		seen[child.field] = true
+	}
+	return Expr{logical: "$fields", children: e.children}
+}
+
+// D renders the expression as an ordered bson.D for the MongoDB driver
+func (e Expr) D() bson.D {
+	if e.logical == "$fields" {
+		fields := make(bson.D, 0, len(e.children))
+		for _, child := range e.children {
+			fields = append(fields, child.D()...)
+		}
+		return fields
+	}
+	if e.logical != "" {
+		children := make(bson.A, len(e.children))
+		for i, child := range e.children {
+			children[i] = child.D()
+		}
+		return bson.D{{Key: e.logical, Value: children}}
+	}
+
+	ops := e.opsD()
+	if e.field == "" {
+		return ops
+	}
+	if len(e.conds) == 1 && e.conds[0].op == "$eq" {
+		return bson.D{{Key: e.field, Value: ops[0].Value}}
+	}
+	return bson.D{{Key: e.field, Value: ops}}
+}
+
+func (e Expr) opsD() bson.D {
+	ops := make(bson.D, 0, len(e.conds))
+	for _, c := range e.conds {
+		var value interface{}
+		switch v := c.value.(type) {
+		case Expr:
+			value = v.merged().D()
+		case []interface{}:
+			value = bson.A(v)
+		default:
+			value = v
+		}
+		ops = append(ops, bson.E{Key: c.op, Value: value})
+	}
+	return ops
+}
+
+// Compile validates the expression with the default engine
+func (e Expr) Compile() (*mangomatch.Query, error) {
+	return mangomatch.Compile(e.Map())
+}
+
+// Parse converts a query document (map, bson.M or bson.D) back into an
+// Expr after validating it with the default engine. Fields and operators are
+// visited in sorted order, so parsing is deterministic; a document with
+// several keys becomes an And.
+func Parse(query interface{}) (Expr, error) {
+	if _, err := mangomatch.Compile(query); err != nil {
+		return Expr{}, err
+	}
+	m, _ := mangomatch.ConvertBSON(query).(map[string]interface{})
+	return parseQuery(m)
+}
+
+func parseQuery(m map[string]interface{}) (Expr, error) {
+	keys := sortedKeys(m)
+
+	var exprs []Expr
+	for _, key := range keys {
+		value := m[key]
+		switch key {
+		case "$and", "$or", "$nor":
+			conditions, _ := value.([]interface{})
+			children := make([]Expr, 0, len(conditions))
+			for _, condition := range conditions {
+				condMap, _ := condition.(map[string]interface{})
+				child, err := parseQuery(condMap)
+				if err != nil {
+					return Expr{}, err
+				}
+				children = append(children, child)
+			}
+			exprs = append(exprs, Expr{logical: key, children: children})
+		default:
+			if strings.HasPrefix(key, "$") {
+				return Expr{}, fmt.Errorf("q: unsupported top-level operator %s", key)
+			}
+			expr, err := parseField(key, value)
+			if err != nil {
+				return Expr{}, err
+			}
+			exprs = append(exprs, expr)
+		}
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return Expr{logical: "$and", children: exprs}, nil
+}
+
+func parseField(field string, value interface{}) (Expr, error) {
+	ops, ok := value.(map[string]interface{})
+	if !ok || !isOperatorMap(ops) {
+		return Field(field).Eq(value), nil
+	}
+	return parseOps(Field(field), ops)
+}
+
+func parseOps(e Expr, ops map[string]interface{}) (Expr, error) {
+	for _, op := range sortedKeys(ops) {
+		value := ops[op]
+		switch op {
+		case "$not":
+			sub, _ := value.(map[string]interface{})
+			inner, err := parseOps(Ops(), sub)
+			if err != nil {
+				return Expr{}, err
+			}
+			e = e.Not(inner)
+		case "$elemMatch":
+			sub, _ := value.(map[string]interface{})
+			var inner Expr
+			var err error
+			if isOperatorMap(sub) && sub["$and"] == nil && sub["$or"] == nil && sub["$nor"] == nil {
+				inner, err = parseOps(Ops(), sub)
+			} else {
+				inner, err = parseQuery(sub)
+			}
+			if err != nil {
+				return Expr{}, err
+			}
+			e = e.ElemMatch(inner)
+		default:
+			e = e.Op(op, value)
+		}
+	}
+	return e, nil
+}
+
+func isOperatorMap(m map[string]interface{}) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
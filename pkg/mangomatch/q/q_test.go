@@ -0,0 +1,187 @@
+package q
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testDoc = map[string]interface{}{
+	"name":   "John Doe",
+	"age":    35,
+	"status": "active",
+	"tags":   []interface{}{"developer", "golang"},
+	"scores": []interface{}{85, 92, 78},
+	"address": map[string]interface{}{
+		"city": "New York",
+	},
+	"orders": []interface{}{
+		map[string]interface{}{"id": "A1", "total": 50},
+		map[string]interface{}{"id": "B2", "total": 150},
+	},
+}
+
+func TestBuilderMap(t *testing.T) {
+	tests := []struct {
+		name string
+		expr Expr
+		want map[string]interface{}
+	}{
+		{
+			name: "equality is written the short way",
+			expr: Field("name").Eq("John Doe"),
+			want: map[string]interface{}{"name": "John Doe"},
+		},
+		{
+			name: "several operators on one field",
+			expr: Field("age").Gte(30).Lt(40),
+			want: map[string]interface{}{"age": map[string]interface{}{"$gte": 30, "$lt": 40}},
+		},
+		{
+			name: "and flattens",
+			expr: Field("age").Gt(30).And(Field("tags").In("a", "b")).And(Field("status").Ne("x")),
+			want: map[string]interface{}{"$and": []interface{}{
+				map[string]interface{}{"age": map[string]interface{}{"$gt": 30}},
+				map[string]interface{}{"tags": map[string]interface{}{"$in": []interface{}{"a", "b"}}},
+				map[string]interface{}{"status": map[string]interface{}{"$ne": "x"}},
+			}},
+		},
+		{
+			name: "not with operator list",
+			expr: Field("name").Not(Ops().Regex("^J")),
+			want: map[string]interface{}{"name": map[string]interface{}{"$not": map[string]interface{}{"$regex": "^J"}}},
+		},
+		{
+			name: "elemMatch with field query",
+			expr: Field("orders").ElemMatch(Field("total").Gt(100)),
+			want: map[string]interface{}{"orders": map[string]interface{}{"$elemMatch": map[string]interface{}{
+				"total": map[string]interface{}{"$gt": 100},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.expr.Map(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Map() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilderMatchesEveryOperator(t *testing.T) {
+	tests := []struct {
+		name string
+		expr Expr
+		want bool
+	}{
+		{name: "$eq", expr: Field("status").Eq("active"), want: true},
+		{name: "$ne", expr: Field("status").Ne("active"), want: false},
+		{name: "$gt", expr: Field("age").Gt(30), want: true},
+		{name: "$gte", expr: Field("age").Gte(35), want: true},
+		{name: "$lt", expr: Field("age").Lt(30), want: false},
+		{name: "$lte", expr: Field("age").Lte(35), want: true},
+		{name: "$in", expr: Field("tags").In("golang", "rust"), want: true},
+		{name: "$nin", expr: Field("status").Nin("inactive", "banned"), want: true},
+		{name: "$all", expr: Field("tags").All("developer", "golang"), want: true},
+		{name: "$exists", expr: Field("email").Exists(false), want: true},
+		{name: "$regex", expr: Field("name").Regex("^John"), want: true},
+		{name: "$size", expr: Field("scores").Size(3), want: true},
+		{name: "$type", expr: Field("address").Type("object"), want: true},
+		{name: "$mod", expr: Field("age").Mod(5, 0), want: true},
+		{name: "$not", expr: Field("age").Not(Ops().Lt(18)), want: true},
+		{name: "$elemMatch operators", expr: Field("scores").ElemMatch(Ops().Gt(90).Lt(95)), want: true},
+		{name: "$elemMatch fields", expr: Field("orders").ElemMatch(Field("id").Eq("B2").And(Field("total").Gt(100))), want: true},
+		{name: "$elemMatch fields on one element", expr: Field("orders").ElemMatch(Field("id").Eq("A1").And(Field("total").Gt(100))), want: false},
+		{name: "$elemMatch with $or", expr: Field("orders").ElemMatch(Field("id").Eq("Z9").Or(Field("total").Gt(100))), want: true},
+		{name: "$or", expr: Field("age").Lt(18).Or(Field("address.city").Eq("New York")), want: true},
+		{name: "$nor", expr: Nor(Field("status").Eq("banned"), Field("age").Lt(18)), want: true},
+		{name: "nested logical", expr: And(Or(Field("age").Gt(40), Field("tags").Eq("golang")), Field("status").Eq("active")), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tt.expr.Compile()
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			if got := q.Match(testDoc); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+			if got := mangomatch.MatchBSON(tt.expr.D(), testDoc); got != tt.want {
+				t.Errorf("MatchBSON(D()) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilderD(t *testing.T) {
+	got := Field("age").Gt(30).Or(Field("tags").In("a")).D()
+	want := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 30}}}},
+		bson.D{{Key: "tags", Value: bson.D{{Key: "$in", Value: bson.A{"a"}}}}},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("D() = %#v, want %#v", got, want)
+	}
+}
+
+func TestBuilderImmutable(t *testing.T) {
+	base := Field("age").Gt(30)
+	a := base.Lt(40)
+	b := base.Lt(50)
+	if a.Map()["age"].(map[string]interface{})["$lt"] != 40 {
+		t.Error("Expected deriving b not to modify a")
+	}
+	if len(base.conds) != 1 || len(b.conds) != 2 {
+		t.Error("Expected base to be unchanged")
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	queries := []map[string]interface{}{
+		{"name": "John Doe"},
+		{"age": map[string]interface{}{"$gte": 30, "$lt": 40}, "status": "active"},
+		{"$or": []interface{}{
+			map[string]interface{}{"age": map[string]interface{}{"$lt": 18}},
+			map[string]interface{}{"tags": map[string]interface{}{"$all": []interface{}{"golang"}}},
+		}},
+		{"name": map[string]interface{}{"$not": map[string]interface{}{"$regex": "^X"}}},
+		{"orders": map[string]interface{}{"$elemMatch": map[string]interface{}{"total": map[string]interface{}{"$gt": 100}}}},
+		{"scores": map[string]interface{}{"$elemMatch": map[string]interface{}{"$gt": 90}}},
+		{"orders": map[string]interface{}{"$elemMatch": map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"id": "Z9"},
+			map[string]interface{}{"total": map[string]interface{}{"$gt": 100}},
+		}}}},
+		{"address": map[string]interface{}{"city": "New York"}},
+	}
+
+	for _, query := range queries {
+		expr, err := Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%v) error = %v", query, err)
+		}
+		if got, want := mangomatch.Match(expr.Map(), testDoc), mangomatch.Match(query, testDoc); got != want {
+			t.Errorf("Parse(%v).Map() matched %v, original matched %v", query, got, want)
+		}
+
+		again, err := Parse(expr.Map())
+		if err != nil {
+			t.Fatalf("Parse(Map()) error = %v", err)
+		}
+		if !reflect.DeepEqual(again.Map(), expr.Map()) {
+			t.Errorf("Parse(Map()) is not stable: %v vs %v", again.Map(), expr.Map())
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse(map[string]interface{}{"age": map[string]interface{}{"$bogus": 1}}); err == nil {
+		t.Error("Expected Parse to reject unknown operators")
+	}
+	if _, err := Parse("not a query"); err == nil {
+		t.Error("Expected Parse to reject non-documents")
+	}
+}
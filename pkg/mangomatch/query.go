@@ -0,0 +1,142 @@
+package mangomatch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidQuery is returned (wrapped) by Compile when a query is malformed
+var ErrInvalidQuery = errors.New("mangomatch: invalid query")
+
+// Accessor turns an item into the document a Query is evaluated against.
+// It reports false when the item cannot be represented as a document.
+type Accessor func(item interface{}) (Document, bool)
+
+// Query is a validated query that can be evaluated against many documents
+type Query struct {
+	filter   map[string]interface{}
+	engine   *Engine
+	accessor Accessor
+	match    matcher
+	limits   Limits
+}
+
+// Compile validates query once so it can be reused. The query may be a
+// map[string]interface{}, bson.M, bson.D or an already compiled *Query.
+func Compile(query interface{}) (*Query, error) {
+	return defaultEngine.Compile(query)
+}
+
+// Compile validates query against the operators registered on e. A query
+// exceeding the compile-time limits of e is rejected with a *LimitError.
+func (e *Engine) Compile(query interface{}) (*Query, error) {
+	if q, ok := query.(*Query); ok {
+		return q, nil
+	}
+
+	filter, ok := ConvertBSON(query).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: expected a document, got %T", ErrInvalidQuery, query)
+	}
+	if err := e.validateQuery(filter); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	limits := e.Limits()
+	if err := checkLimits(filter, limits, 1); err != nil {
+		return nil, err
+	}
+	return &Query{filter: filter, engine: e, accessor: DefaultAccessor, match: e.compileMatcher(filter), limits: limits}, nil
+}
+
+// MustCompile is like Compile but panics if the query is invalid
+func MustCompile(query interface{}) *Query {
+	q, err := Compile(query)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// WithAccessor returns a copy of q that reads documents through accessor
+func (q *Query) WithAccessor(accessor Accessor) *Query {
+	clone := *q
+	clone.accessor = accessor
+	return &clone
+}
+
+// Filter returns the underlying query document
+func (q *Query) Filter() map[string]interface{} {
+	return q.filter
+}
+
+// Match reports whether item matches the query. Items the accessor cannot
+// read never match.
+func (q *Query) Match(item interface{}) bool {
+	doc, ok := q.accessor(item)
+	if !ok {
+		return false
+	}
+	return q.match(doc, nil)
+}
+
+// DefaultAccessor reads items through the built-in adapters of AsDocument
+func DefaultAccessor(item interface{}) (Document, bool) {
+	return AsDocument(item)
+}
+
+// validateQuery checks operator names and operand shapes of a query document
+func (e *Engine) validateQuery(query map[string]interface{}) error {
+	for key, value := range query {
+		if strings.HasPrefix(key, "$") {
+			switch key {
+			case "$and", "$or", "$nor":
+				conditions, ok := value.([]interface{})
+				if !ok || len(conditions) == 0 {
+					return fmt.Errorf("%s requires a non-empty array", key)
+				}
+				for _, condition := range conditions {
+					condMap, ok := condition.(map[string]interface{})
+					if !ok {
+						return fmt.Errorf("%s elements must be documents", key)
+					}
+					if err := e.validateQuery(condMap); err != nil {
+						return err
+					}
+				}
+			default:
+				return fmt.Errorf("unknown top-level operator %s", key)
+			}
+			continue
+		}
+
+		if ops, ok := value.(map[string]interface{}); ok && isOperatorMap(ops) {
+			if _, err := e.compileOperators(ops); err != nil {
+				return fmt.Errorf("field %q: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isOperatorMap reports whether every key of m is an operator
+func isOperatorMap(m map[string]interface{}) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+// isElemMatchOperators reports whether the $elemMatch operand criteria
+// applies operators to the array elements, as {"$gt": 1} does, rather than
+// being a query on their fields
+func isElemMatchOperators(criteria map[string]interface{}) bool {
+	for _, op := range []string{"$and", "$or", "$nor"} {
+		if _, ok := criteria[op]; ok {
+			return false
+		}
+	}
+	return isOperatorMap(criteria)
+}
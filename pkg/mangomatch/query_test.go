@@ -0,0 +1,97 @@
+package mangomatch
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCompileValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   interface{}
+		wantErr bool
+	}{
+		{name: "Simple equality", query: map[string]interface{}{"age": 30}},
+		{name: "Operators", query: map[string]interface{}{"age": map[string]interface{}{"$gt": 30, "$lt": 40}}},
+		{name: "bson.M", query: bson.M{"tags": bson.M{"$in": bson.A{"a", "b"}}}},
+		{name: "bson.D", query: bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "a", Value: 1}}, bson.M{"b": 2}}}}},
+		{name: "Embedded document equality", query: map[string]interface{}{"address": map[string]interface{}{"city": "NY"}}},
+		{name: "Not a document", query: []interface{}{1, 2}, wantErr: true},
+		{name: "Unknown operator", query: map[string]interface{}{"age": map[string]interface{}{"$foo": 1}}, wantErr: true},
+		{name: "Unknown top-level operator", query: map[string]interface{}{"$where": "true"}, wantErr: true},
+		{name: "$and not an array", query: map[string]interface{}{"$and": map[string]interface{}{"a": 1}}, wantErr: true},
+		{name: "$or element not a document", query: map[string]interface{}{"$or": []interface{}{1}}, wantErr: true},
+		{name: "$in not an array", query: map[string]interface{}{"a": map[string]interface{}{"$in": "x"}}, wantErr: true},
+		{name: "$exists not a boolean", query: map[string]interface{}{"a": map[string]interface{}{"$exists": 1}}, wantErr: true},
+		{name: "Invalid regex", query: map[string]interface{}{"a": map[string]interface{}{"$regex": "("}}, wantErr: true},
+		{name: "$mod with one element", query: map[string]interface{}{"a": map[string]interface{}{"$mod": []interface{}{2}}}, wantErr: true},
+		{name: "Nested invalid operator", query: map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"a": map[string]interface{}{"$not": map[string]interface{}{"$bogus": 1}}},
+		}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("Expected error to wrap ErrInvalidQuery, got %v", err)
+			}
+		})
+	}
+}
+
+func TestQueryMatchDocumentKinds(t *testing.T) {
+	q := MustCompile(bson.M{"name": "John", "age": bson.M{"$gte": 30}})
+
+	raw, err := bson.Marshal(bson.M{"name": "John", "age": 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		doc  interface{}
+		want bool
+	}{
+		{name: "map", doc: map[string]interface{}{"name": "John", "age": 30}, want: true},
+		{name: "bson.M", doc: bson.M{"name": "John", "age": 31}, want: true},
+		{name: "bson.D", doc: bson.D{{Key: "name", Value: "John"}, {Key: "age", Value: 29}}, want: false},
+		{name: "bson.Raw", doc: bson.Raw(raw), want: true},
+		{name: "struct", doc: testUser{Name: "John", Age: 30}, want: true},
+		{name: "unsupported", doc: "John", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := q.Match(tt.doc); got != tt.want {
+				t.Errorf("Query.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryWithAccessor(t *testing.T) {
+	type event struct {
+		kind string
+	}
+
+	q := MustCompile(map[string]interface{}{"kind": "click"}).WithAccessor(func(item interface{}) (Document, bool) {
+		e, ok := item.(event)
+		if !ok {
+			return nil, false
+		}
+		return MapDocument{"kind": e.kind}, true
+	})
+
+	if !q.Match(event{kind: "click"}) {
+		t.Error("Expected custom accessor to expose unexported field")
+	}
+	if q.Match(map[string]interface{}{"kind": "click"}) {
+		t.Error("Expected custom accessor to reject other types")
+	}
+}
@@ -0,0 +1,140 @@
+package mangomatch
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// MatchRaw evaluates query directly against encoded BSON. Only the elements
+// at the paths referenced by the query are decoded, so documents that don't
+// match are rejected without building a map of the whole document.
+func MatchRaw(query map[string]interface{}, raw bson.Raw) bool {
+	if err := validateRaw(raw); err != nil {
+		return false
+	}
+	return MatchDocument(query, rawDocument(raw))
+}
+
+// validateRaw is raw.Validate, which panics on a length prefix below the
+// 5 bytes of an empty document
+func validateRaw(raw bson.Raw) error {
+	if len(raw) < 5 || int32(binary.LittleEndian.Uint32(raw)) < 5 {
+		return errors.New("mangomatch: BSON document is shorter than 5 bytes")
+	}
+	return raw.Validate()
+}
+
+// rawDocument reads a bson.Raw in place. Embedded documents and arrays are
+// walked without decoding; only the values found at the end of a path are.
+type rawDocument bson.Raw
+
+func (d rawDocument) Lookup(path []string) ([]interface{}, bool) {
+	current := bson.RawValue{Type: bsontype.EmbeddedDocument, Value: d}
+	found := lookupRawPath(current, path, nil)
+	if len(found) == 0 {
+		return nil, false
+	}
+	values := make([]interface{}, len(found))
+	for i, val := range found {
+		values[i] = decodeRawValue(val)
+	}
+	return values, true
+}
+
+func (d rawDocument) Range(fn func(key string, value interface{}) bool) {
+	elements, err := bson.Raw(d).Elements()
+	if err != nil {
+		return
+	}
+	for _, elem := range elements {
+		if !fn(elem.Key(), decodeRawValue(elem.Value())) {
+			return
+		}
+	}
+}
+
+// lookupRawPath follows the same path rules as lookupPath over encoded
+// values
+func lookupRawPath(current bson.RawValue, parts []string, out []bson.RawValue) []bson.RawValue {
+	if len(parts) == 0 {
+		return append(out, current)
+	}
+
+	if doc, ok := current.DocumentOK(); ok {
+		if val, err := doc.LookupErr(parts[0]); err == nil {
+			out = lookupRawPath(val, parts[1:], out)
+		}
+		return out
+	}
+
+	arr, ok := current.ArrayOK()
+	if !ok {
+		return out
+	}
+	if idx, ok := arrayIndex(parts[0]); ok {
+		if elem, err := arr.IndexErr(uint(idx)); err == nil {
+			out = lookupRawPath(elem.Value(), parts[1:], out)
+		}
+	}
+	values, err := arr.Values()
+	if err != nil {
+		return out
+	}
+	for _, item := range values {
+		if item.Type == bsontype.EmbeddedDocument {
+			out = lookupRawPath(item, parts, out)
+		}
+	}
+	return out
+}
+
+// decodeRawValue converts an encoded value into the types the matcher
+// compares. Int32 becomes int and Int64 stays int64, so that $type can tell
+// them apart; datetimes become time.Time.
+func decodeRawValue(rv bson.RawValue) interface{} {
+	switch rv.Type {
+	case bsontype.String:
+		return rv.StringValue()
+	case bsontype.Int32:
+		return int(rv.Int32())
+	case bsontype.Int64:
+		return rv.Int64()
+	case bsontype.Double:
+		return rv.Double()
+	case bsontype.Boolean:
+		return rv.Boolean()
+	case bsontype.Null, bsontype.Undefined:
+		return nil
+	case bsontype.DateTime:
+		return rv.Time().UTC()
+	case bsontype.EmbeddedDocument:
+		elements, err := rv.Document().Elements()
+		if err != nil {
+			return nil
+		}
+		out := make(map[string]interface{}, len(elements))
+		for _, elem := range elements {
+			out[elem.Key()] = decodeRawValue(elem.Value())
+		}
+		return out
+	case bsontype.Array:
+		values, err := rv.Array().Values()
+		if err != nil {
+			return nil
+		}
+		out := make([]interface{}, len(values))
+		for i, item := range values {
+			out[i] = decodeRawValue(item)
+		}
+		return out
+	default:
+		var out interface{}
+		if err := rv.Unmarshal(&out); err != nil {
+			return nil
+		}
+		return out
+	}
+}
@@ -0,0 +1,131 @@
+package mangomatch
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func rawTestDocument(t testing.TB) bson.Raw {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "name", Value: "John Doe"},
+		{Key: "age", Value: int32(35)},
+		{Key: "balance", Value: int64(1200)},
+		{Key: "rating", Value: 4.5},
+		{Key: "active", Value: true},
+		{Key: "deleted", Value: nil},
+		{Key: "created", Value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{Key: "tags", Value: bson.A{"premium", "verified"}},
+		{Key: "address", Value: bson.D{
+			{Key: "city", Value: "New York"},
+			{Key: "location", Value: bson.D{{Key: "coordinates", Value: bson.A{40.7128, -74.0060}}}},
+		}},
+		{Key: "orders", Value: bson.A{
+			bson.D{{Key: "id", Value: "A1"}, {Key: "total", Value: int32(50)}},
+			bson.D{{Key: "id", Value: "B2"}, {Key: "total", Value: int32(150)}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestMatchRaw(t *testing.T) {
+	raw := rawTestDocument(t)
+
+	tests := []struct {
+		name  string
+		query map[string]interface{}
+		want  bool
+	}{
+		{name: "string equality", query: map[string]interface{}{"name": "John Doe"}, want: true},
+		{name: "int32 equality", query: map[string]interface{}{"age": 35}, want: true},
+		{name: "int64 range", query: map[string]interface{}{"balance": map[string]interface{}{"$gte": 1000}}, want: true},
+		{name: "double range", query: map[string]interface{}{"rating": map[string]interface{}{"$gt": 4}}, want: true},
+		{name: "boolean", query: map[string]interface{}{"active": true}, want: true},
+		{name: "null type", query: map[string]interface{}{"deleted": map[string]interface{}{"$type": "null"}}, want: true},
+		{name: "datetime range", query: map[string]interface{}{"created": map[string]interface{}{"$lt": time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}}, want: true},
+		{name: "array contains", query: map[string]interface{}{"tags": "verified"}, want: true},
+		{name: "array size", query: map[string]interface{}{"tags": map[string]interface{}{"$size": 2}}, want: true},
+		{name: "nested document", query: map[string]interface{}{"address.city": "New York"}, want: true},
+		{name: "nested array index", query: map[string]interface{}{"address.location.coordinates.0": map[string]interface{}{"$gt": 40}}, want: true},
+		{name: "array of documents", query: map[string]interface{}{"orders.id": "A1"}, want: true},
+		{name: "array of documents by index", query: map[string]interface{}{"orders.1.total": 150}, want: true},
+		{name: "$elemMatch on embedded documents", query: map[string]interface{}{"orders": map[string]interface{}{"$elemMatch": map[string]interface{}{"total": map[string]interface{}{"$gt": 100}}}}, want: true},
+		{name: "$exists false", query: map[string]interface{}{"email": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "logical operators", query: map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"age": map[string]interface{}{"$lt": 18}},
+			map[string]interface{}{"address.city": "New York"},
+		}}, want: true},
+		{name: "no match", query: map[string]interface{}{"name": "Jane"}, want: false},
+		{name: "missing nested path", query: map[string]interface{}{"address.zip": "10001"}, want: false},
+		{name: "path through scalar", query: map[string]interface{}{"name.first": "John"}, want: false},
+		{name: "index out of range", query: map[string]interface{}{"tags.5": "x"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchRaw(tt.query, raw); got != tt.want {
+				t.Errorf("MatchRaw() = %v, want %v", got, tt.want)
+			}
+			if got := MatchBSON(tt.query, raw); got != tt.want {
+				t.Errorf("MatchBSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRawInvalid(t *testing.T) {
+	query := map[string]interface{}{"a": map[string]interface{}{"$exists": false}}
+	for _, raw := range []bson.Raw{
+		{0x05, 0x00},
+		{0x00, 0x00, 0x00, 0x00},
+		{0x04, 0x00, 0x00, 0x00, 0x00},
+		{0xff, 0xff, 0xff, 0xff, 0x00},
+	} {
+		if MatchRaw(query, raw) || MatchBSON(query, raw) {
+			t.Errorf("Expected malformed BSON %x not to match", []byte(raw))
+		}
+	}
+}
+
+func TestMatchRawAllocations(t *testing.T) {
+	raw := rawTestDocument(t)
+	query := map[string]interface{}{"name": "Jane Doe"}
+
+	rawAllocs := testing.AllocsPerRun(100, func() {
+		MatchRaw(query, raw)
+	})
+	decodedAllocs := testing.AllocsPerRun(100, func() {
+		var m bson.M
+		_ = bson.Unmarshal(raw, &m)
+		MatchBSON(query, m)
+	})
+	if rawAllocs >= decodedAllocs {
+		t.Errorf("Expected MatchRaw to allocate less than decoding, got %v vs %v", rawAllocs, decodedAllocs)
+	}
+}
+
+func BenchmarkMatchRaw(b *testing.B) {
+	raw := rawTestDocument(b)
+	query := map[string]interface{}{"address.city": "Boston"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		MatchRaw(query, raw)
+	}
+}
+
+func BenchmarkMatchDecodedRaw(b *testing.B) {
+	raw := rawTestDocument(b)
+	query := map[string]interface{}{"address.city": "Boston"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var m bson.M
+		_ = bson.Unmarshal(raw, &m)
+		MatchBSON(query, m)
+	}
+}
@@ -0,0 +1,727 @@
+package mangomatch
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Satisfiability is what static analysis can tell about the documents a
+// query matches
+type Satisfiability int
+
+const (
+	// Sometimes means the query may match some documents and not others
+	Sometimes Satisfiability = iota
+	// Never means no document matches the query
+	Never
+	// Always means every document matches the query
+	Always
+)
+
+func (s Satisfiability) String() string {
+	switch s {
+	case Never:
+		return "never"
+	case Always:
+		return "always"
+	default:
+		return "sometimes"
+	}
+}
+
+// SimplifyOptions tells Simplify what is known about the documents
+type SimplifyOptions struct {
+	// Scalar reports whether the dotted path always resolves to a single
+	// value that is not an array. Conditions on such a field constrain one
+	// value, so {"$gt": 50, "$lt": 10} is a contradiction; on an array
+	// each condition may be met by a different element. Nil means no field
+	// is known to be scalar.
+	Scalar func(path string) bool
+}
+
+// Simplify analyzes query statically. It detects queries that can never or
+// will always match, and folds redundant conditions, such as a weaker
+// bound on a field that already has a tighter one. The simplified query
+// matches the same documents as query; it is nil when the result is Never
+// or Always, since no document needs to be evaluated.
+//
+// Fields may hold arrays, so only conclusions that hold for every element
+// are drawn; use SimplifyWith to declare scalar fields.
+func Simplify(query interface{}) (bson.D, Satisfiability, error) {
+	return SimplifyWith(query, SimplifyOptions{})
+}
+
+// SimplifyWith is like Simplify, using what opts tells about the documents
+func SimplifyWith(query interface{}, opts SimplifyOptions) (bson.D, Satisfiability, error) {
+	normalized, err := Normalize(query)
+	if err != nil {
+		return nil, Sometimes, err
+	}
+
+	s := &simplifier{opts: opts}
+	simplified, sat := s.query(normalized)
+	if sat != Sometimes {
+		return nil, sat, nil
+	}
+	simplified, err = Normalize(simplified)
+	return simplified, Sometimes, err
+}
+
+type simplifier struct {
+	opts SimplifyOptions
+}
+
+// query simplifies a normalized query document
+func (s *simplifier) query(doc bson.D) (bson.D, Satisfiability) {
+	if len(doc) == 0 {
+		// An empty query matches nothing
+		return nil, Never
+	}
+
+	fields := make(map[string][]interface{})
+	var paths []string
+	addField := func(path string, value interface{}) {
+		if _, ok := fields[path]; !ok {
+			paths = append(paths, path)
+		}
+		fields[path] = append(fields[path], value)
+	}
+
+	out := bson.D{}
+	var and bson.A
+	for _, e := range doc {
+		switch e.Key {
+		case "$and":
+			for _, clause := range e.Value.(bson.A) {
+				c := clause.(bson.D)
+				if len(c) == 1 && !strings.HasPrefix(c[0].Key, "$") {
+					addField(c[0].Key, c[0].Value)
+					continue
+				}
+				sub, sat := s.query(c)
+				switch sat {
+				case Never:
+					return nil, Never
+				case Sometimes:
+					and = append(and, sub)
+				}
+			}
+		case "$or":
+			clauses, sat := s.or(e.Value.(bson.A))
+			switch sat {
+			case Never:
+				return nil, Never
+			case Sometimes:
+				out = append(out, bson.E{Key: "$or", Value: clauses})
+			}
+		case "$nor":
+			clauses, sat := s.nor(e.Value.(bson.A))
+			switch sat {
+			case Never:
+				return nil, Never
+			case Sometimes:
+				out = append(out, bson.E{Key: "$nor", Value: clauses})
+			}
+		default:
+			addField(e.Key, e.Value)
+		}
+	}
+
+	for _, path := range paths {
+		conds, sat := s.field(path, fields[path])
+		if sat == Never {
+			return nil, Never
+		}
+		for i, cond := range conds {
+			if i == 0 {
+				out = append(out, bson.E{Key: path, Value: cond})
+			} else {
+				and = append(and, bson.D{{Key: path, Value: cond}})
+			}
+		}
+	}
+	if len(and) > 0 {
+		out = append(out, bson.E{Key: "$and", Value: and})
+	}
+	if len(out) == 0 {
+		return nil, Always
+	}
+	return out, Sometimes
+}
+
+func (s *simplifier) or(clauses bson.A) (bson.A, Satisfiability) {
+	var kept bson.A
+	exists := make(map[string][2]bool)
+	for _, clause := range clauses {
+		sub, sat := s.query(clause.(bson.D))
+		switch sat {
+		case Always:
+			return nil, Always
+		case Sometimes:
+			kept = append(kept, sub)
+			if path, want, ok := existsOnly(sub); ok {
+				seen := exists[path]
+				if want {
+					seen[0] = true
+				} else {
+					seen[1] = true
+				}
+				if seen[0] && seen[1] {
+					// Every document either has the field or not
+					return nil, Always
+				}
+				exists[path] = seen
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return nil, Never
+	}
+	return kept, Sometimes
+}
+
+func (s *simplifier) nor(clauses bson.A) (bson.A, Satisfiability) {
+	kept, sat := s.or(clauses)
+	switch sat {
+	case Always:
+		return nil, Never
+	case Never:
+		return nil, Always
+	}
+	return kept, Sometimes
+}
+
+// existsOnly reports whether doc is just {"f": {"$exists": want}}
+func existsOnly(doc bson.D) (string, bool, bool) {
+	if len(doc) != 1 || strings.HasPrefix(doc[0].Key, "$") {
+		return "", false, false
+	}
+	ops, ok := doc[0].Value.(bson.D)
+	if !ok || len(ops) != 1 || ops[0].Key != "$exists" {
+		return "", false, false
+	}
+	want, ok := ops[0].Value.(bool)
+	return doc[0].Key, want, ok
+}
+
+// atom is one operator of a field condition
+type atom struct {
+	op      string
+	operand interface{}
+}
+
+// field simplifies the conditions on one path, returning the conditions
+// that remain. They are simplified for a present field, then adjusted so
+// that a missing field, which they test like null, matches exactly when it
+// did before.
+func (s *simplifier) field(path string, values []interface{}) ([]interface{}, Satisfiability) {
+	var conds [][]atom
+	var all []atom
+	present := true
+	for _, value := range values {
+		atoms := conditionAtoms(value)
+		for _, a := range atoms {
+			// On a present field $exists: false fails whatever else is
+			// asked
+			if neverTrue(a) || a.op == "$exists" && a.operand == false {
+				present = false
+			}
+		}
+		conds = append(conds, atoms)
+		all = append(all, atoms...)
+	}
+	missing := holdsOnMissing(all)
+	onlyMissing := func() ([]interface{}, Satisfiability) {
+		if missing {
+			return []interface{}{bson.D{{Key: "$exists", Value: false}}}, Sometimes
+		}
+		return nil, Never
+	}
+	if !present {
+		return onlyMissing()
+	}
+	unmerged := func() ([]interface{}, Satisfiability) {
+		out := make([]interface{}, len(conds))
+		for i, atoms := range conds {
+			out[i] = conditionValue(dedupeAtoms(atoms))
+		}
+		return out, Sometimes
+	}
+
+	scalar := s.opts.Scalar != nil && s.opts.Scalar(path)
+	if !scalar && strings.Contains(path, ".") {
+		// A dotted path may resolve to several values, each of which
+		// needs only satisfy one condition, so conditions cannot be merged
+		return unmerged()
+	}
+
+	// The path resolves to a single value that every atom applies to
+	atoms, sat := simplifyAtoms(dedupeAtoms(all), scalar)
+	if sat == Never {
+		return onlyMissing()
+	}
+	switch {
+	case holdsOnMissing(atoms) == missing:
+	case !missing:
+		atoms = append(atoms, atom{op: "$exists", operand: true})
+	case len(atoms) == 1 && atoms[0].op == "$exists":
+		// Every value, and a missing field, matches
+		return nil, Sometimes
+	default:
+		return unmerged()
+	}
+	return splitAtoms(atoms), Sometimes
+}
+
+// splitAtoms turns atoms into as few field conditions as possible; an
+// operator can only appear once in each
+func splitAtoms(atoms []atom) []interface{} {
+	var groups [][]atom
+	for _, a := range atoms {
+		placed := false
+		for i, g := range groups {
+			if !hasOp(g, a.op) {
+				groups[i] = append(g, a)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			groups = append(groups, []atom{a})
+		}
+	}
+	out := make([]interface{}, len(groups))
+	for i, g := range groups {
+		out[i] = conditionValue(g)
+	}
+	return out
+}
+
+func hasOp(atoms []atom, op string) bool {
+	for _, a := range atoms {
+		if a.op == op {
+			return true
+		}
+	}
+	return false
+}
+
+func conditionAtoms(value interface{}) []atom {
+	ops, ok := value.(bson.D)
+	if !ok || len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+		return []atom{{op: "$eq", operand: value}}
+	}
+	atoms := make([]atom, len(ops))
+	for i, e := range ops {
+		atoms[i] = atom{op: e.Key, operand: e.Value}
+	}
+	return atoms
+}
+
+// conditionValue turns atoms back into the value of a field condition
+func conditionValue(atoms []atom) interface{} {
+	if len(atoms) == 1 && atoms[0].op == "$eq" {
+		if _, isDoc := atoms[0].operand.(bson.D); !isDoc {
+			return atoms[0].operand
+		}
+	}
+	out := make(bson.D, len(atoms))
+	for i, a := range atoms {
+		out[i] = bson.E{Key: a.op, Value: a.operand}
+	}
+	return out
+}
+
+func hasAtom(atoms []atom, op string, operand interface{}) bool {
+	for _, a := range atoms {
+		if a.op == op && a.operand == operand {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupeAtoms(atoms []atom) []atom {
+	var out []atom
+	seen := make(map[string]bool)
+	for _, a := range atoms {
+		key := a.op + string(canonicalValue(a.operand))
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// neverTrue reports whether a matches no present value
+func neverTrue(a atom) bool {
+	switch a.op {
+	case "$eq":
+		return !equatable(a.operand)
+	case "$in":
+		for _, v := range a.operand.(bson.A) {
+			if equatable(v) {
+				return false
+			}
+		}
+		return true
+	case "$gt", "$lt":
+		return valueFamily(a.operand) == "" || a.operand == nil
+	case "$gte", "$lte":
+		return valueFamily(a.operand) == ""
+	}
+	return false
+}
+
+// equatable reports whether compareEqual can ever report v equal to a value
+func equatable(v interface{}) bool {
+	switch v.(type) {
+	case nil, int, float64, string, bool, time.Time:
+		return true
+	}
+	return false
+}
+
+// valueFamily is the set of values range operators compare operand with
+func valueFamily(v interface{}) string {
+	switch v.(type) {
+	case int, float64:
+		return "number"
+	case string:
+		return "string"
+	case time.Time:
+		return "time"
+	case nil:
+		return "null"
+	}
+	return ""
+}
+
+// compareFamily compares two values of the same family
+func compareFamily(a, b interface{}) int {
+	switch {
+	case compareEqual(a, b):
+		return 0
+	case compareSimpleLessThan(b, a):
+		return -1
+	default:
+		return 1
+	}
+}
+
+// bound is a range operator on one value family
+type bound struct {
+	value     interface{}
+	inclusive bool
+}
+
+// simplifyAtoms simplifies the atoms applying to a single value, which may
+// be an array unless scalar is set
+func simplifyAtoms(atoms []atom, scalar bool) ([]atom, Satisfiability) {
+	// Values that the field, or none of its elements, may equal
+	excluded := func(v interface{}) bool {
+		for _, a := range atoms {
+			switch a.op {
+			case "$ne":
+				if compareEqual(a.operand, v) {
+					return true
+				}
+			case "$nin":
+				for _, n := range a.operand.(bson.A) {
+					if compareEqual(n, v) {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+
+	var rest []atom
+	var eqs []interface{}
+	var ins []bson.A
+	lower := make(map[string]bound)
+	upper := make(map[string]bound)
+	for _, a := range atoms {
+		switch a.op {
+		case "$eq":
+			if excluded(a.operand) {
+				return nil, Never
+			}
+			eqs = append(eqs, a.operand)
+		case "$in":
+			var kept bson.A
+			for _, v := range a.operand.(bson.A) {
+				if equatable(v) && !excluded(v) {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == 0 {
+				return nil, Never
+			}
+			ins = append(ins, kept)
+		case "$gt", "$gte":
+			family := valueFamily(a.operand)
+			b := bound{value: a.operand, inclusive: a.op == "$gte"}
+			if cur, ok := lower[family]; !ok || tighterLower(b, cur) {
+				lower[family] = b
+			}
+		case "$lt", "$lte":
+			family := valueFamily(a.operand)
+			b := bound{value: a.operand, inclusive: a.op == "$lte"}
+			if cur, ok := upper[family]; !ok || tighterUpper(b, cur) {
+				upper[family] = b
+			}
+		case "$ne":
+			if equatable(a.operand) {
+				rest = append(rest, a)
+			}
+		case "$nin":
+			var kept bson.A
+			for _, v := range a.operand.(bson.A) {
+				if equatable(v) {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) > 0 {
+				rest = append(rest, atom{op: a.op, operand: kept})
+			}
+		case "$exists":
+			// Only $exists: true gets here, and the field is present
+		default:
+			rest = append(rest, a)
+		}
+	}
+
+	if scalar {
+		return simplifyScalar(eqs, ins, lower, upper, rest)
+	}
+
+	var out []atom
+	for _, v := range eqs {
+		out = append(out, atom{op: "$eq", operand: v})
+	}
+	for _, in := range ins {
+		out = append(out, inAtom(in))
+	}
+	out = append(out, boundAtoms(lower, upper)...)
+	out = append(out, rest...)
+	if len(out) == 0 {
+		out = []atom{{op: "$exists", operand: true}}
+	}
+	return out, Sometimes
+}
+
+// simplifyScalar intersects the constraints on a value that is known not to
+// be an array
+func simplifyScalar(eqs []interface{}, ins []bson.A, lower, upper map[string]bound, rest []atom) ([]atom, Satisfiability) {
+	// Range operators only match values of their operand's family
+	var family string
+	for _, m := range []map[string]bound{lower, upper} {
+		for f := range m {
+			if family != "" && f != family {
+				return nil, Never
+			}
+			family = f
+		}
+	}
+	lo, hasLo := lower[family]
+	hi, hasHi := upper[family]
+	if hasLo && hasHi {
+		switch c := compareFamily(lo.value, hi.value); {
+		case c > 0, c == 0 && !(lo.inclusive && hi.inclusive):
+			return nil, Never
+		case c == 0:
+			eqs = append(eqs, lo.value)
+		}
+	}
+	inRange := func(v interface{}) bool {
+		if family == "" {
+			return true
+		}
+		if valueFamily(v) != family {
+			return false
+		}
+		if hasLo {
+			if c := compareFamily(v, lo.value); c < 0 || c == 0 && !lo.inclusive {
+				return false
+			}
+		}
+		if hasHi {
+			if c := compareFamily(v, hi.value); c > 0 || c == 0 && !hi.inclusive {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(eqs) == 0 && len(ins) == 0 {
+		// Exclusions outside the range are redundant
+		var out []atom
+		for _, a := range rest {
+			switch a.op {
+			case "$ne":
+				if !inRange(a.operand) {
+					continue
+				}
+			case "$nin":
+				var kept bson.A
+				for _, v := range a.operand.(bson.A) {
+					if inRange(v) {
+						kept = append(kept, v)
+					}
+				}
+				if len(kept) == 0 {
+					continue
+				}
+				a = atom{op: a.op, operand: kept}
+			}
+			out = append(out, a)
+		}
+		out = append(boundAtoms(lower, upper), out...)
+		if len(out) == 0 {
+			out = []atom{{op: "$exists", operand: true}}
+		}
+		return out, Sometimes
+	}
+
+	// The value is one of a finite set of candidates; every constraint
+	// that can be checked on them is folded into the set
+	var candidates []interface{}
+	if len(eqs) > 0 {
+		candidates = eqs[:1]
+	} else {
+		candidates = ins[0]
+	}
+	var others []atom
+	for _, a := range rest {
+		if a.op != "$regex" {
+			others = append(others, a)
+		}
+	}
+
+	var kept bson.A
+	for _, c := range candidates {
+		if inRange(c) && allEqual(c, eqs) && inAll(c, ins) && !excludedBy(c, rest) && matchesRegexes(c, rest) {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, Never
+	}
+
+	var out []atom
+	for _, a := range others {
+		if a.op != "$ne" && a.op != "$nin" {
+			out = append(out, a)
+		}
+	}
+	return append([]atom{inAtom(kept)}, out...), Sometimes
+}
+
+func allEqual(v interface{}, values []interface{}) bool {
+	for _, other := range values {
+		if !compareEqual(other, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func inAll(v interface{}, lists []bson.A) bool {
+	for _, list := range lists {
+		found := false
+		for _, other := range list {
+			if compareEqual(other, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func excludedBy(v interface{}, atoms []atom) bool {
+	for _, a := range atoms {
+		switch a.op {
+		case "$ne":
+			if compareEqual(a.operand, v) {
+				return true
+			}
+		case "$nin":
+			for _, n := range a.operand.(bson.A) {
+				if compareEqual(n, v) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func matchesRegexes(v interface{}, atoms []atom) bool {
+	for _, a := range atoms {
+		if a.op != "$regex" {
+			continue
+		}
+		pattern, _ := a.operand.(string)
+		re, err := regexp.Compile(pattern)
+		if err != nil || !matchRegex(re, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func inAtom(values bson.A) atom {
+	if len(values) == 1 {
+		return atom{op: "$eq", operand: values[0]}
+	}
+	return atom{op: "$in", operand: values}
+}
+
+func tighterLower(b, cur bound) bool {
+	c := compareFamily(b.value, cur.value)
+	return c > 0 || c == 0 && !b.inclusive
+}
+
+func tighterUpper(b, cur bound) bool {
+	c := compareFamily(b.value, cur.value)
+	return c < 0 || c == 0 && !b.inclusive
+}
+
+func boundAtoms(lower, upper map[string]bound) []atom {
+	var out []atom
+	for _, f := range sortedFamilies(lower) {
+		op := "$gt"
+		if lower[f].inclusive {
+			op = "$gte"
+		}
+		out = append(out, atom{op: op, operand: lower[f].value})
+	}
+	for _, f := range sortedFamilies(upper) {
+		op := "$lt"
+		if upper[f].inclusive {
+			op = "$lte"
+		}
+		out = append(out, atom{op: op, operand: upper[f].value})
+	}
+	return out
+}
+
+func sortedFamilies(m map[string]bound) []string {
+	families := make([]string, 0, len(m))
+	for f := range m {
+		families = append(families, f)
+	}
+	sort.Strings(families)
+	return families
+}
@@ -0,0 +1,217 @@
+package mangomatch
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSimplify(t *testing.T) {
+	scalar := SimplifyOptions{Scalar: func(path string) bool { return path != "tags" }}
+	tests := []struct {
+		name  string
+		query string
+		opts  SimplifyOptions
+		want  Satisfiability
+		// simplified query, in Extended JSON, when want is Sometimes
+		simplified string
+	}{
+		{name: "Plain", query: `{"age": {"$gt": 5}}`, want: Sometimes, simplified: `{"age": {"$gt": 5}}`},
+		{name: "Empty query", query: `{}`, want: Never},
+		{name: "Disjoint range on a scalar", query: `{"age": {"$gt": 50, "$lt": 10}}`, opts: scalar, want: Never},
+		{name: "Disjoint range on a possible array", query: `{"age": {"$gt": 50, "$lt": 10}}`, want: Sometimes, simplified: `{"age": {"$gt": 50, "$lt": 10}}`},
+		{name: "Equality outside $in on a scalar", query: `{"$and": [{"status": "a"}, {"status": {"$in": ["b"]}}]}`, opts: scalar, want: Never},
+		{name: "Equality outside $in on a possible array", query: `{"$and": [{"status": "a"}, {"status": {"$in": ["b", "c"]}}]}`, want: Sometimes,
+			simplified: `{"status": {"$eq": "a", "$in": ["b", "c"]}}`},
+		{name: "$eq and $ne", query: `{"$and": [{"status": "a"}, {"status": {"$ne": "a"}}]}`, want: Never},
+		{name: "$in minus $nin", query: `{"status": {"$in": ["a", "b"], "$nin": ["a", "b", "c"]}}`, want: Never},
+		{name: "$in narrowed by $nin", query: `{"status": {"$in": ["a", "b", "c"], "$nin": ["a"]}}`, want: Sometimes,
+			simplified: `{"status": {"$in": ["b", "c"], "$nin": ["a"]}}`},
+		{name: "Tighter bound kept", query: `{"$and": [{"age": {"$gt": 5}}, {"age": {"$gte": 7}}, {"age": {"$gt": 7}}]}`, want: Sometimes, simplified: `{"age": {"$gt": 7}}`},
+		{name: "Point range", query: `{"age": {"$gte": 5, "$lte": 5}}`, opts: scalar, want: Sometimes, simplified: `{"age": 5}`},
+		{name: "Empty point range", query: `{"age": {"$gt": 5, "$lte": 5}}`, opts: scalar, want: Never},
+		{name: "Mixed range types on a scalar", query: `{"age": {"$gt": 5, "$lt": "z"}}`, opts: scalar, want: Never},
+		{name: "$in filtered by range", query: `{"age": {"$in": [1, 5, 9, "x"], "$gt": 4}}`, opts: scalar, want: Sometimes, simplified: `{"age": {"$in": [5, 9]}}`},
+		{name: "$in filtered by regex", query: `{"name": {"$in": ["ann", "bob", 3], "$regex": "^a"}}`, opts: scalar, want: Sometimes, simplified: `{"name": "ann"}`},
+		{name: "Redundant $ne", query: `{"age": {"$gt": 10, "$ne": 3}}`, opts: scalar, want: Sometimes, simplified: `{"age": {"$gt": 10}}`},
+		{name: "Null equality", query: `{"a": null}`, want: Sometimes, simplified: `{"a": null}`},
+		{name: "Range above null", query: `{"a": {"$gt": null}}`, want: Never},
+		{name: "Empty $in", query: `{"a": {"$in": []}}`, want: Never},
+		{name: "Boolean range", query: `{"a": {"$gt": true}}`, want: Never},
+		{name: "$ne null is not presence", query: `{"a": {"$ne": null}}`, want: Sometimes, simplified: `{"a": {"$ne": null}}`},
+		{name: "Missing and present", query: `{"$and": [{"a": {"$exists": false}}, {"a": 1}]}`, want: Never},
+		{name: "$exists false with a range", query: `{"a": {"$exists": false, "$gt": 1}}`, want: Never},
+		{name: "$exists false with null", query: `{"a": {"$exists": false, "$lte": null}}`, want: Sometimes, simplified: `{"a": {"$exists": false}}`},
+		{name: "Missing field folded", query: `{"a": {"$exists": true, "$ne": 1}}`, opts: scalar, want: Sometimes, simplified: `{"a": {"$exists": true, "$ne": 1}}`},
+		{name: "$nin without null", query: `{"a": {"$nin": [{"b": 1}]}}`, want: Always},
+		{name: "Presence folded", query: `{"a": {"$exists": true, "$gt": 1}}`, want: Sometimes, simplified: `{"a": {"$gt": 1}}`},
+		{name: "Exists or not", query: `{"$or": [{"a": {"$exists": true}}, {"a": {"$exists": false}}]}`, want: Always},
+		{name: "Exists or null-free", query: `{"$or": [{"a": {"$ne": null}}, {"a": {"$exists": false}}]}`, want: Sometimes,
+			simplified: `{"$or": [{"a": {"$exists": false}}, {"a": {"$ne": null}}]}`},
+		{name: "Never branch dropped", query: `{"$or": [{"a": {"$in": []}}, {"b": 1}]}`, want: Sometimes, simplified: `{"b": 1}`},
+		{name: "All branches never", query: `{"$or": [{"a": {"$in": []}}, {"b": {"$lt": null}}]}`, want: Never},
+		{name: "Nor of never", query: `{"$nor": [{"a": {"$in": []}}]}`, want: Always},
+		{name: "Nor of always", query: `{"$nor": [{"$or": [{"a": {"$exists": true}}, {"a": {"$exists": false}}]}]}`, want: Never},
+		{name: "Always conjunct dropped", query: `{"b": 1, "$nor": [{"a": {"$in": []}}]}`, want: Sometimes, simplified: `{"b": 1}`},
+		{name: "Empty clause", query: `{"b": 1, "$and": [{}]}`, want: Never},
+		{name: "Dotted paths are not merged", query: `{"$and": [{"a.b": {"$gt": 5}}, {"a.b": {"$lt": 1}}]}`, want: Sometimes,
+			simplified: `{"$and": [{"a.b": {"$lt": 1}}], "a.b": {"$gt": 5}}`},
+		{name: "Dotted scalar paths are merged", query: `{"$and": [{"a.b": {"$gt": 5}}, {"a.b": {"$lt": 1}}]}`, opts: scalar, want: Never},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := parseQuery(t, tt.query)
+			simplified, sat, err := SimplifyWith(query, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sat != tt.want {
+				t.Fatalf("Satisfiability = %v, want %v (simplified %v)", sat, tt.want, simplified)
+			}
+			if tt.want != Sometimes {
+				if simplified != nil {
+					t.Errorf("Expected no simplified query, got %v", simplified)
+				}
+				return
+			}
+			want, err := Normalize(parseQuery(t, tt.simplified))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := canonicalBytes(simplified), canonicalBytes(want); string(got) != string(want) {
+				t.Errorf("Simplify() = %s, want %s", got, want)
+			}
+		})
+	}
+
+	if _, _, err := Simplify(map[string]interface{}{"a": map[string]interface{}{"$foo": 1}}); err == nil {
+		t.Error("Expected an error for an invalid query")
+	}
+}
+
+// TestSimplifyPreservesMatch checks Simplify against Match on random
+// queries and documents
+func TestSimplifyPreservesMatch(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	values := []interface{}{0, 1, 2, 3, 2.5, "a", "b", "c", true, nil}
+	paths := []string{"x", "y", "o.p"}
+
+	randomValue := func(arrays bool) interface{} {
+		if arrays && r.Intn(3) == 0 {
+			arr := make([]interface{}, r.Intn(3))
+			for i := range arr {
+				arr[i] = values[r.Intn(len(values))]
+			}
+			return arr
+		}
+		return values[r.Intn(len(values))]
+	}
+	randomList := func() []interface{} {
+		list := make([]interface{}, r.Intn(4))
+		for i := range list {
+			list[i] = values[r.Intn(len(values))]
+		}
+		return list
+	}
+	randomCondition := func() interface{} {
+		if r.Intn(4) == 0 {
+			return values[r.Intn(len(values))]
+		}
+		ops := map[string]interface{}{}
+		for n := 1 + r.Intn(2); n > 0; n-- {
+			switch op := []string{"$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$in", "$nin", "$exists", "$regex", "$size"}[r.Intn(11)]; op {
+			case "$in", "$nin":
+				ops[op] = randomList()
+			case "$exists":
+				ops[op] = r.Intn(2) == 0
+			case "$regex":
+				ops[op] = []string{"^a", "b|c", "."}[r.Intn(3)]
+			case "$size":
+				ops[op] = r.Intn(3)
+			default:
+				ops[op] = values[r.Intn(len(values))]
+			}
+		}
+		return ops
+	}
+	var randomQuery func(depth int) map[string]interface{}
+	randomQuery = func(depth int) map[string]interface{} {
+		q := map[string]interface{}{}
+		for n := 1 + r.Intn(3); n > 0; n-- {
+			if depth > 0 && r.Intn(4) == 0 {
+				clauses := make([]interface{}, 1+r.Intn(3))
+				for i := range clauses {
+					clauses[i] = randomQuery(depth - 1)
+				}
+				q[[]string{"$and", "$or", "$nor"}[r.Intn(3)]] = clauses
+				continue
+			}
+			q[paths[r.Intn(len(paths))]] = randomCondition()
+		}
+		return q
+	}
+	randomDoc := func(arrays bool) map[string]interface{} {
+		doc := map[string]interface{}{}
+		if r.Intn(4) > 0 {
+			doc["x"] = randomValue(arrays)
+		}
+		if r.Intn(4) > 0 {
+			doc["y"] = randomValue(arrays)
+		}
+		if r.Intn(4) > 0 {
+			doc["o"] = map[string]interface{}{"p": randomValue(arrays)}
+		}
+		return doc
+	}
+
+	allScalar := SimplifyOptions{Scalar: func(string) bool { return true }}
+	counts := map[Satisfiability]int{}
+	for i := 0; i < 3000; i++ {
+		query := randomQuery(2)
+		arrays := i%2 == 0
+		opts := SimplifyOptions{}
+		if !arrays {
+			opts = allScalar
+		}
+		simplified, sat, err := SimplifyWith(query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[sat]++
+
+		var q *Query
+		if sat == Sometimes {
+			q = MustCompile(simplified)
+		}
+		for j := 0; j < 30; j++ {
+			doc := randomDoc(arrays)
+			want := Match(query, doc)
+			var got bool
+			switch sat {
+			case Never:
+				got = false
+			case Always:
+				got = true
+			default:
+				got = q.Match(doc)
+			}
+			if got != want {
+				t.Fatalf("query %v (scalar %v)\nsimplified %v (%v)\ndoc %v: got %v, Match %v", query, !arrays, simplified, sat, doc, got, want)
+			}
+		}
+	}
+	if counts[Never] == 0 || counts[Always] == 0 {
+		t.Errorf("random queries did not exercise every outcome: %v", counts)
+	}
+}
+
+func ExampleSimplify() {
+	_, sat, _ := SimplifyWith(bson.M{"age": bson.M{"$gt": 50, "$lt": 10}}, SimplifyOptions{
+		Scalar: func(path string) bool { return path == "age" },
+	})
+	fmt.Println(sat)
+	// Output: never
+}
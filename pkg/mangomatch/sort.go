@@ -0,0 +1,167 @@
+package mangomatch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortField is one key of a sort specification
+type SortField struct {
+	Path       string
+	Descending bool
+}
+
+// ParseSort parses a comma separated sort specification such as "-age,name",
+// where a leading "-" sorts that field in descending order
+func ParseSort(spec string) ([]SortField, error) {
+	var fields []SortField
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Path: part}
+		if strings.HasPrefix(part, "-") {
+			field = SortField{Path: part[1:], Descending: true}
+		} else if strings.HasPrefix(part, "+") {
+			field.Path = part[1:]
+		}
+		if field.Path == "" {
+			return nil, fmt.Errorf("mangomatch: empty field in sort specification %q", spec)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// SortDocuments stably sorts docs by fields using MongoDB's ordering of
+// values across types. Missing fields sort as null. Arrays sort by their
+// smallest element in ascending order and their largest in descending order.
+func SortDocuments(docs []map[string]interface{}, fields []SortField) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return CompareDocuments(docs[i], docs[j], fields) < 0
+	})
+}
+
+// CompareDocuments returns -1, 0 or 1 depending on whether a sorts before,
+// together with or after b under fields
+func CompareDocuments(a, b map[string]interface{}, fields []SortField) int {
+	return compareDocuments(a, b, fields, nil)
+}
+
+// compareDocuments compares strings under col, which may be nil
+func compareDocuments(a, b map[string]interface{}, fields []SortField, col *Collator) int {
+	for _, field := range fields {
+		c := compareValues(sortKey(a, field, col), sortKey(b, field, col))
+		if c == 0 {
+			continue
+		}
+		if field.Descending {
+			return -c
+		}
+		return c
+	}
+	return 0
+}
+
+func sortKey(doc map[string]interface{}, field SortField, col *Collator) interface{} {
+	val, exists := getNestedValue(doc, strings.Split(field.Path, "."))
+	if !exists {
+		return nil
+	}
+	val = col.keys(val)
+	arr, ok := val.([]interface{})
+	if !ok || len(arr) == 0 {
+		return val
+	}
+
+	key := arr[0]
+	for _, item := range arr[1:] {
+		c := compareValues(item, key)
+		if (field.Descending && c > 0) || (!field.Descending && c < 0) {
+			key = item
+		}
+	}
+	return key
+}
+
+// typeOrder ranks values by MongoDB's comparison order of BSON types
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 1
+	case int, float64:
+		return 2
+	case string:
+		return 3
+	case map[string]interface{}:
+		return 4
+	case []interface{}:
+		return 5
+	case bool:
+		return 8
+	case time.Time:
+		return 9
+	default:
+		return 10
+	}
+}
+
+// compareValues returns -1, 0 or 1 comparing a and b, ordering values of
+// different types by their BSON type
+func compareValues(a, b interface{}) int {
+	a, b = widenNumber(a), widenNumber(b)
+	ta, tb := typeOrder(a), typeOrder(b)
+	if ta != tb {
+		if ta < tb {
+			return -1
+		}
+		return 1
+	}
+
+	switch av := a.(type) {
+	case int, float64:
+		x, y := toFloat(a), toFloat(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	case string:
+		return strings.Compare(av, b.(string))
+	case bool:
+		bv := b.(bool)
+		switch {
+		case !av && bv:
+			return -1
+		case av && !bv:
+			return 1
+		}
+	case time.Time:
+		return av.Compare(b.(time.Time))
+	case []interface{}:
+		bv := b.([]interface{})
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := compareValues(av[i], bv[i]); c != 0 {
+				return c
+			}
+		}
+		switch {
+		case len(av) < len(bv):
+			return -1
+		case len(av) > len(bv):
+			return 1
+		}
+	}
+	return 0
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := widenNumber(v).(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
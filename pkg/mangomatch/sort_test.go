@@ -0,0 +1,73 @@
+package mangomatch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSort(t *testing.T) {
+	got, err := ParseSort("-age, name,+city")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SortField{{Path: "age", Descending: true}, {Path: "name"}, {Path: "city"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSort() = %v, want %v", got, want)
+	}
+
+	if _, err := ParseSort("age,,name"); err == nil {
+		t.Error("Expected an error for an empty field")
+	}
+}
+
+func TestSortDocuments(t *testing.T) {
+	names := func(docs []map[string]interface{}) []interface{} {
+		var out []interface{}
+		for _, doc := range docs {
+			out = append(out, doc["name"])
+		}
+		return out
+	}
+
+	docs := []map[string]interface{}{
+		{"name": "c", "age": 30, "city": "Boston"},
+		{"name": "a", "age": 25.5, "city": "Austin"},
+		{"name": "b", "age": 30, "city": "Austin"},
+		{"name": "d"},
+		{"name": "e", "age": "unknown"},
+	}
+
+	SortDocuments(docs, []SortField{{Path: "age"}, {Path: "city"}})
+	if got, want := names(docs), []interface{}{"d", "a", "b", "c", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ascending sort = %v, want %v", got, want)
+	}
+
+	SortDocuments(docs, []SortField{{Path: "age", Descending: true}, {Path: "name"}})
+	if got, want := names(docs), []interface{}{"e", "b", "c", "a", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("descending sort = %v, want %v", got, want)
+	}
+}
+
+func TestSortDocumentsArraysAndDates(t *testing.T) {
+	early := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(24 * time.Hour)
+
+	docs := []map[string]interface{}{
+		{"name": "x", "scores": []interface{}{5, 50}, "at": late},
+		{"name": "y", "scores": []interface{}{10, 20}, "at": early},
+	}
+
+	SortDocuments(docs, []SortField{{Path: "scores"}})
+	if docs[0]["name"] != "x" {
+		t.Error("Expected ascending array sort to use the smallest element")
+	}
+	SortDocuments(docs, []SortField{{Path: "scores", Descending: true}})
+	if docs[0]["name"] != "x" {
+		t.Error("Expected descending array sort to use the largest element")
+	}
+	SortDocuments(docs, []SortField{{Path: "at"}})
+	if docs[0]["name"] != "y" {
+		t.Error("Expected dates to sort chronologically")
+	}
+}
@@ -0,0 +1,164 @@
+package sqlwhere
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Bind records an argument and returns the placeholder that refers to it.
+// Arguments must be bound in the order their placeholders appear in the SQL.
+type Bind func(value interface{}) string
+
+// Dialect renders the JSON-specific parts of a WHERE clause. Conditions on a
+// field are evaluated per element: the value at a path is visited directly,
+// or element by element when it is an array, as MongoDB does.
+type Dialect interface {
+	// Placeholder returns the marker of the n-th argument, counting from 1
+	Placeholder(n int) string
+
+	// Exists returns a condition that holds when path is present, even if
+	// its value is null
+	Exists(path []string, bind Bind) string
+
+	// AnyValue returns a condition that holds when pred holds for the value
+	// at path or, if that value is an array, for any of its elements. pred
+	// is called after the path has been bound and refers to the element
+	// through Number, Text and IsType.
+	AnyValue(path []string, bind Bind, pred func() string) string
+
+	// ArraySize returns a condition that holds when the value at path is an
+	// array with size elements
+	ArraySize(path []string, bind Bind, size int) string
+
+	// IsType returns a condition on the JSON type of the current element:
+	// "number", "string", "true", "false" or "null"
+	IsType(jsonType string) string
+
+	// Number and Text return the current element as an SQL number or string
+	Number() string
+	Text() string
+
+	// Regex returns a condition matching Text against a bound pattern
+	Regex(pattern string) string
+}
+
+// SQLite targets the JSON1 functions. Column is the JSON text column holding
+// the document and defaults to "doc". SQLite has no built-in regular
+// expression support, so $regex requires a regexp(pattern, value) function
+// to be registered on the connection.
+type SQLite struct {
+	Column string
+}
+
+func (d SQLite) column() string {
+	if d.Column == "" {
+		return "doc"
+	}
+	return d.Column
+}
+
+// jsonPath renders path as an SQLite JSON path such as $."a"."b"[0]
+func (d SQLite) jsonPath(path []string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, part := range path {
+		if _, err := strconv.Atoi(part); err == nil {
+			fmt.Fprintf(&b, "[%s]", part)
+		} else {
+			fmt.Fprintf(&b, ".%q", part)
+		}
+	}
+	return b.String()
+}
+
+func (d SQLite) Placeholder(int) string { return "?" }
+
+func (d SQLite) Exists(path []string, bind Bind) string {
+	return fmt.Sprintf("json_type(%s, %s) IS NOT NULL", d.column(), bind(d.jsonPath(path)))
+}
+
+func (d SQLite) AnyValue(path []string, bind Bind, pred func() string) string {
+	// json_each yields one row for a scalar, one per element for an array
+	// and one per member for an object; members have text keys
+	from := fmt.Sprintf("json_each(%s, %s) AS e", d.column(), bind(d.jsonPath(path)))
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE typeof(e.key) <> 'text' AND %s)", from, pred())
+}
+
+func (d SQLite) ArraySize(path []string, bind Bind, size int) string {
+	jsonPath := d.jsonPath(path)
+	return fmt.Sprintf("(json_type(%s, %s) = 'array' AND json_array_length(%s, %s) = %s)",
+		d.column(), bind(jsonPath), d.column(), bind(jsonPath), bind(size))
+}
+
+func (d SQLite) IsType(jsonType string) string {
+	if jsonType == "number" {
+		return "e.type IN ('integer', 'real')"
+	}
+	if jsonType == "string" {
+		return "e.type = 'text'"
+	}
+	return fmt.Sprintf("e.type = '%s'", jsonType)
+}
+
+func (d SQLite) Number() string { return "e.value" }
+func (d SQLite) Text() string   { return "e.value" }
+
+func (d SQLite) Regex(pattern string) string {
+	return fmt.Sprintf("e.value REGEXP %s", pattern)
+}
+
+// Postgres targets JSONB. Column is the jsonb column holding the document and
+// defaults to "doc". $regex uses POSIX regular expressions (~), whose syntax
+// differs from Go's in some corner cases.
+type Postgres struct {
+	Column string
+}
+
+func (d Postgres) column() string {
+	if d.Column == "" {
+		return "doc"
+	}
+	return d.Column
+}
+
+// extract renders jsonb_extract_path with one bound argument per segment
+func (d Postgres) extract(path []string, bind Bind) string {
+	args := make([]string, len(path))
+	for i, part := range path {
+		args[i] = bind(part)
+	}
+	return fmt.Sprintf("jsonb_extract_path(%s, %s)", d.column(), strings.Join(args, ", "))
+}
+
+func (d Postgres) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (d Postgres) Exists(path []string, bind Bind) string {
+	return d.extract(path, bind) + " IS NOT NULL"
+}
+
+func (d Postgres) AnyValue(path []string, bind Bind, pred func() string) string {
+	from := fmt.Sprintf("(SELECT %s AS v) AS f", d.extract(path, bind))
+	elements := "jsonb_array_elements(CASE WHEN jsonb_typeof(f.v) = 'array' THEN f.v ELSE jsonb_build_array(f.v) END) AS e(value)"
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s, %s WHERE f.v IS NOT NULL AND %s)", from, elements, pred())
+}
+
+func (d Postgres) ArraySize(path []string, bind Bind, size int) string {
+	v := d.extract(path, bind)
+	return fmt.Sprintf("(jsonb_typeof(%s) = 'array' AND jsonb_array_length(%s) = %s)", v, v, bind(size))
+}
+
+func (d Postgres) IsType(jsonType string) string {
+	switch jsonType {
+	case "true", "false":
+		return fmt.Sprintf("e.value = '%s'::jsonb", jsonType)
+	}
+	return fmt.Sprintf("jsonb_typeof(e.value) = '%s'", jsonType)
+}
+
+func (d Postgres) Number() string { return "(e.value)::numeric" }
+func (d Postgres) Text() string   { return "(e.value #>> '{}')" }
+
+func (d Postgres) Regex(pattern string) string {
+	return fmt.Sprintf("%s ~ %s", d.Text(), pattern)
+}
@@ -0,0 +1,307 @@
+// Package sqlwhere translates mangomatch queries into parameterized SQL WHERE
+// clauses over a JSON document column, so the same user-supplied filters
+// can run against collections mirrored into SQLite or Postgres:
+//
+//	where, args, err := sqlwhere.Translate(query, sqlwhere.Postgres{Column: "data"})
+//	rows, err := db.Query("SELECT data FROM users WHERE "+where, args...)
+//
+// Values and field paths are always passed as arguments, never spliced into
+// the SQL. Supported operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin,
+// $exists, $regex, $size, $not, $and, $or and $nor. Operands must be numbers,
+// strings, booleans or null. Dotted paths descend through embedded documents
+// and numeric segments index arrays; array elements are only searched at the
+// end of a path. Missing fields behave as in Match: they are tested like
+// null, so {"a": null} and {"a": {"$ne": 1}} match a document without a.
+package sqlwhere
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+)
+
+// ErrUnsupported is returned (wrapped) for valid queries that cannot be
+// expressed in SQL
+var ErrUnsupported = errors.New("sqlwhere: unsupported")
+
+// Translate validates query with the default engine and returns the
+// equivalent WHERE condition and its arguments. The query may be anything
+// mangomatch.Compile accepts. An empty query becomes a condition that is
+// always true.
+func Translate(query interface{}, d Dialect) (string, []interface{}, error) {
+	q, err := mangomatch.Compile(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	t := &translator{d: d}
+	where, err := t.query(q.Filter())
+	if err != nil {
+		return "", nil, err
+	}
+	return where, t.args, nil
+}
+
+type translator struct {
+	d    Dialect
+	args []interface{}
+}
+
+func (t *translator) bind(value interface{}) string {
+	t.args = append(t.args, value)
+	return t.d.Placeholder(len(t.args))
+}
+
+// query translates a query document, joining its conditions with AND
+func (t *translator) query(filter map[string]interface{}) (string, error) {
+	var conds []string
+	for _, key := range sortedKeys(filter) {
+		value := filter[key]
+		var cond string
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			cond, err = t.logical(key, value)
+		default:
+			cond, err = t.field(key, value)
+		}
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+
+	switch len(conds) {
+	case 0:
+		return "1 = 1", nil
+	case 1:
+		return conds[0], nil
+	default:
+		return "(" + strings.Join(conds, " AND ") + ")", nil
+	}
+}
+
+func (t *translator) logical(op string, value interface{}) (string, error) {
+	clauses, _ := value.([]interface{})
+	conds := make([]string, 0, len(clauses))
+	for _, clause := range clauses {
+		sub, _ := clause.(map[string]interface{})
+		cond, err := t.query(sub)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+
+	switch op {
+	case "$and":
+		return "(" + strings.Join(conds, " AND ") + ")", nil
+	case "$or":
+		return "(" + strings.Join(conds, " OR ") + ")", nil
+	default:
+		return "NOT (" + strings.Join(conds, " OR ") + ")", nil
+	}
+}
+
+func (t *translator) field(key string, value interface{}) (string, error) {
+	path := strings.Split(key, ".")
+	for _, part := range path {
+		if part == "" || strings.ContainsAny(part, "\"\\") {
+			return "", fmt.Errorf("%w field name %q", ErrUnsupported, key)
+		}
+	}
+
+	ops, ok := value.(map[string]interface{})
+	if !ok || !isOperatorMap(ops) {
+		return t.equal(path, value)
+	}
+	return t.operators(path, ops)
+}
+
+// operators translates an operator document; each operator is a separate
+// condition, so different array elements may satisfy different operators
+func (t *translator) operators(path []string, ops map[string]interface{}) (string, error) {
+	var conds []string
+	for _, op := range sortedKeys(ops) {
+		cond, err := t.operator(path, op, ops[op])
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return "(" + strings.Join(conds, " AND ") + ")", nil
+}
+
+func (t *translator) operator(path []string, op string, operand interface{}) (string, error) {
+	switch op {
+	case "$eq":
+		return t.equal(path, operand)
+	case "$ne":
+		cond, err := t.equal(path, operand)
+		return "NOT " + cond, err
+	case "$gt", "$gte", "$lt", "$lte":
+		return t.compare(path, op, operand)
+	case "$in":
+		return t.in(path, operand)
+	case "$nin":
+		cond, err := t.in(path, operand)
+		return "NOT " + cond, err
+	case "$exists":
+		cond := t.d.Exists(path, t.bind)
+		if exists, _ := operand.(bool); !exists {
+			return "NOT " + cond, nil
+		}
+		return cond, nil
+	case "$regex":
+		pattern, _ := operand.(string)
+		return t.d.AnyValue(path, t.bind, func() string {
+			return fmt.Sprintf("(%s AND %s)", t.d.IsType("string"), t.d.Regex(t.bind(pattern)))
+		}), nil
+	case "$size":
+		size, ok := operand.(int)
+		switch n := operand.(type) {
+		case int64:
+			size, ok = int(n), true
+		case float64:
+			size, ok = int(n), n == float64(int(n))
+		}
+		if !ok {
+			return "", fmt.Errorf("%w $size operand %v", ErrUnsupported, operand)
+		}
+		return t.d.ArraySize(path, t.bind, size), nil
+	case "$not":
+		sub, _ := operand.(map[string]interface{})
+		cond, err := t.operators(path, sub)
+		return "NOT " + cond, err
+	default:
+		return "", fmt.Errorf("%w operator %s", ErrUnsupported, op)
+	}
+}
+
+// equal matches the value itself or any array element equal to operand.
+// The conditions on values are false on a missing field, so $ne, $nin and
+// $not hold there; only those that match null add the missing field.
+func (t *translator) equal(path []string, operand interface{}) (string, error) {
+	if operand == nil {
+		return t.orMissing(path, func() string {
+			return t.d.AnyValue(path, t.bind, func() string { return t.d.IsType("null") })
+		}), nil
+	}
+	if err := checkScalar(operand); err != nil {
+		return "", err
+	}
+	return t.d.AnyValue(path, t.bind, func() string {
+		return t.scalarEqual(operand)
+	}), nil
+}
+
+func (t *translator) scalarEqual(operand interface{}) string {
+	switch v := operand.(type) {
+	case bool:
+		if v {
+			return t.d.IsType("true")
+		}
+		return t.d.IsType("false")
+	case string:
+		return fmt.Sprintf("(%s AND %s = %s)", t.d.IsType("string"), t.d.Text(), t.bind(v))
+	default:
+		return fmt.Sprintf("(%s AND %s = %s)", t.d.IsType("number"), t.d.Number(), t.bind(v))
+	}
+}
+
+var comparisons = map[string]string{"$gt": ">", "$gte": ">=", "$lt": "<", "$lte": "<="}
+
+// compare only matches values of the operand's type, as MongoDB does
+func (t *translator) compare(path []string, op string, operand interface{}) (string, error) {
+	switch v := operand.(type) {
+	case nil:
+		if op == "$gte" || op == "$lte" {
+			return t.equal(path, nil)
+		}
+		return "1 = 0", nil
+	case int, int64, float64:
+		return t.d.AnyValue(path, t.bind, func() string {
+			return fmt.Sprintf("(%s AND %s %s %s)", t.d.IsType("number"), t.d.Number(), comparisons[op], t.bind(v))
+		}), nil
+	case string:
+		return t.d.AnyValue(path, t.bind, func() string {
+			return fmt.Sprintf("(%s AND %s %s %s)", t.d.IsType("string"), t.d.Text(), comparisons[op], t.bind(v))
+		}), nil
+	default:
+		return "", fmt.Errorf("%w %s operand of type %T", ErrUnsupported, op, operand)
+	}
+}
+
+func (t *translator) in(path []string, operand interface{}) (string, error) {
+	values, _ := operand.([]interface{})
+	if len(values) == 0 {
+		return "1 = 0", nil
+	}
+
+	hasNull := false
+	for _, v := range values {
+		if v == nil {
+			hasNull = true
+			continue
+		}
+		if err := checkScalar(v); err != nil {
+			return "", err
+		}
+	}
+
+	cond := func() string {
+		return t.d.AnyValue(path, t.bind, func() string {
+			preds := make([]string, len(values))
+			for i, v := range values {
+				if v == nil {
+					preds[i] = t.d.IsType("null")
+				} else {
+					preds[i] = t.scalarEqual(v)
+				}
+			}
+			return "(" + strings.Join(preds, " OR ") + ")"
+		})
+	}
+	if hasNull {
+		return t.orMissing(path, cond), nil
+	}
+	return cond(), nil
+}
+
+// orMissing extends the condition that cond builds to a missing field
+func (t *translator) orMissing(path []string, cond func() string) string {
+	exists := t.d.Exists(path, t.bind)
+	return "(NOT " + exists + " OR " + cond() + ")"
+}
+
+func checkScalar(v interface{}) error {
+	switch v.(type) {
+	case int, int64, float64, string, bool:
+		return nil
+	}
+	return fmt.Errorf("%w comparison with a value of type %T", ErrUnsupported, v)
+}
+
+func isOperatorMap(m map[string]interface{}) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
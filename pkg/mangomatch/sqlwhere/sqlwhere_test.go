@@ -0,0 +1,231 @@
+package sqlwhere
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/The-iyed/mangomatch/pkg/mangomatch"
+	"modernc.org/sqlite"
+)
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		pattern, _ := args[0].(string)
+		value, ok := args[1].(string)
+		if !ok {
+			return false, nil
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(value), nil
+	})
+}
+
+var sqlTestDocs = []map[string]interface{}{
+	{"id": 1, "name": "alice", "age": 34, "score": 8.5, "active": true, "tags": []interface{}{"admin", "dev"}, "address": map[string]interface{}{"city": "Paris"}},
+	{"id": 2, "name": "bob", "age": 25, "active": false, "tags": []interface{}{"dev"}, "manager": nil},
+	{"id": 3, "name": "carol", "age": 41, "score": 6, "tags": []interface{}{}, "address": map[string]interface{}{"city": "Berlin"}},
+	{"id": 4, "name": "dave", "age": "unknown", "active": true, "scores": []interface{}{3, 9}},
+	{"id": 5, "name": "Eve", "address": map[string]interface{}{"city": "paris", "zip": "75001"}},
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("CREATE TABLE docs (id INTEGER PRIMARY KEY, doc TEXT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range sqlTestDocs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("INSERT INTO docs (id, doc) VALUES (?, ?)", doc["id"], string(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// TestSQLiteMatchesMatch runs each query through SQLite and through Match and
+// expects the same documents
+func TestSQLiteMatchesMatch(t *testing.T) {
+	db := openTestDB(t)
+
+	queries := []map[string]interface{}{
+		{"name": "alice"},
+		{"age": 25},
+		{"age": 25.0},
+		{"active": true},
+		{"active": false},
+		{"tags": "dev"},
+		{"address.city": "Paris"},
+		{"age": map[string]interface{}{"$gt": 30}},
+		{"age": map[string]interface{}{"$gte": 25, "$lt": 41}},
+		{"score": map[string]interface{}{"$lte": 6}},
+		{"name": map[string]interface{}{"$gt": "bob"}},
+		{"name": map[string]interface{}{"$ne": "alice"}},
+		{"age": map[string]interface{}{"$ne": 25}},
+		{"name": map[string]interface{}{"$in": []interface{}{"alice", "carol"}}},
+		{"tags": map[string]interface{}{"$in": []interface{}{"admin", 7}}},
+		{"name": map[string]interface{}{"$nin": []interface{}{"alice", "bob"}}},
+		{"score": map[string]interface{}{"$exists": true}},
+		{"score": map[string]interface{}{"$exists": false}},
+		{"manager": map[string]interface{}{"$exists": true}},
+		{"name": map[string]interface{}{"$regex": "^[a-c]"}},
+		{"address.city": map[string]interface{}{"$regex": "^[Pp]ar"}},
+		{"tags": map[string]interface{}{"$size": 1}},
+		{"tags": map[string]interface{}{"$size": 0}},
+		{"age": map[string]interface{}{"$gte": int64(30)}, "tags": map[string]interface{}{"$size": int64(1)}},
+		{"age": map[string]interface{}{"$not": map[string]interface{}{"$gt": 30}}},
+		{"$or": []interface{}{
+			map[string]interface{}{"age": map[string]interface{}{"$lt": 30}},
+			map[string]interface{}{"address.city": "Berlin"},
+		}},
+		{"$and": []interface{}{
+			map[string]interface{}{"active": true},
+			map[string]interface{}{"tags": "admin"},
+		}},
+		{"$nor": []interface{}{
+			map[string]interface{}{"active": true},
+			map[string]interface{}{"age": 41},
+		}},
+		{"name": "dave", "active": true},
+		{"score": map[string]interface{}{"$nin": []interface{}{6}}},
+		{"score": map[string]interface{}{"$exists": false, "$gt": 1}},
+		{"score": nil},
+		{"manager": nil},
+		{"score": map[string]interface{}{"$ne": nil}},
+		{"score": map[string]interface{}{"$in": []interface{}{nil, 6}}},
+		{"score": map[string]interface{}{"$nin": []interface{}{nil}}},
+		{"score": map[string]interface{}{"$gte": nil}},
+		{"score": map[string]interface{}{"$lt": nil}},
+		{"address.zip": nil},
+		{"score": map[string]interface{}{"$not": map[string]interface{}{"$exists": true}}},
+	}
+
+	for _, query := range queries {
+		t.Run(fmt.Sprint(query), func(t *testing.T) {
+			var want []int
+			for _, doc := range sqlTestDocs {
+				if mangomatch.Match(query, doc) {
+					want = append(want, doc["id"].(int))
+				}
+			}
+
+			where, args, err := Translate(query, SQLite{})
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			rows, err := db.Query("SELECT id FROM docs WHERE "+where+" ORDER BY id", args...)
+			if err != nil {
+				t.Fatalf("query %s failed: %v", where, err)
+			}
+			defer rows.Close()
+
+			var got []int
+			for rows.Next() {
+				var id int
+				if err := rows.Scan(&id); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, id)
+			}
+			sort.Ints(got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("SQL %s %v selected %v, Match selected %v", where, args, got, want)
+			}
+		})
+	}
+}
+
+func TestTranslatePostgres(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    map[string]interface{}
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "equality",
+			query:    map[string]interface{}{"address.city": "Paris"},
+			wantSQL:  "EXISTS (SELECT 1 FROM (SELECT jsonb_extract_path(data, $1, $2) AS v) AS f, jsonb_array_elements(CASE WHEN jsonb_typeof(f.v) = 'array' THEN f.v ELSE jsonb_build_array(f.v) END) AS e(value) WHERE f.v IS NOT NULL AND (jsonb_typeof(e.value) = 'string' AND (e.value #>> '{}') = $3))",
+			wantArgs: []interface{}{"address", "city", "Paris"},
+		},
+		{
+			name:     "comparison and exists",
+			query:    map[string]interface{}{"age": map[string]interface{}{"$gt": 30, "$exists": true}},
+			wantSQL:  "(jsonb_extract_path(data, $1) IS NOT NULL AND EXISTS (SELECT 1 FROM (SELECT jsonb_extract_path(data, $2) AS v) AS f, jsonb_array_elements(CASE WHEN jsonb_typeof(f.v) = 'array' THEN f.v ELSE jsonb_build_array(f.v) END) AS e(value) WHERE f.v IS NOT NULL AND (jsonb_typeof(e.value) = 'number' AND (e.value)::numeric > $3)))",
+			wantArgs: []interface{}{"age", "age", 30},
+		},
+		{
+			name:     "size",
+			query:    map[string]interface{}{"tags": map[string]interface{}{"$size": 2}},
+			wantSQL:  "(jsonb_typeof(jsonb_extract_path(data, $1)) = 'array' AND jsonb_array_length(jsonb_extract_path(data, $1)) = $2)",
+			wantArgs: []interface{}{"tags", 2},
+		},
+		{
+			name:     "nor with regex",
+			query:    map[string]interface{}{"$nor": []interface{}{map[string]interface{}{"name": map[string]interface{}{"$regex": "^a"}}}},
+			wantSQL:  "NOT (EXISTS (SELECT 1 FROM (SELECT jsonb_extract_path(data, $1) AS v) AS f, jsonb_array_elements(CASE WHEN jsonb_typeof(f.v) = 'array' THEN f.v ELSE jsonb_build_array(f.v) END) AS e(value) WHERE f.v IS NOT NULL AND (jsonb_typeof(e.value) = 'string' AND (e.value #>> '{}') ~ $2)))",
+			wantArgs: []interface{}{"name", "^a"},
+		},
+		{
+			name:    "empty query",
+			query:   map[string]interface{}{},
+			wantSQL: "1 = 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := Translate(tt.query, Postgres{Column: "data"})
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("SQL = %s\nwant  %s", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	unsupported := []map[string]interface{}{
+		{"tags": map[string]interface{}{"$all": []interface{}{"a"}}},
+		{"tags": map[string]interface{}{"$elemMatch": map[string]interface{}{"$gt": 1}}},
+		{"age": map[string]interface{}{"$type": "number"}},
+		{"age": map[string]interface{}{"$mod": []interface{}{2, 0}}},
+		{"address": map[string]interface{}{"city": "Paris"}},
+		{"active": map[string]interface{}{"$gt": true}},
+		{`we"ird`: 1},
+	}
+	for _, query := range unsupported {
+		if _, _, err := Translate(query, SQLite{}); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Translate(%v) error = %v, want ErrUnsupported", query, err)
+		}
+	}
+
+	_, _, err := Translate(map[string]interface{}{"age": map[string]interface{}{"$near": 1}}, SQLite{})
+	if !errors.Is(err, mangomatch.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for an unknown operator, got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package mangomatch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Format is the encoding of the documents read by a Stream
+type Format string
+
+const (
+	// FormatJSON reads a JSON array of documents or concatenated documents
+	FormatJSON Format = "json"
+	// FormatNDJSON reads one document per line; blank lines are skipped
+	FormatNDJSON Format = "ndjson"
+	// FormatBSON reads concatenated BSON documents, as written by mongodump
+	FormatBSON Format = "bson"
+)
+
+// maxBSONSize bounds the length prefix of a BSON document, so that a corrupt
+// prefix cannot make the stream allocate gigabytes. MongoDB documents are at
+// most 16 MiB.
+const maxBSONSize = 16 * 1024 * 1024
+
+// StreamError reports a malformed record. Line is set for NDJSON input and
+// Offset, the byte offset where the record starts, for every format.
+type StreamError struct {
+	Line   int
+	Offset int64
+	Err    error
+}
+
+func (e *StreamError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("mangomatch: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("mangomatch: offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// Stream reads documents from an io.Reader one at a time and yields those
+// that match a query, without holding more than one document in memory:
+//
+//	s, err := mangomatch.NewStream(f, mangomatch.FormatNDJSON, query)
+//	for s.Next() {
+//		process(s.Doc())
+//	}
+//	if err := s.Err(); err != nil { ... }
+type Stream struct {
+	r        *bufio.Reader
+	format   Format
+	query    *Query
+	matchAll bool
+
+	dec     *json.Decoder
+	inArray bool
+	started bool
+
+	buf    []byte
+	raw    []byte
+	doc    map[string]interface{}
+	line   int
+	offset int64 // where the current record starts
+	next   int64 // where the next record starts
+	err    error
+}
+
+// NewStream returns a Stream over r. query may be anything Compile
+// accepts; like the $match stage, a nil or empty query selects every
+// document.
+func NewStream(r io.Reader, format Format, query interface{}) (*Stream, error) {
+	switch format {
+	case FormatJSON, FormatNDJSON, FormatBSON:
+	default:
+		return nil, fmt.Errorf("mangomatch: unknown stream format %q", format)
+	}
+
+	s := &Stream{r: bufio.NewReader(r), format: format, matchAll: true}
+	if query != nil {
+		q, err := Compile(query)
+		if err != nil {
+			return nil, err
+		}
+		s.query, s.matchAll = q, len(q.Filter()) == 0
+	}
+	return s, nil
+}
+
+// Next advances to the next matching document. It returns false at the end
+// of the input or on an error, which Err then reports.
+func (s *Stream) Next() bool {
+	for s.err == nil {
+		var ok bool
+		switch s.format {
+		case FormatJSON:
+			ok = s.nextJSON()
+		case FormatNDJSON:
+			ok = s.nextNDJSON()
+		default:
+			ok = s.nextBSON()
+		}
+		if !ok {
+			return false
+		}
+		if s.matchAll || s.query.Match(s.doc) {
+			return true
+		}
+	}
+	return false
+}
+
+// Doc returns the current document
+func (s *Stream) Doc() map[string]interface{} {
+	return s.doc
+}
+
+// Raw returns the encoded current document: its line for NDJSON, its JSON
+// text for JSON and its bytes for BSON. The slice is reused by the next
+// call to Next.
+func (s *Stream) Raw() []byte {
+	return s.raw
+}
+
+// Line returns the line number of the current document for NDJSON input
+func (s *Stream) Line() int {
+	return s.line
+}
+
+// Offset returns the byte offset where the current document starts
+func (s *Stream) Offset() int64 {
+	return s.offset
+}
+
+// Err returns the first error met by Next, or nil at a clean end of input
+func (s *Stream) Err() error {
+	return s.err
+}
+
+func (s *Stream) fail(err error) bool {
+	s.doc, s.raw = nil, nil
+	s.err = &StreamError{Line: s.line, Offset: s.offset, Err: err}
+	return false
+}
+
+func (s *Stream) nextNDJSON() bool {
+	for {
+		s.buf = s.buf[:0]
+		var err error
+		for {
+			var chunk []byte
+			chunk, err = s.r.ReadSlice('\n')
+			s.buf = append(s.buf, chunk...)
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		if err != nil && err != io.EOF {
+			s.err = err
+			return false
+		}
+		if len(s.buf) == 0 {
+			return false
+		}
+
+		s.line++
+		s.offset = s.next
+		s.next += int64(len(s.buf))
+		if len(bytes.TrimSpace(s.buf)) == 0 {
+			continue
+		}
+		doc, perr := ParseExtJSON(s.buf)
+		if perr != nil {
+			return s.fail(perr)
+		}
+		s.doc, s.raw = doc, s.buf
+		return true
+	}
+}
+
+func (s *Stream) nextJSON() bool {
+	if !s.started {
+		s.started = true
+		s.dec = json.NewDecoder(s.r)
+		first, err := peekNonSpace(s.r)
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			s.err = err
+			return false
+		}
+		if first == '[' {
+			s.inArray = true
+			if _, err := s.dec.Token(); err != nil {
+				return s.fail(err)
+			}
+		}
+	}
+
+	if s.inArray && !s.dec.More() {
+		if _, err := s.dec.Token(); err != nil {
+			s.offset = s.dec.InputOffset()
+			return s.fail(err)
+		}
+		return false
+	}
+
+	s.offset = s.dec.InputOffset()
+	msg := json.RawMessage(s.buf[:0])
+	if err := s.dec.Decode(&msg); err != nil {
+		if err == io.EOF && !s.inArray {
+			return false
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return s.fail(err)
+	}
+	s.buf = msg
+	doc, err := ParseExtJSON(msg)
+	if err != nil {
+		return s.fail(err)
+	}
+	s.doc, s.raw = doc, msg
+	return true
+}
+
+func (s *Stream) nextBSON() bool {
+	s.offset = s.next
+	var size [4]byte
+	if _, err := io.ReadFull(s.r, size[:]); err != nil {
+		if err == io.EOF {
+			return false
+		}
+		return s.fail(errors.New("truncated document"))
+	}
+
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 5 || n > maxBSONSize {
+		return s.fail(fmt.Errorf("invalid document length %d", n))
+	}
+	if cap(s.buf) < int(n) {
+		s.buf = make([]byte, n)
+	}
+	s.buf = s.buf[:n]
+	copy(s.buf, size[:])
+	if _, err := io.ReadFull(s.r, s.buf[4:]); err != nil {
+		return s.fail(errors.New("truncated document"))
+	}
+	s.next += int64(n)
+
+	raw := bson.Raw(s.buf)
+	if err := raw.Validate(); err != nil {
+		return s.fail(err)
+	}
+	doc, _ := decodeRawValue(bson.RawValue{Type: bsontype.EmbeddedDocument, Value: raw}).(map[string]interface{})
+	s.doc, s.raw = doc, s.buf
+	return true
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, r.UnreadByte()
+		}
+	}
+}
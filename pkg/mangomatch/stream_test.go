@@ -0,0 +1,187 @@
+package mangomatch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// collectStream returns the "n" field of every document s yields
+func collectStream(t *testing.T, s *Stream) []interface{} {
+	t.Helper()
+	var got []interface{}
+	for s.Next() {
+		got = append(got, s.Doc()["n"])
+	}
+	return got
+}
+
+func bsonStream(t *testing.T, docs ...bson.D) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+func TestStream(t *testing.T) {
+	docs := []bson.D{{{Key: "n", Value: 1}}, {{Key: "n", Value: 2}, {Key: "tags", Value: bson.A{"x"}}}, {{Key: "n", Value: 3}}}
+
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		query  interface{}
+		want   []interface{}
+	}{
+		{name: "NDJSON", format: FormatNDJSON, input: "{\"n\":1}\n\n{\"n\":2}\r\n{\"n\":3}", query: map[string]interface{}{"n": map[string]interface{}{"$gte": 2}}, want: []interface{}{2, 3}},
+		{name: "JSON array", format: FormatJSON, input: " [ {\"n\":1},\n {\"n\":2, \"d\": {\"$date\": \"2024-01-01T00:00:00Z\"}} ]\n", query: map[string]interface{}{"n": 2}, want: []interface{}{2}},
+		{name: "Concatenated JSON", format: FormatJSON, input: "{\"n\":1}{\"n\":2}\n{\"n\":3}", query: nil, want: []interface{}{1, 2, 3}},
+		{name: "Empty query selects all", format: FormatNDJSON, input: "{\"n\":1}\n{\"n\":2}\n", query: map[string]interface{}{}, want: []interface{}{1, 2}},
+		{name: "Empty JSON input", format: FormatJSON, input: "  \n", want: nil},
+		{name: "Empty array", format: FormatJSON, input: "[]", want: nil},
+		{name: "BSON", format: FormatBSON, input: string(bsonStream(t, docs...)), query: map[string]interface{}{"tags": "x"}, want: []interface{}{2}},
+		{name: "Empty BSON", format: FormatBSON, input: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewStream(strings.NewReader(tt.input), tt.format, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := collectStream(t, s)
+			if err := s.Err(); err != nil {
+				t.Fatalf("Err() = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamRawAndPosition(t *testing.T) {
+	s, _ := NewStream(strings.NewReader("{\"n\":1}\n{\"n\":2}\n"), FormatNDJSON, map[string]interface{}{"n": 2})
+	if !s.Next() {
+		t.Fatal(s.Err())
+	}
+	if string(s.Raw()) != "{\"n\":2}\n" || s.Line() != 2 || s.Offset() != 8 {
+		t.Errorf("Raw() = %q, Line() = %d, Offset() = %d", s.Raw(), s.Line(), s.Offset())
+	}
+
+	data := bsonStream(t, bson.D{{Key: "n", Value: 1}}, bson.D{{Key: "n", Value: 2}})
+	s, _ = NewStream(bytes.NewReader(data), FormatBSON, map[string]interface{}{"n": 2})
+	if !s.Next() {
+		t.Fatal(s.Err())
+	}
+	if !bytes.Equal(s.Raw(), data[len(data)/2:]) || s.Offset() != int64(len(data)/2) {
+		t.Errorf("Raw() = %v, Offset() = %d", s.Raw(), s.Offset())
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	valid := bsonStream(t, bson.D{{Key: "n", Value: 1}})
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)-1] = 1
+
+	tests := []struct {
+		name       string
+		format     Format
+		input      []byte
+		wantDocs   int
+		wantLine   int
+		wantOffset int64
+	}{
+		{name: "NDJSON bad line", format: FormatNDJSON, input: []byte("{\"n\":1}\n{\"n\":\n{\"n\":3}\n"), wantDocs: 1, wantLine: 2, wantOffset: 8},
+		{name: "JSON truncated array", format: FormatJSON, input: []byte(`[{"n":1},{"n":2}`), wantDocs: 2, wantOffset: 16},
+		{name: "JSON not a document", format: FormatJSON, input: []byte(`[{"n":1}, 5]`), wantDocs: 1, wantOffset: 8},
+		{name: "BSON truncated", format: FormatBSON, input: append(append([]byte(nil), valid...), valid[:7]...), wantDocs: 1, wantOffset: int64(len(valid))},
+		{name: "BSON bad length", format: FormatBSON, input: append(append([]byte(nil), valid...), 0xff, 0xff, 0xff, 0x7f), wantDocs: 1, wantOffset: int64(len(valid))},
+		{name: "BSON corrupt", format: FormatBSON, input: corrupt, wantDocs: 0, wantOffset: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewStream(bytes.NewReader(tt.input), tt.format, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := collectStream(t, s); len(got) != tt.wantDocs {
+				t.Errorf("got %d documents before the error, want %d", len(got), tt.wantDocs)
+			}
+			var serr *StreamError
+			if !errors.As(s.Err(), &serr) {
+				t.Fatalf("Err() = %v, want a StreamError", s.Err())
+			}
+			if serr.Line != tt.wantLine || serr.Offset != tt.wantOffset {
+				t.Errorf("error at line %d offset %d, want line %d offset %d: %v", serr.Line, serr.Offset, tt.wantLine, tt.wantOffset, serr)
+			}
+			if s.Next() {
+				t.Error("Expected Next to keep returning false after an error")
+			}
+		})
+	}
+
+	if _, err := NewStream(strings.NewReader(""), "xml", nil); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if _, err := NewStream(strings.NewReader(""), FormatJSON, map[string]interface{}{"n": map[string]interface{}{"$foo": 1}}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+
+	s, _ := NewStream(iotestErrReader{}, FormatNDJSON, nil)
+	if s.Next() || !errors.Is(s.Err(), errBrokenReader) {
+		t.Errorf("Err() = %v, want the reader's error", s.Err())
+	}
+}
+
+var errBrokenReader = errors.New("broken reader")
+
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read([]byte) (int, error) { return 0, errBrokenReader }
+
+// TestStreamLongLines checks lines longer than the read buffer
+func TestStreamLongLines(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	input := "{\"n\":1,\"s\":\"" + long + "\"}\n{\"n\":2}\n"
+	s, _ := NewStream(strings.NewReader(input), FormatNDJSON, map[string]interface{}{"s": long})
+	got := collectStream(t, s)
+	if s.Err() != nil || len(got) != 1 || got[0] != 1 {
+		t.Errorf("got %v, err %v", got, s.Err())
+	}
+}
+
+func BenchmarkStreamNDJSON(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		buf.WriteString(`{"n":1,"name":"alice","tags":["a","b"],"nested":{"x":2}}` + "\n")
+	}
+	data := buf.Bytes()
+	query := map[string]interface{}{"nested.x": 2}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s, _ := NewStream(bytes.NewReader(data), FormatNDJSON, query)
+		for s.Next() {
+		}
+		if s.Err() != nil && s.Err() != io.EOF {
+			b.Fatal(s.Err())
+		}
+	}
+}
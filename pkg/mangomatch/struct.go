@@ -0,0 +1,317 @@
+package mangomatch
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// structField describes how one struct field is exposed to queries
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	inline    bool
+}
+
+// structInfo is the cached field metadata of one struct type
+type structInfo struct {
+	fields []structField
+	byName map[string]int
+	inline []int
+}
+
+// structInfoCache holds the *structInfo computed for each struct type
+var structInfoCache sync.Map
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// MatchStruct evaluates query against a Go struct (or pointer to one) without
+// a BSON round trip. Field names follow the bson tag, then the json tag, then
+// the lowercased Go field name, the same way the MongoDB driver names them.
+// As with the driver, an embedded struct is a nested document named after its
+// type unless it is tagged `bson:",inline"`. Only the fields referenced by the
+// query are read.
+func MatchStruct(query map[string]interface{}, v interface{}) bool {
+	doc, ok := AsDocument(v)
+	if !ok {
+		return false
+	}
+	return MatchDocument(query, doc)
+}
+
+// structDocument reads fields of a struct value on demand
+type structDocument struct {
+	v reflect.Value
+}
+
+func (d structDocument) Lookup(path []string) ([]interface{}, bool) {
+	current := d.v
+	for i, part := range path {
+		fv, ok := structFieldByName(current, part)
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			return []interface{}{reflectValue(fv)}, true
+		}
+
+		for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+			if fv.IsNil() {
+				return nil, false
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			current = fv
+			continue
+		}
+
+		// Maps and slices are resolved the same way as in plain documents
+		return lookupRest(reflectValue(fv), path[i+1:])
+	}
+	return nil, false
+}
+
+func (d structDocument) Range(fn func(key string, value interface{}) bool) {
+	for key, val := range structToMap(d.v) {
+		if !fn(key, val) {
+			return
+		}
+	}
+}
+
+// structFieldByName finds the field exposed under name, looking through
+// inlined structs and maps
+func structFieldByName(rv reflect.Value, name string) (reflect.Value, bool) {
+	info := cachedStructInfo(rv.Type())
+
+	if i, ok := info.byName[name]; ok {
+		field := info.fields[i]
+		fv := rv.FieldByIndex(field.index)
+		if field.omitEmpty && isEmptyValue(fv) {
+			return reflect.Value{}, false
+		}
+		return fv, true
+	}
+
+	for _, i := range info.inline {
+		fv := rv.FieldByIndex(info.fields[i].index)
+		for fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		switch fv.Kind() {
+		case reflect.Struct:
+			if found, ok := structFieldByName(fv, name); ok {
+				return found, true
+			}
+		case reflect.Map:
+			if fv.Type().Key().Kind() != reflect.String {
+				continue
+			}
+			if found := fv.MapIndex(reflect.ValueOf(name).Convert(fv.Type().Key())); found.IsValid() {
+				return found, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// cachedStructInfo returns the field metadata for t, computing it once per type
+func cachedStructInfo(t reflect.Type) *structInfo {
+	if cached, ok := structInfoCache.Load(t); ok {
+		return cached.(*structInfo)
+	}
+
+	info := &structInfo{byName: make(map[string]int)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := fieldTag(f)
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		// The driver skips unexported fields, embedded structs included
+		if !f.IsExported() {
+			continue
+		}
+
+		field := structField{
+			name:      name,
+			index:     f.Index,
+			omitEmpty: strings.Contains(opts, "omitempty"),
+			inline:    strings.Contains(opts, "inline"),
+		}
+
+		if field.name == "" {
+			field.name = strings.ToLower(f.Name)
+		}
+
+		if field.inline {
+			info.inline = append(info.inline, len(info.fields))
+		} else {
+			info.byName[field.name] = len(info.fields)
+		}
+		info.fields = append(info.fields, field)
+	}
+
+	cached, _ := structInfoCache.LoadOrStore(t, info)
+	return cached.(*structInfo)
+}
+
+// fieldTag reads the bson tag of f. A field without one falls back to its
+// json tag, as with the driver's JSONFallbackStructTagParser, so structs
+// shared with encoding/json are queried by their JSON names. A bson tag
+// wins even when it only holds options, such as `bson:",omitempty"`; with
+// no name in the tag, the lowercased field name is used.
+func fieldTag(f reflect.StructField) (name string, opts string) {
+	tag, ok := f.Tag.Lookup("bson")
+	if !ok {
+		tag, ok = f.Tag.Lookup("json")
+	}
+	if !ok {
+		return "", ""
+	}
+
+	name, opts, _ = strings.Cut(tag, ",")
+	return name, opts
+}
+
+// structToMap copies the exported fields of a struct value into a map
+func structToMap(rv reflect.Value) map[string]interface{} {
+	info := cachedStructInfo(rv.Type())
+	out := make(map[string]interface{}, len(info.fields))
+	fillStructMap(out, rv, info)
+	return out
+}
+
+func fillStructMap(out map[string]interface{}, rv reflect.Value, info *structInfo) {
+	for _, field := range info.fields {
+		fv := rv.FieldByIndex(field.index)
+
+		if field.inline {
+			for fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			switch {
+			case fv.Kind() == reflect.Struct && fv.Type() != timeType:
+				fillStructMap(out, fv, cachedStructInfo(fv.Type()))
+				continue
+			case fv.Kind() == reflect.Map:
+				if m, ok := reflectValue(fv).(map[string]interface{}); ok {
+					for k, v := range m {
+						out[k] = v
+					}
+				}
+				continue
+			case fv.Kind() == reflect.Pointer:
+				// nil embedded pointer contributes no fields
+				continue
+			}
+		}
+
+		if field.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		out[field.name] = reflectValue(fv)
+	}
+}
+
+// reflectValue converts a reflected value into the plain types the matcher
+// compares: int, float64, string, bool, time.Time, maps and []interface{}
+func reflectValue(rv reflect.Value) interface{} {
+	if rv.IsValid() && rv.Type().PkgPath() == primitivePkg && rv.CanInterface() {
+		// Driver types such as ObjectID keep their type for $type, except
+		// the document and array types, which are converted like any other
+		switch v := rv.Interface().(type) {
+		case primitive.DateTime:
+			return v.Time().UTC()
+		case primitive.M, primitive.D, primitive.A, primitive.E:
+		default:
+			return v
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return reflectValue(rv.Elem())
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt {
+			return float64(u)
+		}
+		return int(u)
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			return rv.Interface()
+		}
+		return structToMap(rv)
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		if rv.Type().Key().Kind() != reflect.String {
+			return rv.Interface()
+		}
+		out := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = reflectValue(iter.Value())
+		}
+		return out
+	case reflect.Slice:
+		if rv.IsNil() {
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes()
+		}
+		fallthrough
+	case reflect.Array:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = reflectValue(rv.Index(i))
+		}
+		return out
+	default:
+		return rv.Interface()
+	}
+}
+
+// isEmptyValue reports whether v counts as empty for omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+		return v.IsZero()
+	default:
+		return v.IsZero()
+	}
+}
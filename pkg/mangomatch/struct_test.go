@@ -0,0 +1,196 @@
+package mangomatch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Audit struct {
+	CreatedBy string    `bson:"created_by"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+type Meta struct {
+	Version int `bson:"version"`
+}
+
+type testInternal struct {
+	Note string `bson:"note"`
+}
+
+type testAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type testUser struct {
+	Audit `bson:",inline"`
+	Meta
+	testInternal `bson:",inline"`
+	Name         string                 `bson:"name"`
+	Age          int32                  `bson:"age"`
+	Score        float32                `json:"score"`
+	Active       bool                   `bson:"active"`
+	Tags         []string               `bson:"tags"`
+	Nickname     string                 `bson:"nickname,omitempty"`
+	Address      *testAddress           `bson:"address"`
+	Manager      *testUser              `bson:"manager,omitempty"`
+	Labels       map[string]int         `bson:"labels"`
+	Extra        map[string]interface{} `bson:",inline"`
+	Secret       string                 `bson:"-"`
+	Visits       uint
+	private      string
+}
+
+func TestMatchStruct(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	user := testUser{
+		Audit:        Audit{CreatedBy: "admin", CreatedAt: created},
+		Meta:         Meta{Version: 3},
+		testInternal: testInternal{Note: "internal"},
+		Name:         "John",
+		Age:          30,
+		Score:        4.5,
+		Active:       true,
+		Tags:         []string{"premium", "verified"},
+		Address:      &testAddress{City: "New York"},
+		Labels:       map[string]int{"priority": 2},
+		Extra:        map[string]interface{}{"source": "import"},
+		Secret:       "hunter2",
+		Visits:       7,
+		private:      "hidden",
+	}
+
+	tests := []struct {
+		name  string
+		query map[string]interface{}
+		want  bool
+	}{
+		{name: "bson tag equality", query: map[string]interface{}{"name": "John"}, want: true},
+		{name: "int32 field compares as int", query: map[string]interface{}{"age": 30}, want: true},
+		{name: "int32 field with $gt", query: map[string]interface{}{"age": map[string]interface{}{"$gt": 25}}, want: true},
+		{name: "float32 field via json tag", query: map[string]interface{}{"score": map[string]interface{}{"$gte": 4.5}}, want: true},
+		{name: "untagged field is lowercased", query: map[string]interface{}{"visits": 7}, want: true},
+		{name: "slice of strings", query: map[string]interface{}{"tags": "premium"}, want: true},
+		{name: "slice with $all", query: map[string]interface{}{"tags": map[string]interface{}{"$all": []interface{}{"premium", "verified"}}}, want: true},
+		{name: "pointer to nested struct", query: map[string]interface{}{"address.city": "New York"}, want: true},
+		{name: "omitempty nested field is absent", query: map[string]interface{}{"address.zip": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "omitempty field is absent", query: map[string]interface{}{"nickname": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "omitempty nil pointer is absent", query: map[string]interface{}{"manager": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "map field", query: map[string]interface{}{"labels.priority": 2}, want: true},
+		{name: "inline map", query: map[string]interface{}{"source": "import"}, want: true},
+		{name: "inline embedded struct fields are promoted", query: map[string]interface{}{"created_by": "admin"}, want: true},
+		{name: "untagged embedded struct is nested under its type name", query: map[string]interface{}{"meta.version": 3}, want: true},
+		{name: "untagged embedded struct fields are not promoted", query: map[string]interface{}{"version": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "unexported embedded struct is skipped", query: map[string]interface{}{"note": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "time.Time equality", query: map[string]interface{}{"created_at": created}, want: true},
+		{name: "time.Time range", query: map[string]interface{}{"created_at": map[string]interface{}{"$lt": created.Add(time.Hour)}}, want: true},
+		{name: "skipped field", query: map[string]interface{}{"secret": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "unexported field", query: map[string]interface{}{"private": map[string]interface{}{"$exists": false}}, want: true},
+		{name: "no match", query: map[string]interface{}{"name": "Jane"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchStruct(tt.query, user); got != tt.want {
+				t.Errorf("MatchStruct() = %v, want %v", got, tt.want)
+			}
+			if got := MatchStruct(tt.query, &user); got != tt.want {
+				t.Errorf("MatchStruct() with pointer = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchStructInvalidInput(t *testing.T) {
+	query := map[string]interface{}{"name": "John"}
+
+	var nilUser *testUser
+	if MatchStruct(query, nilUser) {
+		t.Error("Expected nil pointer not to match")
+	}
+	if MatchStruct(query, 42) {
+		t.Error("Expected non-struct value not to match")
+	}
+	if !MatchStruct(query, map[string]interface{}{"name": "John"}) {
+		t.Error("Expected map[string]interface{} to be matched directly")
+	}
+}
+
+func TestMatchStructTagPrecedence(t *testing.T) {
+	type tagged struct {
+		Both    string `bson:"bson_name" json:"json_name"`
+		JSON    string `json:"json_only"`
+		Plain   string
+		Options string `bson:",omitempty" json:"json_ignored"`
+	}
+	v := tagged{Both: "a", JSON: "b", Plain: "c", Options: "d"}
+
+	tests := []struct {
+		field string
+		value string
+		want  bool
+	}{
+		{field: "bson_name", value: "a", want: true},
+		{field: "json_name", value: "a", want: false},
+		{field: "both", value: "a", want: false},
+		{field: "json_only", value: "b", want: true},
+		{field: "json", value: "b", want: false},
+		{field: "plain", value: "c", want: true},
+		{field: "options", value: "d", want: true},
+		{field: "json_ignored", value: "d", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchStruct(map[string]interface{}{tt.field: tt.value}, v); got != tt.want {
+			t.Errorf("MatchStruct({%q: %q}) = %v, want %v", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMatchStructEmbeddedLikeDriver(t *testing.T) {
+	user := testUser{
+		Audit:        Audit{CreatedBy: "admin"},
+		Meta:         Meta{Version: 3},
+		testInternal: testInternal{Note: "internal"},
+	}
+	doc, err := StructToBsonMap(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"created_by", "meta.version", "version", "meta", "note", "audit"} {
+		query := map[string]interface{}{field: map[string]interface{}{"$exists": true}}
+		if got, want := MatchStruct(query, user), Match(query, doc); got != want {
+			t.Errorf("MatchStruct(%s $exists) = %v, the driver's encoding gives %v", field, got, want)
+		}
+	}
+}
+
+func TestCachedStructInfo(t *testing.T) {
+	typ := reflect.TypeOf(testUser{})
+	if cachedStructInfo(typ) != cachedStructInfo(typ) {
+		t.Error("Expected field metadata to be cached per type")
+	}
+}
+
+func BenchmarkMatchStruct(b *testing.B) {
+	user := testUser{Name: "John", Age: 30, Tags: []string{"premium"}}
+	query := map[string]interface{}{"age": map[string]interface{}{"$gt": 25}, "tags": "premium"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		MatchStruct(query, &user)
+	}
+}
+
+func BenchmarkStructToBsonMap(b *testing.B) {
+	user := testUser{Name: "John", Age: 30, Tags: []string{"premium"}}
+	query := map[string]interface{}{"age": map[string]interface{}{"$gt": 25}, "tags": "premium"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		doc, _ := StructToBsonMap(&user)
+		Match(query, doc)
+	}
+}
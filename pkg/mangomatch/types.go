@@ -0,0 +1,191 @@
+package mangomatch
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// typeAliases maps the $type aliases MongoDB accepts to BSON types.
+// "boolean" is kept for queries written against earlier versions.
+var typeAliases = map[string]bsontype.Type{
+	"double":              bsontype.Double,
+	"string":              bsontype.String,
+	"object":              bsontype.EmbeddedDocument,
+	"array":               bsontype.Array,
+	"binData":             bsontype.Binary,
+	"undefined":           bsontype.Undefined,
+	"objectId":            bsontype.ObjectID,
+	"bool":                bsontype.Boolean,
+	"boolean":             bsontype.Boolean,
+	"date":                bsontype.DateTime,
+	"null":                bsontype.Null,
+	"regex":               bsontype.Regex,
+	"dbPointer":           bsontype.DBPointer,
+	"javascript":          bsontype.JavaScript,
+	"symbol":              bsontype.Symbol,
+	"javascriptWithScope": bsontype.CodeWithScope,
+	"int":                 bsontype.Int32,
+	"timestamp":           bsontype.Timestamp,
+	"long":                bsontype.Int64,
+	"decimal":             bsontype.Decimal128,
+	"minKey":              bsontype.MinKey,
+	"maxKey":              bsontype.MaxKey,
+}
+
+// numberTypes are the types the "number" alias stands for
+var numberTypes = []bsontype.Type{bsontype.Double, bsontype.Int32, bsontype.Int64, bsontype.Decimal128}
+
+var primitivePkg = reflect.TypeOf(primitive.ObjectID{}).PkgPath()
+
+// typeSet parses a $type operand: an alias, a numeric type code or an
+// array of those
+func typeSet(operand interface{}) (map[bsontype.Type]bool, error) {
+	items, ok := operand.([]interface{})
+	if !ok {
+		items = []interface{}{operand}
+	} else if len(items) == 0 {
+		return nil, errors.New("requires at least one type")
+	}
+
+	types := make(map[bsontype.Type]bool, len(items))
+	for _, item := range items {
+		switch v := widenNumber(item).(type) {
+		case string:
+			if v == "number" {
+				for _, t := range numberTypes {
+					types[t] = true
+				}
+				continue
+			}
+			t, ok := typeAliases[v]
+			if !ok {
+				return nil, errors.New("unknown type " + v)
+			}
+			types[t] = true
+		case int, float64:
+			code := toFloat(v)
+			// MinKey is -1 in queries but 0xFF on the wire
+			if code == -1 {
+				code = float64(bsontype.MinKey)
+			}
+			t := bsontype.Type(code)
+			if code != math.Trunc(code) || code < 1 || code > 255 || typeName(t) == "" {
+				return nil, errors.New("unknown type code")
+			}
+			types[t] = true
+		default:
+			return nil, errors.New("requires a type name or code")
+		}
+	}
+	return types, nil
+}
+
+// typeName returns the alias of t, or "" if t is not a BSON type
+func typeName(t bsontype.Type) string {
+	for name, alias := range typeAliases {
+		if alias == t && name != "boolean" {
+			return name
+		}
+	}
+	return ""
+}
+
+// hasType reports whether value, or one of its elements if it is an array,
+// has one of types
+func hasType(types map[bsontype.Type]bool, value interface{}) bool {
+	if types[typeOf(value)] {
+		return true
+	}
+	items, _ := value.([]interface{})
+	for _, item := range items {
+		if types[typeOf(item)] {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the BSON type value would be stored as, following the
+// driver's encoding: a Go int is an int32 if it fits and a long otherwise.
+// It returns 0 for values that have no BSON representation.
+func typeOf(value interface{}) bsontype.Type {
+	switch v := value.(type) {
+	case nil:
+		return bsontype.Null
+	case string:
+		return bsontype.String
+	case bool:
+		return bsontype.Boolean
+	case int:
+		return intType(int64(v))
+	case int8, int16, int32, uint8, uint16:
+		return bsontype.Int32
+	case int64:
+		return bsontype.Int64
+	case uint:
+		return uintType(uint64(v))
+	case uint32:
+		return uintType(uint64(v))
+	case uint64:
+		return uintType(v)
+	case float32, float64:
+		return bsontype.Double
+	case primitive.Decimal128:
+		return bsontype.Decimal128
+	case time.Time, primitive.DateTime:
+		return bsontype.DateTime
+	case primitive.ObjectID:
+		return bsontype.ObjectID
+	case primitive.Binary, []byte:
+		return bsontype.Binary
+	case primitive.Regex:
+		return bsontype.Regex
+	case primitive.Timestamp:
+		return bsontype.Timestamp
+	case primitive.MinKey:
+		return bsontype.MinKey
+	case primitive.MaxKey:
+		return bsontype.MaxKey
+	case primitive.JavaScript:
+		return bsontype.JavaScript
+	case primitive.CodeWithScope:
+		return bsontype.CodeWithScope
+	case primitive.Symbol:
+		return bsontype.Symbol
+	case primitive.DBPointer:
+		return bsontype.DBPointer
+	case primitive.Undefined:
+		return bsontype.Undefined
+	case map[string]interface{}, primitive.M, primitive.D:
+		return bsontype.EmbeddedDocument
+	case []interface{}, primitive.A:
+		return bsontype.Array
+	}
+
+	switch rv := reflect.ValueOf(value); rv.Kind() {
+	case reflect.Map, reflect.Struct:
+		return bsontype.EmbeddedDocument
+	case reflect.Slice, reflect.Array:
+		return bsontype.Array
+	}
+	return 0
+}
+
+func intType(v int64) bsontype.Type {
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return bsontype.Int64
+	}
+	return bsontype.Int32
+}
+
+func uintType(v uint64) bsontype.Type {
+	if v > math.MaxInt32 {
+		return bsontype.Int64
+	}
+	return bsontype.Int32
+}
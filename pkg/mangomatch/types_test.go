@@ -0,0 +1,177 @@
+package mangomatch
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTypeOperator(t *testing.T) {
+	oid := primitive.NewObjectID()
+	doc := map[string]interface{}{
+		"str":     "a",
+		"small":   7,
+		"big":     1 << 40,
+		"i32":     int32(7),
+		"i64":     int64(7),
+		"dbl":     1.5,
+		"dec":     primitive.NewDecimal128(0, 15),
+		"bool":    true,
+		"null":    nil,
+		"date":    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"oid":     oid,
+		"bin":     primitive.Binary{Data: []byte{1}},
+		"bytes":   []byte{1},
+		"re":      primitive.Regex{Pattern: "^a"},
+		"ts":      primitive.Timestamp{T: 1},
+		"min":     primitive.MinKey{},
+		"max":     primitive.MaxKey{},
+		"js":      primitive.JavaScript("1"),
+		"obj":     map[string]interface{}{"a": 1},
+		"arr":     []interface{}{1, "x"},
+		"empty":   []interface{}{},
+		"nested":  []interface{}{[]interface{}{"x"}},
+		"objects": []interface{}{map[string]interface{}{"a": 1}, 2},
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		types interface{}
+		want  bool
+	}{
+		{name: "string", field: "str", types: "string", want: true},
+		{name: "int", field: "small", types: "int", want: true},
+		{name: "int is not long", field: "small", types: "long", want: false},
+		{name: "Large int is long", field: "big", types: "long", want: true},
+		{name: "int32", field: "i32", types: "int", want: true},
+		{name: "int64", field: "i64", types: "long", want: true},
+		{name: "double", field: "dbl", types: "double", want: true},
+		{name: "decimal", field: "dec", types: "decimal", want: true},
+		{name: "number int", field: "small", types: "number", want: true},
+		{name: "number long", field: "i64", types: "number", want: true},
+		{name: "number decimal", field: "dec", types: "number", want: true},
+		{name: "number is not string", field: "str", types: "number", want: false},
+		{name: "bool", field: "bool", types: "bool", want: true},
+		{name: "boolean", field: "bool", types: "boolean", want: true},
+		{name: "null", field: "null", types: "null", want: true},
+		{name: "date", field: "date", types: "date", want: true},
+		{name: "objectId", field: "oid", types: "objectId", want: true},
+		{name: "binData", field: "bin", types: "binData", want: true},
+		{name: "[]byte", field: "bytes", types: "binData", want: true},
+		{name: "regex", field: "re", types: "regex", want: true},
+		{name: "timestamp", field: "ts", types: "timestamp", want: true},
+		{name: "minKey", field: "min", types: "minKey", want: true},
+		{name: "maxKey", field: "max", types: "maxKey", want: true},
+		{name: "javascript", field: "js", types: "javascript", want: true},
+		{name: "object", field: "obj", types: "object", want: true},
+		{name: "array", field: "arr", types: "array", want: true},
+		{name: "Empty array", field: "empty", types: "array", want: true},
+		{name: "Array element", field: "arr", types: "string", want: true},
+		{name: "No array element", field: "arr", types: "bool", want: false},
+		{name: "Nested array element", field: "nested", types: "array", want: true},
+		{name: "Elements of nested arrays are not checked", field: "nested", types: "string", want: false},
+		{name: "Object element", field: "objects", types: "object", want: true},
+		{name: "Code 2", field: "str", types: 2, want: true},
+		{name: "Code 16", field: "small", types: 16, want: true},
+		{name: "Code 18", field: "i64", types: 18, want: true},
+		{name: "Code 9 as a float", field: "date", types: 9.0, want: true},
+		{name: "Code -1", field: "min", types: -1, want: true},
+		{name: "Code 127", field: "max", types: 127, want: true},
+		{name: "Code mismatch", field: "str", types: 1, want: false},
+		{name: "Array of types", field: "null", types: []interface{}{"string", "null"}, want: true},
+		{name: "Array of codes and aliases", field: "dbl", types: []interface{}{2, "double"}, want: true},
+		{name: "Array of types no match", field: "bool", types: []interface{}{"string", 10}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := map[string]interface{}{tt.field: map[string]interface{}{"$type": tt.types}}
+			if got := Match(query, doc); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if Match(map[string]interface{}{"missing": map[string]interface{}{"$type": "null"}}, doc) {
+		t.Error("Expected a missing field not to match $type null")
+	}
+}
+
+func TestTypeOperatorDecodedValues(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "i32", Value: int32(1)},
+		{Key: "i64", Value: int64(1 << 40)},
+		{Key: "dec", Value: primitive.NewDecimal128(0, 1)},
+		{Key: "oid", Value: primitive.NewObjectID()},
+		{Key: "date", Value: primitive.NewDateTimeFromTime(time.Now())},
+		{Key: "re", Value: primitive.Regex{Pattern: "a"}},
+		{Key: "ts", Value: primitive.Timestamp{T: 1}},
+		{Key: "bin", Value: primitive.Binary{Data: []byte{1}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for field, alias := range map[string]string{
+		"i32": "int", "i64": "long", "dec": "decimal", "oid": "objectId",
+		"date": "date", "re": "regex", "ts": "timestamp", "bin": "binData",
+	} {
+		if !MatchRaw(map[string]interface{}{field: map[string]interface{}{"$type": alias}}, raw) {
+			t.Errorf("MatchRaw(%s $type %s) = false, want true", field, alias)
+		}
+	}
+
+	small, err := bson.Marshal(bson.D{{Key: "i32", Value: int32(5)}, {Key: "i64", Value: int64(5)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := ParseExtJSON([]byte(`{"i32": {"$numberInt": "5"}, "i64": {"$numberLong": "5"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field, alias string
+		want         bool
+	}{
+		{"i64", "long", true},
+		{"i64", "int", false},
+		{"i64", "number", true},
+		{"i32", "int", true},
+		{"i32", "long", false},
+	}
+	for _, tt := range tests {
+		query := map[string]interface{}{tt.field: map[string]interface{}{"$type": tt.alias}}
+		if got := MatchRaw(query, small); got != tt.want {
+			t.Errorf("MatchRaw(%s $type %s) = %v, want %v", tt.field, tt.alias, got, tt.want)
+		}
+		if got := Match(query, ext); got != tt.want {
+			t.Errorf("Match(ParseExtJSON %s $type %s) = %v, want %v", tt.field, tt.alias, got, tt.want)
+		}
+	}
+	if !MatchRaw(map[string]interface{}{"i64": 5, "i32": map[string]interface{}{"$lt": int64(6)}}, small) {
+		t.Error("Expected an int64 to compare equal to an int")
+	}
+
+	type record struct {
+		ID      primitive.ObjectID `bson:"_id"`
+		Created primitive.DateTime `bson:"created"`
+	}
+	rec := record{ID: primitive.NewObjectID(), Created: primitive.NewDateTimeFromTime(time.Now())}
+	if !MatchStruct(map[string]interface{}{"_id": map[string]interface{}{"$type": "objectId"}}, rec) {
+		t.Error("Expected a struct ObjectID field to match $type objectId")
+	}
+	if !MatchStruct(map[string]interface{}{"created": map[string]interface{}{"$type": "date", "$lte": time.Now()}}, rec) {
+		t.Error("Expected a struct DateTime field to be read as a date")
+	}
+}
+
+func TestTypeOperatorInvalid(t *testing.T) {
+	for _, operand := range []interface{}{"invalidType", "Int", 0, 20, 1.5, 256, []interface{}{}, []interface{}{"string", true}, true} {
+		if _, err := Compile(map[string]interface{}{"a": map[string]interface{}{"$type": operand}}); err == nil {
+			t.Errorf("Compile($type %v) succeeded, want an error", operand)
+		}
+	}
+}